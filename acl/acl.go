@@ -0,0 +1,255 @@
+package acl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+type (
+	Action string
+	Role   string
+
+	// Config is the ACL file format
+	Config struct {
+		DefaultDeny bool    `json:"defaultDeny"` // reject sources matching no peer and no rule
+		Reject403   bool    `json:"reject403"`   // answer rejected requests with 403 instead of silently dropping them
+		Peers       []*Peer `json:"peers"`
+		Rules       []*Rule `json:"rules"`
+	}
+
+	// Peer is a trusted signalling source, identified by its addresses and optionally its port
+	Peer struct {
+		Name    string   `json:"name"`
+		CIDRs   []string `json:"cidrs"`
+		Port    int      `json:"port,omitempty"`    // any port if 0
+		Methods []string `json:"methods,omitempty"` // methods accepted from the peer, all if empty
+		Role    Role     `json:"role,omitempty"`
+		Profile *Profile `json:"profile,omitempty"`
+
+		nets []*net.IPNet
+	}
+
+	// Profile adapts the headers of the out-of-dialogue requests received from a peer, before they are handled
+	Profile struct {
+		RemoveHeaders []string          `json:"removeHeaders,omitempty"` // e.g. P-Asserted-Identity of a peer not trusted for identity
+		SetHeaders    map[string]string `json:"setHeaders,omitempty"`
+	}
+
+	// Rule allows or denies the methods (all if empty) of the sources in its CIDRs; rules are checked in order
+	Rule struct {
+		Action  Action   `json:"action"`
+		CIDRs   []string `json:"cidrs"`
+		Methods []string `json:"methods,omitempty"`
+
+		nets []*net.IPNet
+	}
+
+	// ACL decides which sources may send which out-of-dialogue requests
+	ACL struct {
+		peers       []*Peer
+		rules       []*Rule
+		defaultDeny bool
+		reject403   bool
+	}
+
+	// Decision is the outcome of Check; Reason is "peer", "rule" or "default" when rejected
+	Decision struct {
+		Peer    *Peer
+		Reason  string
+		Allowed bool
+	}
+)
+
+const (
+	Allow Action = "allow"
+	Deny  Action = "deny"
+
+	RoleNone Role = ""
+	RoleAS   Role = "as" // application server: its calls are routed to their called phone or number, others towards it
+)
+
+var ErrBadConfig = errors.New("bad ACL configuration")
+
+// AllowAll returns an ACL with no peer nor rule accepting everything
+func AllowAll() *ACL {
+	return &ACL{}
+}
+
+// Load reads the ACL JSON file at path
+func Load(path string) (*ACL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadConfig, err)
+	}
+	return New(cfg)
+}
+
+func New(cfg Config) (*ACL, error) {
+	a := &ACL{defaultDeny: cfg.DefaultDeny, reject403: cfg.Reject403}
+	for i, p := range cfg.Peers {
+		if err := a.AddPeer(p); err != nil {
+			return nil, fmt.Errorf("%w: peer #%d: %w", ErrBadConfig, i+1, err)
+		}
+	}
+	for i, r := range cfg.Rules {
+		if r.Action != Allow && r.Action != Deny {
+			return nil, fmt.Errorf("%w: rule #%d: invalid action %q", ErrBadConfig, i+1, r.Action)
+		}
+		nets, err := parseCIDRs(r.CIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule #%d: %w", ErrBadConfig, i+1, err)
+		}
+		r.nets = nets
+		r.Methods = upper(r.Methods)
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// AddPeer adds a trusted peer, to be done before the ACL is in use
+func (a *ACL) AddPeer(p *Peer) error {
+	if p.Name == "" {
+		return errors.New("missing name")
+	}
+	if p.Role != RoleNone && p.Role != RoleAS {
+		return fmt.Errorf("invalid role %q", p.Role)
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid port %d", p.Port)
+	}
+	nets, err := parseCIDRs(p.CIDRs)
+	if err != nil {
+		return err
+	}
+	p.nets = nets
+	p.Methods = upper(p.Methods)
+	a.peers = append(a.peers, p)
+	return nil
+}
+
+// PeerOf returns the peer matching the source address most specifically, or nil: longest matching prefix first,
+// then peers with a port, then the AS role, then the first listed. A peer covering the AS subnet thus never shadows the AS
+func (a *ACL) PeerOf(addr *net.UDPAddr) *Peer {
+	if a == nil || addr == nil {
+		return nil
+	}
+	var best *Peer
+	bestRank := -1
+	for _, p := range a.peers {
+		if p.Port != 0 && p.Port != addr.Port {
+			continue
+		}
+		bits := p.prefixLen(addr.IP)
+		if bits < 0 {
+			continue
+		}
+		rank := bits * 4
+		if p.Port != 0 {
+			rank += 2
+		}
+		if p.Role == RoleAS {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = p, rank
+		}
+	}
+	return best
+}
+
+// Peers returns the trusted peers, in their configuration order
+func (a *ACL) Peers() []*Peer {
+	if a == nil {
+		return nil
+	}
+	return a.peers
+}
+
+// Check decides whether a request with method may be accepted from addr: peers first, then rules, then the default
+func (a *ACL) Check(addr *net.UDPAddr, method string) Decision {
+	if a == nil {
+		return Decision{Allowed: true}
+	}
+	if p := a.PeerOf(addr); p != nil {
+		if len(p.Methods) == 0 || slices.Contains(p.Methods, method) {
+			return Decision{Peer: p, Allowed: true}
+		}
+		return Decision{Peer: p, Reason: "peer"}
+	}
+	for _, r := range a.rules {
+		if (len(r.Methods) == 0 || slices.Contains(r.Methods, method)) && contains(r.nets, addr.IP) {
+			if r.Action == Allow {
+				return Decision{Allowed: true}
+			}
+			return Decision{Reason: "rule"}
+		}
+	}
+	if a.defaultDeny {
+		return Decision{Reason: "default"}
+	}
+	return Decision{Allowed: true}
+}
+
+// Reject403 tells whether rejected requests are answered with 403 rather than dropped
+func (a *ACL) Reject403() bool {
+	return a != nil && a.reject403
+}
+
+func (p *Peer) IsAS() bool {
+	return p != nil && p.Role == RoleAS
+}
+
+// prefixLen returns the longest prefix length of the peer networks containing ip, -1 if none
+func (p *Peer) prefixLen(ip net.IP) int {
+	best := -1
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			ones, _ := n.Mask.Size()
+			best = max(best, ones)
+		}
+	}
+	return best
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	if len(cidrs) == 0 {
+		return nil, errors.New("missing cidrs")
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") { // single address
+			if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	return slices.ContainsFunc(nets, func(n *net.IPNet) bool { return n.Contains(ip) })
+}
+
+func upper(methods []string) []string {
+	out := make([]string, len(methods))
+	for i, m := range methods {
+		out[i] = strings.ToUpper(strings.TrimSpace(m))
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package acl_test
+
+import (
+	"SRGo/acl"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func udp(s string) *net.UDPAddr {
+	addr, _ := net.ResolveUDPAddr("udp", s)
+	return addr
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	a, err := acl.New(acl.Config{
+		DefaultDeny: true,
+		Peers: []*acl.Peer{
+			{Name: "as", CIDRs: []string{"10.0.0.5"}, Port: 5060, Role: acl.RoleAS},
+			{Name: "carrier", CIDRs: []string{"192.0.2.0/24"}, Methods: []string{"invite", "OPTIONS"}},
+		},
+		Rules: []*acl.Rule{
+			{Action: acl.Deny, CIDRs: []string{"172.16.9.0/24"}},
+			{Action: acl.Allow, CIDRs: []string{"172.16.0.0/16"}, Methods: []string{"REGISTER", "INVITE"}},
+		},
+	})
+	require.NoError(t, err)
+
+	d := a.Check(udp("10.0.0.5:5060"), "INVITE")
+	require.True(t, d.Allowed)
+	require.True(t, d.Peer.IsAS())
+	require.Nil(t, a.PeerOf(udp("10.0.0.5:5070")), "peer port must match")
+
+	require.True(t, a.Check(udp("192.0.2.7:5060"), "INVITE").Allowed)
+	d = a.Check(udp("192.0.2.7:5060"), "REGISTER")
+	require.False(t, d.Allowed)
+	require.Equal(t, "peer", d.Reason)
+	require.False(t, d.Peer.IsAS())
+
+	require.True(t, a.Check(udp("172.16.1.1:5060"), "REGISTER").Allowed)
+	d = a.Check(udp("172.16.9.1:5060"), "REGISTER")
+	require.Equal(t, acl.Decision{Reason: "rule"}, d)
+	d = a.Check(udp("172.16.1.1:5060"), "OPTIONS")
+	require.Equal(t, acl.Decision{Reason: "default"}, d)
+	require.False(t, a.Reject403())
+
+	require.True(t, acl.AllowAll().Check(udp("203.0.113.1:5060"), "INVITE").Allowed)
+	var none *acl.ACL
+	require.Nil(t, none.PeerOf(udp("10.0.0.5:5060")))
+}
+
+func TestPeerOf(t *testing.T) {
+	t.Parallel()
+
+	a, err := acl.New(acl.Config{
+		Peers: []*acl.Peer{
+			{Name: "lan", CIDRs: []string{"10.0.0.0/8"}, Profile: &acl.Profile{RemoveHeaders: []string{"P-Asserted-Identity"}}},
+			{Name: "pbx", CIDRs: []string{"10.0.0.0/24"}},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.AddPeer(&acl.Peer{Name: "as", CIDRs: []string{"10.0.0.5"}, Port: 5060, Role: acl.RoleAS}))
+
+	require.True(t, a.PeerOf(udp("10.0.0.5:5060")).IsAS(), "not shadowed by peers listed before")
+	require.Equal(t, "pbx", a.PeerOf(udp("10.0.0.5:5070")).Name)
+	require.Equal(t, "pbx", a.PeerOf(udp("10.0.0.9:5060")).Name, "longest prefix")
+	p := a.PeerOf(udp("10.1.0.1:5060"))
+	require.Equal(t, "lan", p.Name)
+	require.Equal(t, []string{"P-Asserted-Identity"}, p.Profile.RemoveHeaders)
+	require.Len(t, a.Peers(), 3)
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "acl.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"defaultDeny": false, "reject403": true,
+		"rules": [{"action": "deny", "cidrs": ["0.0.0.0/0"], "methods": ["REGISTER"]}]}`), 0o600))
+	a, err := acl.Load(path)
+	require.NoError(t, err)
+	require.True(t, a.Reject403())
+	require.False(t, a.Check(udp("198.51.100.1:5060"), "REGISTER").Allowed)
+	require.True(t, a.Check(udp("198.51.100.1:5060"), "INVITE").Allowed)
+
+	for _, cfg := range []string{
+		`{"rules": [{"action": "maybe", "cidrs": ["0.0.0.0/0"]}]}`,
+		`{"rules": [{"action": "deny", "cidrs": ["300.0.0.0/8"]}]}`,
+		`{"peers": [{"name": "x"}]}`,
+		`{"peers": [{"name": "x", "cidrs": ["10.0.0.1"], "role": "pbx"}]}`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(cfg), 0o600))
+		_, err = acl.Load(path)
+		require.ErrorIs(t, err, acl.ErrBadConfig, cfg)
+	}
+}
@@ -28,14 +28,14 @@ func prepareCdrFiles() (*os.File, bool) {
 		modtm := info.ModTime().UTC().Format(global.DicTFs[global.CDRTimestamp])
 		err = os.Rename(CDRFilename, strings.Replace(CDRFilename, "current", modtm, 1))
 		if err != nil {
-			global.LogError(global.LTSystem, fmt.Sprint("Error renaming existing CDR file:", err))
+			global.LogError(global.LTSystem, "Error renaming existing CDR file", "error", err)
 			return nil, false
 		}
 	}
 
 	file, err := os.OpenFile(CDRFilename, os.O_CREATE|os.O_WRONLY, 0644) // os.O_APPEND|
 	if err != nil {
-		global.LogWarning(global.LTSystem, fmt.Sprint("Error opening CDR file:", err))
+		global.LogWarning(global.LTSystem, "Error opening CDR file", "error", err)
 		return nil, false
 	}
 
@@ -50,7 +50,7 @@ func writeCDRs(file *os.File) {
 
 	writeLine := func(line string) {
 		if _, err := fmt.Fprintln(file, line); err != nil {
-			fmt.Println("Error writing to file:", err)
+			global.LogError(global.LTSystem, "Error writing CDR", "error", err)
 		}
 	}
 
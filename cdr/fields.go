@@ -34,6 +34,10 @@ const (
 	TerminationCause       Field = "terminationCause"       // Reason for call termination
 	RedirectionStatus      Field = "redirectionStatus"      // Indicates if redirection occurred
 	RoamingStatus          Field = "roamingStatus"          // Indicates if caller was roaming
+	MOS                    Field = "mos"                    // Estimated Mean Opinion Score, worst of both legs
+	JitterMS               Field = "jitterMs"               // Mean RTCP reported jitter in ms, worst of both legs
+	PacketLossPercent      Field = "packetLossPercent"      // Mean RTCP reported packet loss, worst of both legs
+	RoundTripMS            Field = "roundTripMs"            // Mean round-trip time in ms, worst of both legs
 )
 
 func getAllFields() []Field {
@@ -61,6 +65,10 @@ func getAllFields() []Field {
 		TerminationCause,
 		RedirectionStatus,
 		RoamingStatus,
+		MOS,
+		JitterMS,
+		PacketLossPercent,
+		RoundTripMS,
 	}
 }
 
@@ -0,0 +1,115 @@
+package codec
+
+// G.711 (ITU-T) companding tables, to and from 16-bit linear PCM
+
+const (
+	PayloadPCMU uint8 = 0
+	PayloadPCMA uint8 = 8
+
+	G711ClockRate = 8000
+)
+
+var (
+	ulawToLinear [256]int16
+	alawToLinear [256]int16
+	ulawToALaw   [256]byte
+	alawToULaw   [256]byte
+)
+
+func init() {
+	for i := range 256 {
+		ulawToLinear[i] = decodeULaw(uint8(i))
+		alawToLinear[i] = decodeALaw(uint8(i))
+	}
+	for i := range 256 {
+		ulawToALaw[i] = EncodeALaw(ulawToLinear[i])
+		alawToULaw[i] = EncodeULaw(alawToLinear[i])
+	}
+}
+
+func decodeULaw(u uint8) int16 {
+	u = ^u
+	t := (int16(u&0x0F) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+func decodeALaw(a uint8) int16 {
+	a ^= 0x55
+	t := int16(a&0x0F) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+// EncodeULaw compands a linear PCM sample to µ-law
+func EncodeULaw(sample int16) uint8 {
+	const bias, clip = 0x84, 32635
+	s := int32(sample)
+	sign := uint8(0)
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	s = min(s, clip) + bias
+	exp := uint8(7)
+	for mask := int32(0x4000); s&mask == 0 && exp > 0; mask >>= 1 {
+		exp--
+	}
+	mantissa := uint8(s>>(exp+3)) & 0x0F
+	return ^(sign | exp<<4 | mantissa)
+}
+
+// EncodeALaw compands a linear PCM sample to A-law
+func EncodeALaw(sample int16) uint8 {
+	s := int32(sample)
+	sign := uint8(0x80)
+	if s < 0 {
+		s = -s - 1
+		sign = 0
+	}
+	s = min(s, 0x7FFF) >> 3
+	var a uint8
+	if s < 32 {
+		a = uint8(s >> 1)
+	} else {
+		exp := uint8(1)
+		for s >= 64 {
+			s >>= 1
+			exp++
+		}
+		a = exp<<4 | uint8(s>>1)&0x0F
+	}
+	return (sign | a) ^ 0x55
+}
+
+// IsG711 reports whether the static payload type is PCMU or PCMA
+func IsG711(pt uint8) bool {
+	return pt == PayloadPCMU || pt == PayloadPCMA
+}
+
+// DecodeG711 appends the linear PCM samples of a PCMU/PCMA payload to dst
+func DecodeG711(dst []int16, pt uint8, payload []byte) []int16 {
+	table := &ulawToLinear
+	if pt == PayloadPCMA {
+		table = &alawToLinear
+	}
+	for _, b := range payload {
+		dst = append(dst, table[b])
+	}
+	return dst
+}
@@ -0,0 +1,56 @@
+package codec_test
+
+import (
+	"SRGo/codec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestG711RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for i := range 256 {
+		b := byte(i)
+		alaw := codec.DecodeG711(nil, codec.PayloadPCMA, []byte{b})[0]
+		require.Equal(t, b, codec.EncodeALaw(alaw), "A-law code %#x", b)
+
+		if b == 0x7F { // µ-law negative zero encodes back as positive zero
+			continue
+		}
+		ulaw := codec.DecodeG711(nil, codec.PayloadPCMU, []byte{b})[0]
+		require.Equal(t, b, codec.EncodeULaw(ulaw), "µ-law code %#x", b)
+	}
+}
+
+func TestG711Silence(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, uint8(0xFF), codec.EncodeULaw(0))
+	require.Equal(t, uint8(0xD5), codec.EncodeALaw(0))
+	require.Equal(t, []int16{0, 8}, []int16{
+		codec.DecodeG711(nil, codec.PayloadPCMU, []byte{0xFF})[0],
+		codec.DecodeG711(nil, codec.PayloadPCMA, []byte{0xD5})[0],
+	})
+}
+
+func TestTranscodeULawALaw(t *testing.T) {
+	t.Parallel()
+
+	toALaw, ok := codec.Lookup("pcmu", "PCMA")
+	require.True(t, ok)
+	toULaw, ok := codec.Lookup("PCMA", "PCMU")
+	require.True(t, ok)
+
+	_, ok = codec.Lookup("PCMU", "G729")
+	require.False(t, ok)
+
+	ulaw := []byte{0xFF, 0x80, 0x00, 0x9A, 0x1B}
+	alaw := toALaw(nil, ulaw)
+	require.Len(t, alaw, len(ulaw))
+	require.Equal(t, []byte{0xD5}, alaw[:1], "silence kept as silence")
+
+	// loud samples survive the round trip exactly, quantization only differs near zero
+	back := toULaw(nil, alaw)
+	require.Equal(t, ulaw[1:3], back[1:3])
+}
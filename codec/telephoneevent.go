@@ -0,0 +1,50 @@
+package codec
+
+// RFC 4733 telephone-event packets
+
+const (
+	TelephoneEventClockRate = 8000
+	maxEventDuration        = 0xFFFF // longest duration a single event packet can carry, in timestamp units
+)
+
+// EventPacket is an RFC 4733 packet of an event being sent
+type EventPacket struct {
+	TSOffset uint32 // RTP timestamp of the packet segment, from the event start
+	Duration uint16 // in timestamp units, since TSOffset
+	End      bool   // E bit
+	Marker   bool   // RTP marker bit, set on the first packet of the event
+}
+
+// EventPackets returns the packets of an event lasting durationMS (at least one packet interval), one every packetMS
+// followed by endPackets end of event packets. Events longer than 0xFFFF timestamp units are split into segments,
+// RFC 4733 section 2.5.1.3: the segment last packet carries 0xFFFF and the next segment starts at a new timestamp
+func EventPackets(durationMS, packetMS, endPackets int) []EventPacket {
+	const unitsPerMS = TelephoneEventClockRate / 1000
+	total := max(durationMS, packetMS) * unitsPerMS
+	step := packetMS * unitsPerMS
+
+	var packets []EventPacket
+	segStart := 0
+	add := func(elapsed int, end, marker bool) {
+		for elapsed-segStart > maxEventDuration {
+			packets = append(packets, EventPacket{TSOffset: uint32(segStart), Duration: maxEventDuration})
+			segStart += maxEventDuration
+		}
+		packets = append(packets, EventPacket{TSOffset: uint32(segStart), Duration: uint16(elapsed - segStart), End: end, Marker: marker})
+	}
+
+	for elapsed := min(step, total); ; elapsed = min(elapsed+step, total) {
+		first := len(packets) == 0
+		if elapsed == total && !first {
+			break
+		}
+		add(elapsed, false, first)
+		if elapsed == total {
+			break
+		}
+	}
+	for range endPackets {
+		add(total, true, false)
+	}
+	return packets
+}
@@ -0,0 +1,73 @@
+package codec_test
+
+import (
+	"SRGo/codec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checkEvent verifies the packets of an event: one marker start packet, durations growing within a segment,
+// segments chained at 0xFFFF and end packets carrying the total duration
+func checkEvent(t *testing.T, packets []codec.EventPacket, total int) {
+	t.Helper()
+	require.NotEmpty(t, packets)
+	require.True(t, packets[0].Marker, "start packet")
+	require.False(t, packets[0].End)
+
+	var segStart uint32
+	var last uint16
+	ends := 0
+	for i, p := range packets {
+		require.Equal(t, i == 0, p.Marker, "packet %d", i)
+		if p.TSOffset != segStart {
+			require.Equal(t, uint16(0xFFFF), last, "previous segment full")
+			require.Equal(t, segStart+0xFFFF, p.TSOffset)
+			segStart, last = p.TSOffset, 0
+		}
+		require.GreaterOrEqual(t, p.Duration, last, "packet %d", i)
+		last = p.Duration
+		if p.End {
+			ends++
+			require.Equal(t, total, int(p.TSOffset)+int(p.Duration), "end packet %d", i)
+		} else {
+			require.Zero(t, ends, "no event packet after end packets")
+		}
+	}
+	require.Equal(t, 3, ends)
+}
+
+func TestEventPackets(t *testing.T) {
+	t.Parallel()
+
+	packets := codec.EventPackets(200, 50, 3)
+	checkEvent(t, packets, 1600)
+	require.Len(t, packets, 3+3, "400, 800, 1200 then end packets")
+	require.Equal(t, uint16(400), packets[0].Duration)
+}
+
+func TestEventPacketsShort(t *testing.T) {
+	t.Parallel()
+
+	packets := codec.EventPackets(40, 50, 3)
+	checkEvent(t, packets, 400)
+	require.Len(t, packets, 1+3)
+	require.Equal(t, codec.EventPacket{Duration: 400, Marker: true}, packets[0])
+}
+
+func TestEventPacketsLong(t *testing.T) {
+	t.Parallel()
+
+	// 8150 ms: 65200 units, fits a single segment though the next 400 step would exceed 0xFFFF
+	packets := codec.EventPackets(8150, 50, 3)
+	checkEvent(t, packets, 65200)
+	require.Zero(t, packets[len(packets)-1].TSOffset)
+	require.Len(t, packets, 162+3, "400 to 64800 then end packets")
+
+	// 10000 ms: 80000 units, split into two segments
+	packets = codec.EventPackets(10000, 50, 3)
+	checkEvent(t, packets, 80000)
+	end := packets[len(packets)-1]
+	require.Equal(t, uint32(0xFFFF), end.TSOffset)
+	require.Equal(t, uint16(80000-0xFFFF), end.Duration)
+}
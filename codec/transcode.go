@@ -0,0 +1,72 @@
+package codec
+
+import "strings"
+
+type (
+	// Codec describes an RTP audio codec known to the transcoding engine
+	Codec struct {
+		Name      string
+		ClockRate int
+		Payload   uint8 // static payload type, 0 with Dynamic set otherwise
+		Dynamic   bool
+	}
+
+	// Transcoder converts one RTP payload, appending the result to dst
+	Transcoder func(dst, src []byte) []byte
+
+	transcoderKey struct {
+		from string
+		to   string
+	}
+)
+
+var (
+	PCMU = Codec{Name: "PCMU", ClockRate: G711ClockRate, Payload: PayloadPCMU}
+	PCMA = Codec{Name: "PCMA", ClockRate: G711ClockRate, Payload: PayloadPCMA}
+
+	codecs      = map[string]Codec{}
+	transcoders = map[transcoderKey]Transcoder{}
+)
+
+func init() {
+	Register(PCMU, PCMA, func(dst, src []byte) []byte { return mapBytes(dst, src, &ulawToALaw) })
+	Register(PCMA, PCMU, func(dst, src []byte) []byte { return mapBytes(dst, src, &alawToULaw) })
+}
+
+// Register adds a transcoder between two codecs, to be called at init time
+func Register(from, to Codec, t Transcoder) {
+	codecs[strings.ToUpper(from.Name)] = from
+	codecs[strings.ToUpper(to.Name)] = to
+	transcoders[transcoderKey{strings.ToUpper(from.Name), strings.ToUpper(to.Name)}] = t
+}
+
+// Lookup returns the transcoder converting codec named from to codec named to
+func Lookup(from, to string) (Transcoder, bool) {
+	t, ok := transcoders[transcoderKey{strings.ToUpper(from), strings.ToUpper(to)}]
+	return t, ok
+}
+
+// Get returns a registered codec by name
+func Get(name string) (Codec, bool) {
+	c, ok := codecs[strings.ToUpper(name)]
+	return c, ok
+}
+
+// TranscodableTo returns the registered codecs which the named codec can be transcoded to
+func TranscodableTo(name string) []Codec {
+	var out []Codec
+	from := strings.ToUpper(name)
+	for k := range transcoders {
+		if k.from == from {
+			out = append(out, codecs[k.to])
+		}
+	}
+	return out
+}
+
+func mapBytes(dst, src []byte, table *[256]byte) []byte {
+	for _, b := range src {
+		dst = append(dst, table[b])
+	}
+	return dst
+}
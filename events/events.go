@@ -0,0 +1,148 @@
+// Package events publishes call lifecycle and registration events to live subscribers e.g. the API event stream
+package events
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Type string
+
+const (
+	Invite      Type = "invite"      // inbound call routed
+	Ringing     Type = "ringing"     // first 18x received from the callee
+	Answer      Type = "answer"      // call answered (ACK received)
+	Hold        Type = "hold"        // a party put the call on hold
+	Resume      Type = "resume"      // a party resumed the call
+	Transfer    Type = "transfer"    // REFER received
+	Release     Type = "release"     // call ended
+	Register    Type = "register"    // phone registered or moved to a new contact
+	Unregister  Type = "unregister"  // phone unregistered
+	Unreachable Type = "unreachable" // registered phone stopped answering keepalive probes
+	Reachable   Type = "reachable"   // unreachable phone answered a keepalive probe again
+)
+
+var Types = []Type{Invite, Ringing, Answer, Hold, Resume, Transfer, Release, Register, Unregister, Unreachable, Reachable}
+
+// Event is a call event, identified by the inbound leg Call-ID, or a registration event of Extension
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       Type      `json:"type"`
+	CallID     string    `json:"callId,omitempty"`
+	From       string    `json:"from,omitempty"`
+	To         string    `json:"to,omitempty"`
+	Route      string    `json:"route,omitempty"`
+	Peer       string    `json:"peer,omitempty"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Cause      string    `json:"cause,omitempty"`
+	Party      string    `json:"party,omitempty"` // caller or callee, for hold, resume and transfer
+	ReferTo    string    `json:"referTo,omitempty"`
+	Extension  string    `json:"extension,omitempty"`
+	Contact    string    `json:"contact,omitempty"`
+}
+
+// Filter selects events, empty fields match all
+type Filter struct {
+	Types   []Type
+	Numbers []string // From, To or Extension ending with any of them
+	Routes  []string
+}
+
+func (f *Filter) Matches(e *Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	if len(f.Routes) > 0 && !slices.Contains(f.Routes, e.Route) {
+		return false
+	}
+	if len(f.Numbers) > 0 && !slices.ContainsFunc(f.Numbers, func(n string) bool {
+		return hasSuffix(e.From, n) || hasSuffix(e.To, n) || hasSuffix(e.Extension, n)
+	}) {
+		return false
+	}
+	return true
+}
+
+func hasSuffix(s, suffix string) bool {
+	return s != "" && strings.HasSuffix(s, suffix)
+}
+
+// =================================================================================================
+
+type (
+	// Bus fans events out to its subscribers without ever blocking the publisher
+	Bus struct {
+		subs  map[*Subscription]struct{}
+		count atomic.Int32
+		mu    sync.RWMutex
+	}
+
+	Subscription struct {
+		C       <-chan Event
+		ch      chan Event
+		filter  Filter
+		dropped atomic.Uint64
+	}
+)
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Active is true when there is at least one subscriber, to skip building events nobody receives
+func (b *Bus) Active() bool {
+	return b != nil && b.count.Load() > 0
+}
+
+// Subscribe returns a subscription receiving the events matching the filter, queued up to buffer events
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.count.Store(int32(len(b.subs)))
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe stops and closes the subscription channel
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	b.count.Store(int32(len(b.subs)))
+	close(sub.ch)
+}
+
+// Publish sends the event to the matching subscribers, dropping it for those not keeping up
+func (b *Bus) Publish(e Event) {
+	if !b.Active() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.filter.Matches(&e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped as the subscriber was not keeping up
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,57 @@
+package events_test
+
+import (
+	"SRGo/events"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	t.Parallel()
+
+	var nilBus *events.Bus
+	require.False(t, nilBus.Active())
+	nilBus.Publish(events.Event{Type: events.Invite}) // no-op
+
+	bus := events.NewBus()
+	require.False(t, bus.Active())
+
+	all := bus.Subscribe(events.Filter{}, 1)
+	sub := bus.Subscribe(events.Filter{Types: []events.Type{events.Answer, events.Register}, Numbers: []string{"1234"}}, 10)
+	require.True(t, bus.Active())
+
+	bus.Publish(events.Event{Type: events.Answer, From: "5551234", To: "999", Route: "^9"})
+	bus.Publish(events.Event{Type: events.Answer, From: "5551230", To: "999"})
+	bus.Publish(events.Event{Type: events.Release, From: "5551234"})
+	bus.Publish(events.Event{Type: events.Register, Extension: "1234"})
+
+	e := <-sub.C
+	require.Equal(t, events.Answer, e.Type)
+	require.Equal(t, "5551234", e.From)
+	require.False(t, e.Time.IsZero())
+	e = <-sub.C
+	require.Equal(t, events.Register, e.Type)
+	require.Empty(t, sub.C)
+	require.Zero(t, sub.Dropped())
+
+	require.Len(t, all.C, 1)
+	require.Equal(t, uint64(3), all.Dropped())
+
+	bus.Unsubscribe(all)
+	bus.Unsubscribe(all)
+	<-all.C // buffered before closing
+	_, ok := <-all.C
+	require.False(t, ok)
+	bus.Unsubscribe(sub)
+	require.False(t, bus.Active())
+}
+
+func TestFilterRoutes(t *testing.T) {
+	t.Parallel()
+
+	f := events.Filter{Routes: []string{"^(12355)$"}}
+	require.True(t, f.Matches(&events.Event{Type: events.Invite, Route: "^(12355)$"}))
+	require.False(t, f.Matches(&events.Event{Type: events.Invite, Route: "default"}))
+	require.False(t, f.Matches(&events.Event{Type: events.Register, Extension: "12355"}))
+}
@@ -204,6 +204,7 @@ const (
 	LLInformation LogLevel = iota
 	LLWarning
 	LLError
+	LLDebug
 )
 
 func (ll LogLevel) String() string {
@@ -288,6 +289,10 @@ const (
 	UnknownEndPoint
 )
 
+func (nst NewSessionType) String() string {
+	return newSesTypes[nst]
+}
+
 // ==============================================================
 
 type HeaderEnum int
@@ -0,0 +1,126 @@
+package global
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevelOff disables a log title when set as its level
+const LogLevelOff = slog.Level(16)
+
+var (
+	logger      = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	titleLevels [len(logtitles)]atomic.Int64 // per LogTitle minimum level, slog.LevelInfo (0) by default
+)
+
+// InitLogger sets the log output format - json (default) or text - and routes the standard log package through it
+func InitLogger(format string, w io.Writer) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug} // filtering is done per title
+	if strings.EqualFold(format, "text") {
+		logger = slog.New(slog.NewTextHandler(w, opts))
+	} else {
+		logger = slog.New(slog.NewJSONHandler(w, opts))
+	}
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+}
+
+func (ll LogLevel) slogLevel() slog.Level {
+	switch ll {
+	case LLDebug:
+		return slog.LevelDebug
+	case LLWarning:
+		return slog.LevelWarn
+	case LLError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// LogTitleFromName returns the LogTitle of a name e.g. SIPStack, case-insensitive
+func LogTitleFromName(name string) (LogTitle, bool) {
+	for i, t := range logtitles[:LTWebSocketData+1] {
+		if strings.EqualFold(t, name) {
+			return LogTitle(i), true
+		}
+	}
+	return LTNone, false
+}
+
+// ParseLogLevel accepts DEBUG, INFO, WARN, ERROR and OFF, case-insensitive
+func ParseLogLevel(s string) (slog.Level, bool) {
+	if strings.EqualFold(s, "OFF") {
+		return LogLevelOff, true
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(s)); err != nil {
+		return 0, false
+	}
+	return lvl, true
+}
+
+func LogLevelName(lvl slog.Level) string {
+	if lvl >= LogLevelOff {
+		return "OFF"
+	}
+	return lvl.String()
+}
+
+// SetLogLevel sets the minimum level of a log title, LTAll sets all titles
+func SetLogLevel(lt LogTitle, lvl slog.Level) {
+	if lt == LTAll {
+		for i := range titleLevels {
+			titleLevels[i].Store(int64(lvl))
+		}
+		return
+	}
+	if lt >= 0 && int(lt) < len(titleLevels) {
+		titleLevels[lt].Store(int64(lvl))
+	}
+}
+
+// LogLevels returns the minimum level of each log title
+func LogLevels() map[string]string {
+	levels := make(map[string]string, LTWebSocketData)
+	for i := LTAll + 1; i <= LTWebSocketData; i++ {
+		levels[i.String()] = LogLevelName(slog.Level(titleLevels[i].Load()))
+	}
+	return levels
+}
+
+func LogEnabled(lt LogTitle, ll LogLevel) bool {
+	if lt < 0 || int(lt) >= len(titleLevels) {
+		lt = LTUnspecified
+	}
+	return ll.slogLevel() >= slog.Level(titleLevels[lt].Load())
+}
+
+func LogDebug(lt LogTitle, msg string, args ...any) {
+	LogHandler(LLDebug, lt, msg, args...)
+}
+
+func LogInfo(lt LogTitle, msg string, args ...any) {
+	LogHandler(LLInformation, lt, msg, args...)
+}
+
+func LogWarning(lt LogTitle, msg string, args ...any) {
+	LogHandler(LLWarning, lt, msg, args...)
+}
+
+func LogError(lt LogTitle, msg string, args ...any) {
+	LogHandler(LLError, lt, msg, args...)
+}
+
+// LogHandler logs the message with its title and key-value pairs e.g. "callId", callID
+func LogHandler(ll LogLevel, lt LogTitle, msg string, args ...any) {
+	if !LogEnabled(lt, ll) {
+		return
+	}
+	logger.Log(context.Background(), ll.slogLevel(), msg, append([]any{"title", lt.String()}, args...)...)
+}
@@ -0,0 +1,58 @@
+package global_test
+
+import (
+	"SRGo/global"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevelsPerTitle(t *testing.T) {
+	var buf bytes.Buffer
+	global.InitLogger("json", &buf)
+	defer global.InitLogger("json", os.Stdout)
+	defer global.SetLogLevel(global.LTAll, slog.LevelInfo)
+
+	global.SetLogLevel(global.LTAll, slog.LevelWarn)
+	global.SetLogLevel(global.LTSIPStack, slog.LevelDebug)
+
+	require.False(t, global.LogEnabled(global.LTMediaStack, global.LLInformation))
+	require.True(t, global.LogEnabled(global.LTMediaStack, global.LLError))
+	require.True(t, global.LogEnabled(global.LTSIPStack, global.LLDebug))
+
+	global.LogInfo(global.LTMediaStack, "filtered")
+	global.LogDebug(global.LTSIPStack, "kept", "callId", "abc@host")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "kept", line["msg"])
+	require.Equal(t, "SIPStack", line["title"])
+	require.Equal(t, "abc@host", line["callId"])
+	require.Equal(t, "DEBUG", line["level"])
+
+	levels := global.LogLevels()
+	require.Equal(t, "DEBUG", levels["SIPStack"])
+	require.Equal(t, "WARN", levels["MediaStack"])
+}
+
+func TestParseLogLevel(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "Error": slog.LevelError, "off": global.LogLevelOff} {
+		lvl, ok := global.ParseLogLevel(s)
+		require.True(t, ok, s)
+		require.Equal(t, want, lvl, s)
+	}
+	_, ok := global.ParseLogLevel("verbose")
+	require.False(t, ok)
+
+	lt, ok := global.LogTitleFromName("sipstack")
+	require.True(t, ok)
+	require.Equal(t, global.LTSIPStack, lt)
+	_, ok = global.LogTitleFromName("nothing")
+	require.False(t, ok)
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
 	"math/rand/v2"
 	"net"
 	"os"
@@ -28,10 +27,9 @@ func LogCallStack() bool {
 	if r == nil {
 		return false
 	}
-	log.Printf("Panic Recovered! Error:\n%v", r)
 	buf := make([]byte, 1024)
 	n := runtime.Stack(buf, false)
-	log.Printf("Stack trace:\n%s\n", buf[:n])
+	LogError(LTUnhandledCritical, "Panic recovered", "error", fmt.Sprint(r), "stack", string(buf[:n]))
 	return true
 }
 
@@ -90,7 +88,7 @@ func StartListening(ip net.IP, prt int, dscp int) (*net.UDPConn, error) {
 	}
 
 	if err = ipv4.NewConn(conn).SetTOS(dscp); err != nil {
-		log.Printf("Failed to set IPv4 TOS: %v (may need CAP_NET_ADMIN)", err)
+		LogWarning(LTSystem, "Failed to set IPv4 TOS (may need CAP_NET_ADMIN)", "error", err)
 	}
 
 	return conn, nil
@@ -125,7 +123,7 @@ func BuildUdpAddr(ipsocket string, defaultport int) (*net.UDPAddr, bool) {
 
 	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", part1, prt))
 	if err != nil {
-		log.Printf("Error resolving UDP address [%s]: %v", ipsocket, err)
+		LogError(LTConnectivity, "Error resolving UDP address", "address", ipsocket, "error", err)
 		return nil, false
 	}
 
@@ -725,24 +723,6 @@ func HashSDPBytes(bytes []byte) string {
 
 //===================================================================
 
-func LogInfo(lt LogTitle, msg string) {
-	LogHandler(LLInformation, lt, msg)
-}
-
-func LogWarning(lt LogTitle, msg string) {
-	// LogHandler(LLWarning, lt, msg)
-}
-
-func LogError(lt LogTitle, msg string) {
-	// LogHandler(LLError, lt, msg)
-}
-
-func LogHandler(ll LogLevel, lt LogTitle, msg string) {
-	log.Printf("\t%s\t%s\t%s\n", ll.String(), lt.String(), msg)
-}
-
-//===================================================================
-
 func RMatch(s string, rgxfp FieldPattern) []string {
 	if s == "" {
 		return nil
@@ -9,9 +9,10 @@ import (
 )
 
 type UdpSocket struct {
-	addr     *net.UDPAddr
-	hostOrIP *string
-	port     *int
+	addr         *net.UDPAddr // set for IP literals, hostnames are resolved per use
+	hostOrIP     *string
+	port         *int
+	explicitPort bool
 }
 
 func BuildUdpSocketFromAddr(addr *net.UDPAddr) (*UdpSocket, error) {
@@ -26,9 +27,11 @@ func BuildUdpSocketFromAddr(addr *net.UDPAddr) (*UdpSocket, error) {
 		return nil, fmt.Errorf("invalid port number: %d", port)
 	}
 
-	return &UdpSocket{addr: addr, hostOrIP: &hostOrIP, port: &port}, nil
+	return &UdpSocket{addr: addr, hostOrIP: &hostOrIP, port: &port, explicitPort: true}, nil
 }
 
+// BuildUdpSocket parses host[:port]; IP literals are resolved immediately while hostnames
+// are kept to be resolved per RFC 3263 at call time (see Targets)
 func BuildUdpSocket(ipsocket string, defaultport int) (*UdpSocket, error) {
 	part1, part2, ok := strings.Cut(ipsocket, ":")
 	var prt int
@@ -37,23 +40,52 @@ func BuildUdpSocket(ipsocket string, defaultport int) (*UdpSocket, error) {
 		if prt <= 0 || prt > MaxPort {
 			return nil, fmt.Errorf("invalid port number: %d", prt)
 		}
-		prt = cmp.Or(prt, defaultport)
 	}
 	prt = cmp.Or(prt, defaultport)
 
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", part1, prt))
+	if part1 == "" {
+		return nil, fmt.Errorf("missing host in UDP address %s", ipsocket)
+	}
+
+	skt := &UdpSocket{hostOrIP: &part1, port: &prt, explicitPort: ok}
+	if ip := net.ParseIP(part1); ip != nil {
+		skt.addr = &net.UDPAddr{IP: ip, Port: prt}
+	}
+
+	return skt, nil
+}
+
+// Targets returns the addresses to try in order; a single one for IP literals,
+// otherwise the result of NAPTR/SRV/A resolution of the hostname
+func (us *UdpSocket) Targets() ([]*net.UDPAddr, error) {
+	if us.addr != nil {
+		return []*net.UDPAddr{us.addr}, nil
+	}
+	if us.hostOrIP == nil || us.port == nil {
+		return nil, fmt.Errorf("empty UDP socket")
+	}
+	addrs, err := DNSResolver.ResolveSIP(*us.hostOrIP, *us.port, us.explicitPort)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve UDP address %s: %w", ipsocket, err)
+		return nil, fmt.Errorf("failed to resolve %s: %w", us.String(), err)
 	}
+	return addrs, nil
+}
 
-	return &UdpSocket{addr: addr, hostOrIP: &part1, port: &prt}, nil
+// IsHostname tells whether the socket host is resolved with DNS on use
+func (us *UdpSocket) IsHostname() bool {
+	return us.addr == nil
 }
 
+// UDPAddr returns the address for IP literals or the first resolved target for hostnames
 func (us *UdpSocket) UDPAddr() *net.UDPAddr {
-	if us.addr == nil {
+	if us.addr != nil {
+		return us.addr
+	}
+	addrs, err := us.Targets()
+	if err != nil || len(addrs) == 0 {
 		return nil
 	}
-	return us.addr
+	return addrs[0]
 }
 
 func (us *UdpSocket) String() string {
@@ -100,7 +132,7 @@ func NewSipUdpUserAgent(udpaddr *net.UDPAddr) *SipUdpUserAgent {
 	}
 	skt, err := BuildUdpSocketFromAddr(udpaddr)
 	if err != nil {
-		fmt.Println("Error creating UDP socket:", err)
+		LogError(LTConnectivity, "Error creating UDP socket", "error", err)
 		return nil
 	}
 	return &SipUdpUserAgent{udpSkt: skt}
@@ -124,10 +156,9 @@ func (ua *SipUdpUserAgent) GetUDPSocket() *UdpSocket {
 	return ua.udpSkt
 }
 
+// GetUDPAddr returns the UA address, a hostname being resolved out of the UA lock
 func (ua *SipUdpUserAgent) GetUDPAddr() *net.UDPAddr {
-	ua.mu.RLock()
-	defer ua.mu.RUnlock()
-	return ua.udpSkt.addr
+	return ua.GetUDPSocket().UDPAddr()
 }
 
 func (ua *SipUdpUserAgent) SetUDPAddr(udpAddr *net.UDPAddr) {
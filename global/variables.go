@@ -3,9 +3,14 @@ package global
 import (
 	"regexp"
 	"sync"
+	"time"
 
 	"SRGo/cl"
+	"SRGo/events"
+	"SRGo/guard"
+	"SRGo/hep"
 	"SRGo/prometheus"
+	"SRGo/resolver"
 )
 
 const (
@@ -16,8 +21,8 @@ const (
 	RTPHeaderSize  int = 12
 	RTPPayloadSize int = 160
 	RTPMaxSize     int = 1500
-	MediaStartPort int = 7000
-	MediaEndPort   int = 57000
+
+	MediaQuarantineSec = 8 // seconds a released media port pair is kept out of the pool
 
 	ntpEpochOffset uint64 = 2208988800
 
@@ -28,6 +33,7 @@ const (
 	CancelTimeOut              = 10 // seconds
 	ReTXCount                  = 5
 	SipPort                    = 5060
+	HEPPort                    = 9060 // Homer collector default
 	MaxPort                    = 65535
 	MultipartBoundary   string = "unique-boundary-1"
 	SipVersion          string = "SIP/2.0"
@@ -45,8 +51,25 @@ var (
 	SipUdpPort  int // TODO add a list of listening UDP ports if needed later, for now, it is a single port
 	HttpTcpPort int
 
+	HttpBindIP      string   // management API IP, SIP IP when empty
+	HttpTLSCertFile string   // management API served over HTTPS when set
+	HttpTLSKeyFile  string   // private key of HttpTLSCertFile
+	APIAdminKeys    []string // API keys allowed to call every endpoint
+	APIReadOnlyKeys []string // API keys allowed to GET only; API open to all when no key is set
+
 	RateLimit = 1500 // TODO 2000 || 0 = switched off, -1 = unlimited, > 0 = limited
 
+	FloodConfig = guard.DefaultConfig() // per source IP flood, rejected requests and scanner protection
+
+	MediaStartPort = 7000  // first RTP port (even) of the media pool
+	MediaEndPort   = 57000 // last port of the media pool (RTCP included)
+
+	RecordingsDir = "recordings" // call recordings folder, files named after the inbound Call-ID
+
+	LadderMaxMessages  = 200  // SIP messages kept per call for the trace API, oldest overwritten
+	LadderRetentionSec = 300  // seconds a call trace is kept after the call is dropped
+	LadderMaxRetained  = 1000 // call traces kept after the call is dropped, oldest evicted
+
 	BufferPool      *sync.Pool
 	RTPRXBufferPool *sync.Pool
 	RTPBuffer       *sync.Pool
@@ -54,6 +77,10 @@ var (
 
 	Prometrics  *prometheus.Metrics
 	CallLimiter *cl.CallLimiter
+	FloodGuard  *guard.Guard
+	HEPTracer   *hep.Tracer // nil when no HEP collector is set
+	EventBus    = events.NewBus()
+	DNSResolver = resolver.New(resolver.SystemServers(), 2*time.Second) // for ENUM and SIP URIs resolution
 	WtGrp       sync.WaitGroup
 )
 
@@ -68,7 +95,8 @@ var (
 	timeFormats  = [...]string{"Signaling", "Tracing", "version", "DateOnly", "TimeOnly", "DateTimeOnly", "Session", "HTML", "DateTimeLocal", "JsonDateTime", "HTMLDateOnly", "yyyy_MM_dd", "SimpleDT"}
 	csModes      = [...]string{"CallRecording", "CallSummary", "CallTracing"}
 	logtitles    = [...]string{"All", "AnswerMachine", "BadSIPMessage", "ChatMessage", "ConfigFiles", "Configuration", "Connectivity", "ContactCenter", "CustomCommand", "CustomCommandResult", "DTMF", "EmailNotification", "ExternalData", "FileUpload", "Webserver", "IPCollection", "License", "LogInOut", "MediaCapability", "MediaStack", "NAT", "PESQScore", "ResourceLimitation", "RTDGrabber", "Security", "SDPStack", "SIPStack", "SNMP", "StirShaken", "StressTester", "System", "TLSStack", "TTS", "UnhandledCritical", "Unspecified", "WebSocketData", "None"}
-	loglevels    = [...]string{"Information", "Warning", "Error"}
+	loglevels    = [...]string{"Information", "Warning", "Error", "Debug"}
+	newSesTypes  = [...]string{"Unset", "ValidRequest", "DuplicateRequest", "InvalidRequest", "UnsupportedURIScheme", "UnsupportedBody", "ForbiddenRequest", "WithRequireHeader", "Response", "UnExpectedMessage", "NoAllowedAudioCodecs", "TooLowMaxForwards", "RegistrarOff", "ServerOff", "EndpointNotRegistered", "ExceededRouteCAC", "DisposedSession", "CallLegTransactionNotExist", "RouteBlocked", "UCLimitReached", "DuplicateMessage", "RouteOutboundOnly", "RouteBlackhole", "ExceededCallRate", "UnknownEndPoint"}
 	UriSchemes   = [...]string{"sip", "sips", "tel"}
 	// =================================================================
 	// Time Formats
@@ -0,0 +1,250 @@
+package guard
+
+import (
+	"cmp"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"SRGo/prometheus"
+)
+
+type (
+	Config struct {
+		MaxRequestsPerSec int           // per source IP, 0 = unlimited
+		MaxRejected       int           // rejected requests per source IP within RejectedWindow, 0 = unlimited
+		RejectedWindow    time.Duration //
+		BanDuration       time.Duration // of automatic bans
+		ScannerUAs        []string      // User-Agent product names of scanners, case insensitive
+	}
+
+	// Ban of a source IP; Until is zero for permanent bans
+	Ban struct {
+		Since  time.Time `json:"since"`
+		Until  time.Time `json:"until,omitzero"`
+		IP     string    `json:"ip"`
+		Reason string    `json:"reason"`
+	}
+
+	// Guard bans source IPs flooding requests, sending repeatedly rejected requests or identified as scanners
+	Guard struct {
+		pm      *prometheus.Metrics
+		bans    map[string]*Ban
+		sources map[string]*source
+		cfg     Config
+		mu      sync.Mutex
+	}
+
+	source struct {
+		windowStart time.Time // of the current one second rate window
+		rejectStart time.Time // of the current rejected requests window
+		requests    int
+		rejected    int
+	}
+)
+
+// ban and drop reasons
+const (
+	ReasonBanned   = "banned"
+	ReasonRate     = "rate"
+	ReasonScanner  = "scanner"
+	ReasonRejected = "rejected"
+	ReasonManual   = "manual"
+)
+
+const sweepInterval = 10 * time.Second
+
+func DefaultConfig() Config {
+	return Config{
+		MaxRejected:    10,
+		RejectedWindow: time.Minute,
+		BanDuration:    10 * time.Minute,
+		ScannerUAs:     []string{"friendly-scanner", "sipvicious", "sipcli", "sip-scan", "sipscan", "sundayddr", "iwar", "vaxsipuseragent", "pplsip", "smap"},
+	}
+}
+
+func New(cfg Config, pm *prometheus.Metrics, wg *sync.WaitGroup) *Guard {
+	uas := make([]string, 0, len(cfg.ScannerUAs))
+	for _, ua := range cfg.ScannerUAs {
+		if ua = strings.ToLower(strings.TrimSpace(ua)); ua != "" {
+			uas = append(uas, ua)
+		}
+	}
+	cfg.ScannerUAs = uas
+	g := &Guard{
+		pm:      pm,
+		bans:    make(map[string]*Ban),
+		sources: make(map[string]*source),
+		cfg:     cfg,
+	}
+	wg.Add(1)
+	go g.sweep(wg)
+	return g
+}
+
+// sweep drops expired bans and idle sources periodically
+func (g *Guard) sweep(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for now := range time.Tick(sweepInterval) {
+		g.mu.Lock()
+		for ip, b := range g.bans {
+			if b.expired(now) {
+				delete(g.bans, ip)
+			}
+		}
+		for ip, s := range g.sources {
+			if now.Sub(s.windowStart) > sweepInterval && now.Sub(s.rejectStart) > g.cfg.RejectedWindow {
+				delete(g.sources, ip)
+			}
+		}
+		g.pm.BannedIPs.Set(float64(len(g.bans)))
+		g.mu.Unlock()
+	}
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return !b.Until.IsZero() && now.After(b.Until)
+}
+
+// IsBanned tells whether packets from ip are to be dropped
+func (g *Guard) IsBanned(ip net.IP) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.bans[ip.String()]
+	return ok && !b.expired(time.Now())
+}
+
+// Request accounts for a request received from ip, returning the reason it is to be dropped or "" if accepted;
+// exceeding the request rate or sending a scanner User-Agent bans ip. banned is true when ip just got banned
+func (g *Guard) Request(ip net.IP, userAgent string) (reason string, banned bool) {
+	if g == nil {
+		return "", false
+	}
+	now := time.Now()
+	key := ip.String()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b, ok := g.bans[key]; ok && !b.expired(now) {
+		return ReasonBanned, false
+	}
+	if g.isScanner(userAgent) {
+		g.ban(key, ReasonScanner, g.cfg.BanDuration, now)
+		return ReasonScanner, true
+	}
+	if g.cfg.MaxRequestsPerSec <= 0 {
+		return "", false
+	}
+	s := g.source(key)
+	if now.Sub(s.windowStart) >= time.Second {
+		s.windowStart, s.requests = now, 0
+	}
+	if s.requests++; s.requests > g.cfg.MaxRequestsPerSec {
+		g.ban(key, ReasonRate, g.cfg.BanDuration, now)
+		return ReasonRate, true
+	}
+	return "", false
+}
+
+// Rejected accounts for a request of ip refused e.g. by the ACL, returning true when ip just got banned
+func (g *Guard) Rejected(ip net.IP) bool {
+	if g == nil || g.cfg.MaxRejected <= 0 {
+		return false
+	}
+	now := time.Now()
+	key := ip.String()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b, ok := g.bans[key]; ok && !b.expired(now) {
+		return false
+	}
+	s := g.source(key)
+	if now.Sub(s.rejectStart) > g.cfg.RejectedWindow {
+		s.rejectStart, s.rejected = now, 0
+	}
+	if s.rejected++; s.rejected >= g.cfg.MaxRejected {
+		g.ban(key, ReasonRejected, g.cfg.BanDuration, now)
+		return true
+	}
+	return false
+}
+
+// isScanner tells whether a product of the User-Agent (e.g. "sipcli/v1.8") is a scanner name.
+// Whole product names are compared so that e.g. "sipcli" does not match a "SIPClient" phone
+func (g *Guard) isScanner(userAgent string) bool {
+	if userAgent == "" || len(g.cfg.ScannerUAs) == 0 {
+		return false
+	}
+	products := strings.FieldsFunc(strings.ToLower(userAgent), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("/();,", r)
+	})
+	return slices.ContainsFunc(products, func(p string) bool { return slices.Contains(g.cfg.ScannerUAs, p) })
+}
+
+func (g *Guard) source(key string) *source {
+	s, ok := g.sources[key]
+	if !ok {
+		s = &source{}
+		g.sources[key] = s
+	}
+	return s
+}
+
+func (g *Guard) ban(key, reason string, d time.Duration, now time.Time) *Ban {
+	b := &Ban{IP: key, Reason: reason, Since: now}
+	if d > 0 {
+		b.Until = now.Add(d)
+	}
+	g.bans[key] = b
+	delete(g.sources, key)
+	g.pm.IPBans.WithLabelValues(reason).Inc()
+	g.pm.BannedIPs.Set(float64(len(g.bans)))
+	return b
+}
+
+// Ban bans ip for d, permanently if d is 0 or the configured ban duration if negative, replacing any existing ban
+func (g *Guard) Ban(ip net.IP, reason string, d time.Duration) Ban {
+	if d < 0 {
+		d = g.cfg.BanDuration
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return *g.ban(ip.String(), cmp.Or(reason, ReasonManual), d, time.Now())
+}
+
+// Unban lifts the ban of ip, returning false if it was not banned
+func (g *Guard) Unban(ip net.IP) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := ip.String()
+	if _, ok := g.bans[key]; !ok {
+		return false
+	}
+	delete(g.bans, key)
+	g.pm.BannedIPs.Set(float64(len(g.bans)))
+	return true
+}
+
+// Bans returns the active bans, oldest first
+func (g *Guard) Bans() []Ban {
+	now := time.Now()
+	g.mu.Lock()
+	lst := make([]Ban, 0, len(g.bans))
+	for _, b := range g.bans {
+		if !b.expired(now) {
+			lst = append(lst, *b)
+		}
+	}
+	g.mu.Unlock()
+	slices.SortFunc(lst, func(a, b Ban) int { return cmp.Or(a.Since.Compare(b.Since), cmp.Compare(a.IP, b.IP)) })
+	return lst
+}
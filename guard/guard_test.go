@@ -0,0 +1,115 @@
+package guard_test
+
+import (
+	"SRGo/guard"
+	"SRGo/prometheus"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newGuard(cfg guard.Config) *guard.Guard {
+	var wg sync.WaitGroup
+	return guard.New(cfg, prometheus.NewMetrics("test"), &wg)
+}
+
+func TestRequestRate(t *testing.T) {
+	t.Parallel()
+
+	cfg := guard.DefaultConfig()
+	cfg.MaxRequestsPerSec = 3
+	g := newGuard(cfg)
+	ip, other := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+
+	for range 3 {
+		reason, banned := g.Request(ip, "Linphone/5.2")
+		require.Empty(t, reason)
+		require.False(t, banned)
+	}
+	reason, banned := g.Request(ip, "Linphone/5.2")
+	require.Equal(t, guard.ReasonRate, reason)
+	require.True(t, banned)
+	require.True(t, g.IsBanned(ip))
+
+	reason, banned = g.Request(ip, "Linphone/5.2")
+	require.Equal(t, guard.ReasonBanned, reason)
+	require.False(t, banned, "already banned")
+
+	reason, _ = g.Request(other, "")
+	require.Empty(t, reason, "rates are per source IP")
+}
+
+func TestScanner(t *testing.T) {
+	t.Parallel()
+
+	g := newGuard(guard.DefaultConfig())
+	ip := net.ParseIP("198.51.100.9")
+
+	reason, banned := g.Request(ip, "Friendly-Scanner")
+	require.Equal(t, guard.ReasonScanner, reason)
+	require.True(t, banned)
+
+	bans := g.Bans()
+	require.Len(t, bans, 1)
+	require.Equal(t, "198.51.100.9", bans[0].IP)
+	require.Equal(t, guard.ReasonScanner, bans[0].Reason)
+	require.WithinDuration(t, bans[0].Since.Add(10*time.Minute), bans[0].Until, time.Second)
+
+	reason, _ = g.Request(net.ParseIP("198.51.100.10"), "sipvicious 0.3")
+	require.Equal(t, guard.ReasonScanner, reason)
+	reason, _ = g.Request(net.ParseIP("198.51.100.11"), "sipcli/v1.8")
+	require.Equal(t, guard.ReasonScanner, reason)
+
+	for _, ua := range []string{"SIPClient/2.1", "Linphone/5.2 (belle-sip/5.2)", "Smapper 1.0"} {
+		reason, _ = g.Request(net.ParseIP("198.51.100.12"), ua)
+		require.Empty(t, reason, ua)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	t.Parallel()
+
+	cfg := guard.DefaultConfig()
+	cfg.MaxRejected = 3
+	g := newGuard(cfg)
+	ip := net.ParseIP("2001:db8::1")
+
+	require.False(t, g.Rejected(ip))
+	require.False(t, g.Rejected(ip))
+	require.True(t, g.Rejected(ip))
+	require.True(t, g.IsBanned(ip))
+	require.Equal(t, guard.ReasonRejected, g.Bans()[0].Reason)
+}
+
+func TestManualBan(t *testing.T) {
+	t.Parallel()
+
+	g := newGuard(guard.DefaultConfig())
+	ip := net.ParseIP("203.0.113.4")
+
+	ban := g.Ban(ip, "", 0)
+	require.Equal(t, guard.ReasonManual, ban.Reason)
+	require.True(t, ban.Until.IsZero(), "0 is a permanent ban")
+	require.True(t, g.IsBanned(ip))
+
+	ban = g.Ban(ip, "abuse", -1)
+	require.Equal(t, "abuse", ban.Reason)
+	require.False(t, ban.Until.IsZero(), "negative is the configured duration")
+	require.Len(t, g.Bans(), 1)
+
+	g.Ban(ip, "", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	require.False(t, g.IsBanned(ip), "expired ban")
+	require.Empty(t, g.Bans())
+
+	require.True(t, g.Unban(ip))
+	require.False(t, g.Unban(ip))
+
+	var nilGuard *guard.Guard
+	require.False(t, nilGuard.IsBanned(ip))
+	reason, _ := nilGuard.Request(ip, "friendly-scanner")
+	require.Empty(t, reason)
+}
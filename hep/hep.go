@@ -0,0 +1,88 @@
+package hep
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// HEPv3 chunk types (generic vendor)
+const (
+	chunkIPFamily      uint16 = 0x0001
+	chunkIPProtocol    uint16 = 0x0002
+	chunkIPv4Src       uint16 = 0x0003
+	chunkIPv4Dst       uint16 = 0x0004
+	chunkIPv6Src       uint16 = 0x0005
+	chunkIPv6Dst       uint16 = 0x0006
+	chunkSrcPort       uint16 = 0x0007
+	chunkDstPort       uint16 = 0x0008
+	chunkTimestampSec  uint16 = 0x0009
+	chunkTimestampUsec uint16 = 0x000a
+	chunkProtocolType  uint16 = 0x000b
+	chunkCaptureID     uint16 = 0x000c
+	chunkAuthKey       uint16 = 0x000e
+	chunkPayload       uint16 = 0x000f
+	chunkCorrelationID uint16 = 0x0011
+
+	familyIPv4   = 2
+	familyIPv6   = 10
+	protocolUDP  = 17
+	protocolSIP  = 1
+	chunkHdrLen  = 6
+	headerLength = 6
+)
+
+// Packet is a captured SIP message with its 5-tuple
+type Packet struct {
+	Timestamp     time.Time
+	Src           *net.UDPAddr
+	Dst           *net.UDPAddr
+	CorrelationID string // Call-ID
+	Payload       []byte
+}
+
+// Encode builds the HEPv3 frame of the packet
+func Encode(p *Packet, captureID uint32, authKey string) []byte {
+	b := make([]byte, headerLength, headerLength+128+len(p.Payload)+len(p.CorrelationID))
+	copy(b, "HEP3")
+
+	srcIP, dstIP := p.Src.IP.To4(), p.Dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		b = appendUint8(b, chunkIPFamily, familyIPv4)
+		b = appendUint8(b, chunkIPProtocol, protocolUDP)
+		b = appendChunk(b, chunkIPv4Src, srcIP)
+		b = appendChunk(b, chunkIPv4Dst, dstIP)
+	} else {
+		b = appendUint8(b, chunkIPFamily, familyIPv6)
+		b = appendUint8(b, chunkIPProtocol, protocolUDP)
+		b = appendChunk(b, chunkIPv6Src, p.Src.IP.To16())
+		b = appendChunk(b, chunkIPv6Dst, p.Dst.IP.To16())
+	}
+	b = appendChunk(b, chunkSrcPort, binary.BigEndian.AppendUint16(nil, uint16(p.Src.Port)))
+	b = appendChunk(b, chunkDstPort, binary.BigEndian.AppendUint16(nil, uint16(p.Dst.Port)))
+	b = appendChunk(b, chunkTimestampSec, binary.BigEndian.AppendUint32(nil, uint32(p.Timestamp.Unix())))
+	b = appendChunk(b, chunkTimestampUsec, binary.BigEndian.AppendUint32(nil, uint32(p.Timestamp.Nanosecond()/1000)))
+	b = appendUint8(b, chunkProtocolType, protocolSIP)
+	b = appendChunk(b, chunkCaptureID, binary.BigEndian.AppendUint32(nil, captureID))
+	if authKey != "" {
+		b = appendChunk(b, chunkAuthKey, []byte(authKey))
+	}
+	if p.CorrelationID != "" {
+		b = appendChunk(b, chunkCorrelationID, []byte(p.CorrelationID))
+	}
+	b = appendChunk(b, chunkPayload, p.Payload)
+
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(b)))
+	return b
+}
+
+func appendChunk(b []byte, typ uint16, value []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, 0) // generic vendor
+	b = binary.BigEndian.AppendUint16(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(chunkHdrLen+len(value)))
+	return append(b, value...)
+}
+
+func appendUint8(b []byte, typ uint16, value uint8) []byte {
+	return appendChunk(b, typ, []byte{value})
+}
@@ -0,0 +1,92 @@
+package hep_test
+
+import (
+	"SRGo/hep"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decodeChunks(t *testing.T, b []byte) map[uint16][]byte {
+	t.Helper()
+	require.Equal(t, "HEP3", string(b[:4]))
+	require.Equal(t, len(b), int(binary.BigEndian.Uint16(b[4:6])))
+	chunks := make(map[uint16][]byte)
+	for b = b[6:]; len(b) > 0; {
+		require.GreaterOrEqual(t, len(b), 6)
+		typ := binary.BigEndian.Uint16(b[2:4])
+		size := int(binary.BigEndian.Uint16(b[4:6]))
+		require.GreaterOrEqual(t, len(b), size)
+		chunks[typ] = b[6:size]
+		b = b[size:]
+	}
+	return chunks
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Unix(1700000000, 123456000)
+	p := &hep.Packet{
+		Timestamp:     ts,
+		Src:           &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5060},
+		Dst:           &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5070},
+		CorrelationID: "abc@host",
+		Payload:       []byte("OPTIONS sip:x SIP/2.0\r\n\r\n"),
+	}
+	chunks := decodeChunks(t, hep.Encode(p, 2001, "secret"))
+
+	require.Equal(t, []byte{2}, chunks[0x0001])
+	require.Equal(t, []byte{17}, chunks[0x0002])
+	require.Equal(t, []byte{10, 0, 0, 1}, chunks[0x0003])
+	require.Equal(t, []byte{10, 0, 0, 2}, chunks[0x0004])
+	require.Equal(t, uint16(5060), binary.BigEndian.Uint16(chunks[0x0007]))
+	require.Equal(t, uint16(5070), binary.BigEndian.Uint16(chunks[0x0008]))
+	require.Equal(t, uint32(1700000000), binary.BigEndian.Uint32(chunks[0x0009]))
+	require.Equal(t, uint32(123456), binary.BigEndian.Uint32(chunks[0x000a]))
+	require.Equal(t, []byte{1}, chunks[0x000b])
+	require.Equal(t, uint32(2001), binary.BigEndian.Uint32(chunks[0x000c]))
+	require.Equal(t, "secret", string(chunks[0x000e]))
+	require.Equal(t, "abc@host", string(chunks[0x0011]))
+	require.Equal(t, p.Payload, chunks[0x000f])
+}
+
+func TestFilterMatches(t *testing.T) {
+	t.Parallel()
+
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5060}
+	dst := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5060}
+
+	var none hep.Filter
+	require.True(t, none.Matches("any", nil, src, dst))
+
+	f := hep.Filter{CallIDs: []string{"abc"}, Numbers: []string{"1234"}, IPs: []net.IP{net.ParseIP("10.0.0.2")}}
+	require.True(t, f.Matches("abc", nil, nil, nil))
+	require.True(t, f.Matches("x", []string{"", "+201001234"}, nil, nil))
+	require.True(t, f.Matches("x", nil, src, dst))
+	require.False(t, f.Matches("x", []string{"5555"}, src, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3)}))
+}
+
+func TestTracerExports(t *testing.T) {
+	t.Parallel()
+
+	collector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer collector.Close()
+
+	tracer, err := hep.NewTracer(collector.LocalAddr().(*net.UDPAddr), 1, "", hep.Filter{CallIDs: []string{"keep"}})
+	require.NoError(t, err)
+
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5060}
+	tracer.Trace(&hep.Packet{Timestamp: time.Now(), Src: src, Dst: src, CorrelationID: "skip", Payload: []byte("1")})
+	tracer.Trace(&hep.Packet{Timestamp: time.Now(), Src: src, Dst: src, CorrelationID: "keep", Payload: []byte("2")})
+
+	buf := make([]byte, 1500)
+	_ = collector.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := collector.ReadFromUDP(buf)
+	require.NoError(t, err)
+	require.Equal(t, "keep", string(decodeChunks(t, buf[:n])[0x0011]))
+}
@@ -0,0 +1,95 @@
+package hep
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+const queueSize = 4096
+
+type (
+	// Filter selects the messages exported, a message matches when any of the set criteria matches - none set exports all
+	Filter struct {
+		CallIDs []string
+		Numbers []string // matched against the R-URI, From and To userparts
+		IPs     []net.IP // matched against source and destination
+	}
+
+	// Tracer exports SIP messages to a HEPv3 collector over UDP, without blocking the SIP stack
+	Tracer struct {
+		conn      *net.UDPConn
+		queue     chan []byte
+		filter    atomic.Pointer[Filter]
+		authKey   string
+		dropped   atomic.Uint64
+		captureID uint32
+	}
+)
+
+func NewTracer(collector *net.UDPAddr, captureID uint32, authKey string, filter Filter) (*Tracer, error) {
+	conn, err := net.DialUDP("udp", nil, collector)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracer{conn: conn, queue: make(chan []byte, queueSize), captureID: captureID, authKey: authKey}
+	t.SetFilter(filter)
+	go t.run()
+	return t, nil
+}
+
+func (t *Tracer) run() {
+	for frame := range t.queue {
+		_, _ = t.conn.Write(frame)
+	}
+}
+
+func (t *Tracer) SetFilter(f Filter) {
+	t.filter.Store(&f)
+}
+
+func (t *Tracer) Filter() Filter {
+	return *t.filter.Load()
+}
+
+// Dropped returns the number of messages not exported as the queue was full
+func (t *Tracer) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+// Matches tells whether a message of the Call-ID, numbers and 5-tuple passes the filter
+func (f *Filter) Matches(callID string, numbers []string, src, dst *net.UDPAddr) bool {
+	if len(f.CallIDs) == 0 && len(f.Numbers) == 0 && len(f.IPs) == 0 {
+		return true
+	}
+	if slices.Contains(f.CallIDs, callID) {
+		return true
+	}
+	for _, n := range numbers {
+		if n == "" {
+			continue
+		}
+		if slices.ContainsFunc(f.Numbers, func(fn string) bool { return strings.HasSuffix(n, fn) }) {
+			return true
+		}
+	}
+	return slices.ContainsFunc(f.IPs, func(ip net.IP) bool {
+		return (src != nil && ip.Equal(src.IP)) || (dst != nil && ip.Equal(dst.IP))
+	})
+}
+
+// Trace exports the message if it passes the filter; nil tracer is a no-op
+func (t *Tracer) Trace(p *Packet, numbers ...string) {
+	if t == nil || p.Src == nil || p.Dst == nil {
+		return
+	}
+	if !t.filter.Load().Matches(p.CorrelationID, numbers, p.Src, p.Dst) {
+		return
+	}
+	select {
+	case t.queue <- Encode(p, t.captureID, t.authKey):
+	default:
+		t.dropped.Add(1)
+	}
+}
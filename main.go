@@ -1,13 +1,23 @@
 package main
 
 import (
+	"SRGo/acl"
 	"SRGo/global"
+	"SRGo/hep"
 	"SRGo/prometheus"
+	"SRGo/resolver"
 	"SRGo/sip"
+	"SRGo/webhooks"
 	"SRGo/webserver"
+	"context"
 	"fmt"
-	"log"
+	"math"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // environment variables
@@ -18,19 +28,60 @@ const (
 	Own_IP_IPv4         string = "server_ipv4"
 	Own_SIP_UdpPort     string = "sip_udp_port"
 	Own_Http_Port       string = "http_port"
+	Http_BindIP         string = "http_bind_ip"
+	Http_TLSCert        string = "http_tls_cert"
+	Http_TLSKey         string = "http_tls_key"
+	API_AdminKeys       string = "api_admin_keys"
+	API_ReadOnlyKeys    string = "api_readonly_keys"
+	Webhooks_File       string = "webhooks_file"
+	Shutdown_Timeout    string = "shutdown_timeout_sec"
+	Trunks_File         string = "trunks_file"
+	ACL_File            string = "acl_file"
+	Flood_MaxRPS        string = "flood_max_rps"
+	Flood_MaxRejected   string = "flood_max_rejected"
+	Flood_RejectWindow  string = "flood_rejected_window_sec"
+	Flood_BanDuration   string = "flood_ban_sec"
+	Flood_ScannerUAs    string = "flood_scanner_uas"
+	RoutingServer_URL   string = "routing_server_url"
+	RoutingServer_TO    string = "routing_server_timeout_ms"
+	RoutingServer_Cache string = "routing_server_cache_sec"
+	DNS_Servers         string = "dns_servers"
+	DNS_Timeout         string = "dns_timeout_ms"
 	KeepAlive_Interval  string = "ka_interval"
 	AutoServerIPv4      string = "auto_server_ipv4"
 	InDialogue_Interval string = "indialogue_interval"
 	ProxyUdpServer      string = "proxy_udp_server"
+	Media_StartPort     string = "media_start_port"
+	Media_EndPort       string = "media_end_port"
+	Recording_Dir       string = "recording_dir"
+	Trace_MaxMessages   string = "trace_max_messages"
+	Trace_Retention     string = "trace_retention"
+	Trace_MaxCalls      string = "trace_max_calls"
+	Log_Format          string = "log_format"
+	Log_Level           string = "log_level"
+	HEP_Collector       string = "hep_collector"
+	HEP_CaptureID       string = "hep_capture_id"
+	HEP_AuthKey         string = "hep_auth_key"
+	HEP_FilterCallID    string = "hep_filter_callid"
+	HEP_FilterNumber    string = "hep_filter_number"
+	HEP_FilterIP        string = "hep_filter_ip"
 )
 
 func main() {
+	initLogging()
 	greeting()
 
 	global.Prometrics = prometheus.NewMetrics(global.B2BUANameVersion)
+	initHEP()
+	initACL()
+	initFlood()
 	conn := sip.StartServer(checkArgs())
+	initAPI()
+	dispatcher := initWebhooks()
+	initTrunks(conn)
 
 	defer conn.Close() // close SIP server connection
+	go awaitShutdown(conn, dispatcher)
 
 	webserver.StartWS()
 	global.WtGrp.Wait()
@@ -40,6 +91,176 @@ func greeting() {
 	global.LogInfo(global.LTSystem, fmt.Sprintf("Welcome to %s - Product of %s 2025", global.B2BUANameVersion, global.ASCIIPascal(global.EntityName)))
 }
 
+func initLogging() {
+	global.InitLogger(os.Getenv(Log_Format), os.Stdout)
+	if lvl, ok := os.LookupEnv(Log_Level); ok {
+		if level, ok := global.ParseLogLevel(lvl); ok {
+			global.SetLogLevel(global.LTAll, level)
+		} else {
+			global.LogWarning(global.LTConfiguration, "Bad log level - Ignored", "level", lvl)
+		}
+	}
+}
+
+func initHEP() {
+	collector, ok := os.LookupEnv(HEP_Collector)
+	if !ok || collector == "" {
+		return
+	}
+	addr, ok := global.BuildUdpAddr(collector, global.HEPPort)
+	if !ok {
+		global.LogWarning(global.LTConfiguration, "Bad HEP collector - SIP tracing disabled", "collector", collector)
+		return
+	}
+	//nolint:mnd
+	captureID, _ := global.Str2IntDefaultMinMax(os.Getenv(HEP_CaptureID), 2001, 0, math.MaxInt32)
+
+	filter := hep.Filter{
+		CallIDs: splitList(os.Getenv(HEP_FilterCallID)),
+		Numbers: splitList(os.Getenv(HEP_FilterNumber)),
+	}
+	for _, s := range splitList(os.Getenv(HEP_FilterIP)) {
+		if ip := net.ParseIP(s); ip != nil {
+			filter.IPs = append(filter.IPs, ip)
+		} else {
+			global.LogWarning(global.LTConfiguration, "Bad HEP filter IP - Ignored", "ip", s)
+		}
+	}
+
+	tracer, err := hep.NewTracer(addr, uint32(captureID), os.Getenv(HEP_AuthKey), filter)
+	if err != nil {
+		global.LogWarning(global.LTConfiguration, "Unable to reach HEP collector - SIP tracing disabled", "collector", collector, "error", err)
+		return
+	}
+	global.HEPTracer = tracer
+	global.LogInfo(global.LTConfiguration, "SIP tracing to HEP collector", "collector", addr.String(), "captureId", captureID)
+}
+
+func initAPI() {
+	if ip := os.Getenv(Http_BindIP); ip != "" {
+		if net.ParseIP(ip) == nil {
+			global.LogError(global.LTConfiguration, "Bad HTTP bind IP", "ip", ip)
+			os.Exit(1)
+		}
+		global.HttpBindIP = ip
+	}
+
+	global.HttpTLSCertFile, global.HttpTLSKeyFile = os.Getenv(Http_TLSCert), os.Getenv(Http_TLSKey)
+	if (global.HttpTLSCertFile == "") != (global.HttpTLSKeyFile == "") {
+		global.LogError(global.LTConfiguration, "Both HTTP TLS certificate and key files are required")
+		os.Exit(1)
+	}
+
+	global.APIAdminKeys = splitList(os.Getenv(API_AdminKeys))
+	global.APIReadOnlyKeys = splitList(os.Getenv(API_ReadOnlyKeys))
+	global.LogInfo(global.LTConfiguration, "API keys", "admin", len(global.APIAdminKeys), "readonly", len(global.APIReadOnlyKeys))
+}
+
+func initACL() {
+	path := os.Getenv(ACL_File)
+	if path == "" {
+		return
+	}
+	a, err := acl.Load(path)
+	if err != nil {
+		global.LogError(global.LTConfigFiles, "Error reading ACL", "file", path, "error", err)
+		os.Exit(1)
+	}
+	if err := sip.SetACL(a); err != nil {
+		global.LogError(global.LTConfigFiles, "Error reading ACL", "file", path, "error", err)
+		os.Exit(1)
+	}
+	global.LogInfo(global.LTConfiguration, "ACL loaded", "file", path)
+}
+
+func initFlood() {
+	cfg := &global.FloodConfig
+	//nolint:mnd
+	cfg.MaxRequestsPerSec, _ = global.Str2IntDefaultMinMax(os.Getenv(Flood_MaxRPS), 0, 0, 100000)
+	//nolint:mnd
+	cfg.MaxRejected, _ = global.Str2IntDefaultMinMax(os.Getenv(Flood_MaxRejected), cfg.MaxRejected, 0, 10000)
+	//nolint:mnd
+	window, _ := global.Str2IntDefaultMinMax(os.Getenv(Flood_RejectWindow), int(cfg.RejectedWindow/time.Second), 1, 86400)
+	cfg.RejectedWindow = time.Duration(window) * time.Second
+	//nolint:mnd
+	ban, _ := global.Str2IntDefaultMinMax(os.Getenv(Flood_BanDuration), int(cfg.BanDuration/time.Second), 0, 31536000)
+	cfg.BanDuration = time.Duration(ban) * time.Second
+	if uas, ok := os.LookupEnv(Flood_ScannerUAs); ok {
+		cfg.ScannerUAs = splitList(uas)
+	}
+}
+
+func initTrunks(conn *net.UDPConn) {
+	path := os.Getenv(Trunks_File)
+	if path == "" {
+		return
+	}
+	trunks, err := sip.LoadTrunks(path)
+	if err != nil {
+		global.LogError(global.LTConfigFiles, "Error reading trunks - Outbound registration disabled", "file", path, "error", err)
+		return
+	}
+	sip.StartTrunks(conn, trunks)
+}
+
+func initWebhooks() *webhooks.Dispatcher {
+	path := os.Getenv(Webhooks_File)
+	if path == "" {
+		return nil
+	}
+	hooks, err := webhooks.LoadConfig(path)
+	if err != nil {
+		global.LogError(global.LTConfigFiles, "Error reading webhooks - Webhooks disabled", "file", path, "error", err)
+		return nil
+	}
+	return webhooks.Start(global.EventBus, hooks)
+}
+
+// awaitShutdown stops on SIGINT/SIGTERM, letting webhooks deliver the events already published until the shutdown timeout.
+// A second signal exits at once
+func awaitShutdown(conn *net.UDPConn, dispatcher *webhooks.Dispatcher) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigs
+	//nolint:mnd
+	timeout, _ := global.Str2IntDefaultMinMax(os.Getenv(Shutdown_Timeout), 10, 1, 300)
+	global.LogInfo(global.LTSystem, "Shutting down", "signal", sig.String(), "timeoutSec", timeout)
+	go func() {
+		sig := <-sigs
+		global.LogWarning(global.LTSystem, "Shutdown forced", "signal", sig.String())
+		os.Exit(1)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	if err := dispatcher.Stop(ctx); err != nil {
+		global.LogWarning(global.LTSystem, "Webhook deliveries aborted on shutdown", "error", err)
+	}
+	cancel()
+	conn.Close()
+	os.Exit(0)
+}
+
+func initDNS() {
+	servers := splitList(os.Getenv(DNS_Servers))
+	if len(servers) == 0 {
+		servers = resolver.SystemServers()
+	}
+	//nolint:mnd
+	timeout, _ := global.Str2IntDefaultMinMax(os.Getenv(DNS_Timeout), 2000, 50, 30000)
+	global.DNSResolver = resolver.New(servers, time.Duration(timeout)*time.Millisecond)
+	global.LogInfo(global.LTConfiguration, "DNS servers", "servers", servers, "timeoutMs", timeout)
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func checkArgs() (*global.UdpSocket, string, int, int, int, int, string) {
 	var (
 		udpskt                                   *global.UdpSocket
@@ -55,10 +276,10 @@ func checkArgs() (*global.UdpSocket, string, int, int, int, int, string) {
 	{
 		var err error
 		if udpskt, err = global.BuildUdpSocket(siplyr, global.SipPort); err != nil {
-			log.Println("Error resolving AS UDP address:", err)
+			global.LogError(global.LTConfiguration, "Error resolving AS UDP address", "address", siplyr, "error", err)
 			os.Exit(1)
 		}
-		global.LogInfo(global.LTConfiguration, fmt.Sprintf("AS Routing: [%s]", siplyr))
+		global.LogInfo(global.LTConfiguration, "AS Routing", "address", siplyr)
 	}
 
 skipAS:
@@ -90,11 +311,52 @@ skipAS:
 	//nolint:mnd
 	kaInter, ok = global.Str2IntDefaultMinMax(kai, global.OodProbingSec, 5, 9999999)
 	if ok {
-		global.LogInfo(global.LTConfiguration, fmt.Sprintf("Setting KeepAlive interval [%d]", kaInter))
+		global.LogInfo(global.LTConfiguration, "Setting KeepAlive interval", "seconds", kaInter)
 	} else {
 		kaInter = global.OodProbingSec
-		global.LogWarning(global.LTConfiguration, fmt.Sprintf("Setting default KeepAlive interval [%d]", kaInter))
+		global.LogWarning(global.LTConfiguration, "Setting default KeepAlive interval", "seconds", kaInter)
 	}
 
+	msp := os.Getenv(Media_StartPort)
+	//nolint:mnd
+	global.MediaStartPort, _ = global.Str2IntDefaultMinMax(msp, global.MediaStartPort, 1024, 65534)
+	global.MediaStartPort += global.MediaStartPort % 2 // RTP on even ports
+
+	mep := os.Getenv(Media_EndPort)
+	//nolint:mnd
+	global.MediaEndPort, _ = global.Str2IntDefaultMinMax(mep, max(global.MediaEndPort, global.MediaStartPort+1), global.MediaStartPort+1, 65535)
+	global.LogInfo(global.LTConfiguration, "Media port range", "start", global.MediaStartPort, "end", global.MediaEndPort)
+
+	if rdir, ok := os.LookupEnv(Recording_Dir); ok && rdir != "" {
+		global.RecordingsDir = rdir
+	}
+
+	//nolint:mnd
+	global.LadderMaxMessages, _ = global.Str2IntDefaultMinMax(os.Getenv(Trace_MaxMessages), global.LadderMaxMessages, 0, 10000)
+	//nolint:mnd
+	global.LadderRetentionSec, _ = global.Str2IntDefaultMinMax(os.Getenv(Trace_Retention), global.LadderRetentionSec, 0, 86400)
+	//nolint:mnd
+	global.LadderMaxRetained, _ = global.Str2IntDefaultMinMax(os.Getenv(Trace_MaxCalls), global.LadderMaxRetained, 0, 100000)
+
+	initRoutingServer(udpskt == nil)
+	initDNS()
+
 	return udpskt, ipv4, sipuport, kaInter, httpport, indiagInter, proxyserver
 }
+
+func initRoutingServer(internalRouting bool) {
+	url := os.Getenv(RoutingServer_URL)
+	if url == "" {
+		return
+	}
+	if !internalRouting {
+		global.LogWarning(global.LTConfiguration, "Routing server requires internal Routing Engine - Ignored", "url", url)
+		return
+	}
+	//nolint:mnd
+	timeout, _ := global.Str2IntDefaultMinMax(os.Getenv(RoutingServer_TO), 1000, 50, 30000)
+	//nolint:mnd
+	cacheSec, _ := global.Str2IntDefaultMinMax(os.Getenv(RoutingServer_Cache), 10, 0, 3600)
+	sip.RouteServer = sip.NewRoutingServer(url, time.Duration(timeout)*time.Millisecond, time.Duration(cacheSec)*time.Second)
+	global.LogInfo(global.LTConfiguration, "Routing server set", "url", url, "timeoutMs", timeout, "cacheSeconds", cacheSec)
+}
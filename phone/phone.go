@@ -2,11 +2,12 @@ package phone
 
 import (
 	"fmt"
-	"log"
 	"maps"
 	"slices"
 	"sync"
+	"sync/atomic"
 
+	"SRGo/events"
 	"SRGo/global"
 	"SRGo/sip/state"
 )
@@ -44,30 +45,64 @@ func (r *IPPhoneRepo) AddOrUpdate(ext, ruri, ipport string, expires int) state.S
 		phone = &IPPhone{Extension: ext, RURI: ruri}
 		r.phones[ext] = phone
 	}
+	wasRegistered, moved := phone.IsRegistered, false
 	ua := phone.GetUA()
 	if ua != nil && ua.GetUDPAddrString() == ipport {
 		goto finish
 	}
+	moved = true
 	{
 		phone.IsReachable = true
 		udpaddr, ok := global.BuildUdpAddr(ipport, global.SipPort)
 		if !ok {
-			log.Println("Error resolving UDP address")
+			global.LogError(global.LTLogInOut, "Error resolving UDP address", "extension", ext, "address", ipport)
 			phone.IsReachable = false
 			phone.SetUA(nil)
 			goto finish
 		}
 		phone.SetUA(global.NewSipUdpUserAgent(udpaddr))
+		phone.unresponsive.Store(false)
 	}
 finish:
 	phone.IsRegistered = expires > 0
-	log.Printf("IPPhone: [%s]\n", phone)
+	global.LogInfo(global.LTLogInOut, "IPPhone updated", "phone", phone.String())
+	if phone.IsRegistered != wasRegistered || (phone.IsRegistered && moved) {
+		publishRegistration(phone, ipport)
+	}
 	if phone.IsRegistered {
 		return state.Registered
 	}
 	return state.Unregistered
 }
 
+func publishRegistration(phone *IPPhone, contact string) {
+	t := events.Unregister
+	if phone.IsRegistered {
+		t = events.Register
+	}
+	global.EventBus.Publish(events.Event{Type: t, Extension: phone.Extension, Contact: contact})
+}
+
+// SetResponsive records whether the phone using ua answered its keepalive probe, publishing the change
+func (r *IPPhoneRepo) SetResponsive(ua *global.SipUdpUserAgent, responsive bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, phone := range r.phones {
+		if phone.GetUA() != ua {
+			continue
+		}
+		if phone.unresponsive.Swap(!responsive) == responsive { // changed
+			t := events.Reachable
+			if !responsive {
+				t = events.Unreachable
+			}
+			global.LogInfo(global.LTLogInOut, "IPPhone "+string(t), "extension", phone.Extension)
+			global.EventBus.Publish(events.Event{Type: t, Extension: phone.Extension, Contact: ua.GetUDPAddrString()})
+		}
+		return
+	}
+}
+
 func (r *IPPhoneRepo) Remove(ext string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -88,6 +123,7 @@ type IPPhone struct {
 	RURI         string                  `json:"ruri"`
 	IsReachable  bool                    `json:"isReachable"`
 	IsRegistered bool                    `json:"isRegistered"`
+	unresponsive atomic.Bool             // keepalive probe timed out
 	mu           sync.RWMutex            `json:"-"`
 }
 
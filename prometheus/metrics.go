@@ -12,9 +12,35 @@ import (
 
 // Metrics holds all the custom Prometheus metrics for the application.
 type Metrics struct {
-	Registry    *prometheus.Registry
-	ConSessions prometheus.Gauge
-	Caps        prometheus.Gauge
+	Registry              *prometheus.Registry
+	ConSessions           prometheus.Gauge
+	Caps                  prometheus.Gauge
+	MediaPairsInUse       prometheus.Gauge
+	MediaPairsFree        prometheus.Gauge
+	MediaPairsQuarantined prometheus.Gauge
+	CallMOS               prometheus.Histogram
+	CallJitter            prometheus.Histogram
+	CallPacketLoss        prometheus.Histogram
+	CallRoundTrip         prometheus.Histogram
+	SIPRequests           *prometheus.CounterVec
+	SIPResponses          *prometheus.CounterVec
+	SessionRejections     *prometheus.CounterVec
+	PostDialDelay         prometheus.Histogram
+	RouteCallAttempts     *prometheus.CounterVec
+	RouteCallsAnswered    *prometheus.CounterVec
+	RouteASR              *prometheus.GaugeVec
+	Retransmissions       *prometheus.CounterVec
+	TransactionTimeouts   *prometheus.CounterVec
+	ParseErrors           prometheus.Counter
+	MediaPoolExhausted    prometheus.Counter
+	WebhookDeliveries     *prometheus.CounterVec
+	RoutingServerLookups  *prometheus.CounterVec
+	TrunkRegistered       *prometheus.GaugeVec
+	TrunkRegistrations    *prometheus.CounterVec
+	ACLRejections         *prometheus.CounterVec
+	BannedIPs             prometheus.Gauge
+	IPBans                *prometheus.CounterVec
+	FloodDrops            *prometheus.CounterVec
 }
 
 // NewMetrics initializes a new custom Prometheus registry and returns an instance of Metrics.
@@ -49,10 +75,223 @@ func NewMetrics(ua string) *Metrics {
 	})
 	reg.MustRegister(concurrentSessions)
 
+	mediaPairsInUse := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: ua,
+		Name:      "MediaPortPairsInUse",
+		Help:      "Shows RTP/RTCP port pairs currently reserved from the media pool",
+	})
+	reg.MustRegister(mediaPairsInUse)
+
+	mediaPairsFree := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: ua,
+		Name:      "MediaPortPairsFree",
+		Help:      "Shows RTP/RTCP port pairs ready to be reserved from the media pool",
+	})
+	reg.MustRegister(mediaPairsFree)
+
+	mediaPairsQuarantined := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: ua,
+		Name:      "MediaPortPairsQuarantined",
+		Help:      "Shows recently released RTP/RTCP port pairs held back from reuse",
+	})
+	reg.MustRegister(mediaPairsQuarantined)
+
+	callMOS := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: ua,
+		Name:      "CallMOS",
+		Help:      "Shows estimated MOS per steered call leg at release",
+		Buckets:   []float64{1, 2, 2.5, 3, 3.5, 3.8, 4, 4.2, 4.4},
+	})
+	reg.MustRegister(callMOS)
+
+	callJitter := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: ua,
+		Name:      "CallJitterMilliseconds",
+		Help:      "Shows mean RTCP reported jitter per steered call leg at release",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+	reg.MustRegister(callJitter)
+
+	callPacketLoss := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: ua,
+		Name:      "CallPacketLossPercent",
+		Help:      "Shows mean RTCP reported packet loss per steered call leg at release",
+		Buckets:   []float64{0, 0.5, 1, 2, 3, 5, 10, 20, 50},
+	})
+	reg.MustRegister(callPacketLoss)
+
+	callRoundTrip := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: ua,
+		Name:      "CallRoundTripMilliseconds",
+		Help:      "Shows mean RTCP round-trip time per steered call leg at release",
+		Buckets:   prometheus.ExponentialBuckets(10, 2, 10),
+	})
+	reg.MustRegister(callRoundTrip)
+
+	sipRequests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "SIPRequests",
+		Help:      "Shows SIP requests received (INBOUND) and sent (OUTBOUND), retransmissions included",
+	}, []string{"method", "direction"})
+	reg.MustRegister(sipRequests)
+
+	sipResponses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "SIPResponses",
+		Help:      "Shows SIP responses received (INBOUND) and sent (OUTBOUND) by CSeq method and status class, retransmissions included",
+	}, []string{"method", "class", "direction"})
+	reg.MustRegister(sipResponses)
+
+	sessionRejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "SessionRejections",
+		Help:      "Shows new sessions rejected by reason",
+	}, []string{"reason"})
+	reg.MustRegister(sessionRejections)
+
+	postDialDelay := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: ua,
+		Name:      "PostDialDelaySeconds",
+		Help:      "Shows delay between outbound INVITE and first 18x received",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 8, 13, 20},
+	})
+	reg.MustRegister(postDialDelay)
+
+	routeCallAttempts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "RouteCallAttempts",
+		Help:      "Shows routed calls completed per route",
+	}, []string{"route"})
+	reg.MustRegister(routeCallAttempts)
+
+	routeCallsAnswered := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "RouteCallsAnswered",
+		Help:      "Shows routed calls answered per route",
+	}, []string{"route"})
+	reg.MustRegister(routeCallsAnswered)
+
+	routeASR := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ua,
+		Name:      "RouteAnswerSeizureRatio",
+		Help:      "Shows percentage of completed calls answered per route since start or last routes stats reset",
+	}, []string{"route"})
+	reg.MustRegister(routeASR)
+
+	retransmissions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "SIPRetransmissions",
+		Help:      "Shows SIP retransmissions received (INBOUND) and sent (OUTBOUND)",
+	}, []string{"direction"})
+	reg.MustRegister(retransmissions)
+
+	transactionTimeouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "SIPTransactionTimeouts",
+		Help:      "Shows SIP transactions timed-out by method",
+	}, []string{"method"})
+	reg.MustRegister(transactionTimeouts)
+
+	parseErrors := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "SIPParseErrors",
+		Help:      "Shows received SIP messages discarded as unparsable",
+	})
+	reg.MustRegister(parseErrors)
+
+	mediaPoolExhausted := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "MediaPoolExhausted",
+		Help:      "Shows media port pair reservations failed for lack of free pairs",
+	})
+	reg.MustRegister(mediaPoolExhausted)
+
+	webhookDeliveries := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "WebhookDeliveries",
+		Help:      "Shows webhook events delivered or failed after all retries",
+	}, []string{"result"})
+	reg.MustRegister(webhookDeliveries)
+
+	routingServerLookups := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "RoutingServerLookups",
+		Help:      "Shows routing server lookups by result: routed, noroute, cached or failed",
+	}, []string{"result"})
+	reg.MustRegister(routingServerLookups)
+
+	trunkRegistered := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ua,
+		Name:      "TrunkRegistered",
+		Help:      "Shows whether each upstream trunk is currently registered (1) or not (0)",
+	}, []string{"trunk"})
+	reg.MustRegister(trunkRegistered)
+
+	trunkRegistrations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "TrunkRegistrations",
+		Help:      "Shows outbound REGISTER attempts per trunk by result: registered, challenged or failed",
+	}, []string{"trunk", "result"})
+	reg.MustRegister(trunkRegistrations)
+
+	aclRejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "ACLRejections",
+		Help:      "Shows requests rejected by the ACL by method, reason (peer, rule or default) and action (drop or 403)",
+	}, []string{"method", "reason", "action"})
+	reg.MustRegister(aclRejections)
+
+	bannedIPs := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: ua,
+		Name:      "BannedIPs",
+		Help:      "Shows the number of currently banned source IPs",
+	})
+	reg.MustRegister(bannedIPs)
+
+	ipBans := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "IPBans",
+		Help:      "Shows source IP bans by reason: rate, scanner, rejected or manual",
+	}, []string{"reason"})
+	reg.MustRegister(ipBans)
+
+	floodDrops := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ua,
+		Name:      "FloodDrops",
+		Help:      "Shows packets dropped by the flood protection by reason: banned, rate or scanner",
+	}, []string{"reason"})
+	reg.MustRegister(floodDrops)
+
 	metrics := &Metrics{
-		Registry:    reg,
-		ConSessions: concurrentSessions,
-		Caps:        caps,
+		Registry:              reg,
+		ConSessions:           concurrentSessions,
+		Caps:                  caps,
+		MediaPairsInUse:       mediaPairsInUse,
+		MediaPairsFree:        mediaPairsFree,
+		MediaPairsQuarantined: mediaPairsQuarantined,
+		CallMOS:               callMOS,
+		CallJitter:            callJitter,
+		CallPacketLoss:        callPacketLoss,
+		CallRoundTrip:         callRoundTrip,
+		SIPRequests:           sipRequests,
+		SIPResponses:          sipResponses,
+		SessionRejections:     sessionRejections,
+		PostDialDelay:         postDialDelay,
+		RouteCallAttempts:     routeCallAttempts,
+		RouteCallsAnswered:    routeCallsAnswered,
+		RouteASR:              routeASR,
+		Retransmissions:       retransmissions,
+		TransactionTimeouts:   transactionTimeouts,
+		ParseErrors:           parseErrors,
+		MediaPoolExhausted:    mediaPoolExhausted,
+		WebhookDeliveries:     webhookDeliveries,
+		RoutingServerLookups:  routingServerLookups,
+		TrunkRegistered:       trunkRegistered,
+		TrunkRegistrations:    trunkRegistrations,
+		ACLRejections:         aclRejections,
+		BannedIPs:             bannedIPs,
+		IPBans:                ipBans,
+		FloodDrops:            floodDrops,
 	}
 
 	return metrics
@@ -0,0 +1,73 @@
+package recording
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// writePcapHeader writes a libpcap global header with IPv4 link type (no link layer)
+func writePcapHeader(w io.Writer) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535) // snaplen
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeIPv4)
+	_, _ = w.Write(hdr)
+}
+
+// writePcapRecord wraps the UDP payload into synthetic IPv4/UDP headers
+func writePcapRecord(w io.Writer, now time.Time, payload []byte, src, dst *net.UDPAddr) {
+	const ipHdrLen, udpHdrLen = 20, 8
+	total := ipHdrLen + udpHdrLen + len(payload)
+
+	rec := make([]byte, 16+ipHdrLen+udpHdrLen)
+	binary.LittleEndian.PutUint32(rec[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(total))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(total))
+
+	ip := rec[16:]
+	ip[0] = 0x45 // IPv4, 20 bytes header
+	binary.BigEndian.PutUint16(ip[2:], uint16(total))
+	ip[8] = 64 // TTL
+	ip[9] = 17 // UDP
+	copy(ip[12:16], ipv4Of(src))
+	copy(ip[16:20], ipv4Of(dst))
+	binary.BigEndian.PutUint16(ip[10:], ipChecksum(ip[:ipHdrLen]))
+
+	udp := ip[ipHdrLen:]
+	binary.BigEndian.PutUint16(udp[0:], uint16(portOf(src)))
+	binary.BigEndian.PutUint16(udp[2:], uint16(portOf(dst)))
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHdrLen+len(payload)))
+
+	_, _ = w.Write(rec)
+	_, _ = w.Write(payload)
+}
+
+func ipv4Of(addr *net.UDPAddr) net.IP {
+	if addr == nil || addr.IP.To4() == nil {
+		return net.IPv4zero.To4()
+	}
+	return addr.IP.To4()
+}
+
+func portOf(addr *net.UDPAddr) int {
+	if addr == nil {
+		return 0
+	}
+	return addr.Port
+}
+
+func ipChecksum(hdr []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(hdr); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(hdr[i:]))
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
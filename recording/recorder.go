@@ -0,0 +1,267 @@
+package recording
+
+import (
+	"SRGo/codec"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+type (
+	Leg int
+
+	format int
+
+	// Recorder captures both directions of a call audio stream.
+	// G.711 audio is decoded into a stereo WAV (caller left, callee right),
+	// any other codec is kept as raw RTP in a PCAP file
+	// Packets are handed to a writer goroutine through a bounded queue, so the RTP relay never waits for the disk
+	Recorder struct {
+		start    time.Time
+		pcapFile *os.File
+		pcap     *bufio.Writer
+		queue    chan packet
+		done     chan struct{}
+		dir      string
+		name     string
+		path     string
+		legs     [2]legTrack
+		format   format
+		closed   bool
+		mu       sync.Mutex
+		once     sync.Once
+	}
+
+	packet struct {
+		at       time.Time
+		src, dst *net.UDPAddr
+		data     []byte
+		leg      Leg
+	}
+
+	// legTrack holds the decoded samples of one direction in a temp file, positioned by RTP timestamp
+	legTrack struct {
+		file       *os.File
+		baseSample int64
+		endSample  int64
+		baseTS     uint32
+		ssrc       uint32
+		started    bool
+	}
+)
+
+const (
+	Caller Leg = iota // left channel
+	Callee            // right channel
+)
+
+const (
+	undecided format = iota
+	wavFormat
+	pcapFormat
+)
+
+const (
+	payloadCN       uint8 = 13
+	maxTSJumpSample       = 60 * codec.G711ClockRate // larger RTP timestamp jumps are treated as a new stream
+	linkTypeIPv4          = 228
+	queueSize             = 1024 // packets waiting for the writer, about 10 seconds of both directions at 20 ms ptime
+)
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// New prepares a recorder writing into dir, with files named after the Call-ID
+func New(dir, callID string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	rec := &Recorder{
+		start: time.Now(),
+		dir:   dir,
+		name:  unsafeChars.ReplaceAllString(callID, "_"),
+		queue: make(chan packet, queueSize),
+		done:  make(chan struct{}),
+	}
+	go rec.run()
+	return rec, nil
+}
+
+// Write queues an RTP packet received from src on local address dst, dropping it when the writer lags behind
+func (rec *Recorder) Write(leg Leg, pkt []byte, src, dst *net.UDPAddr) {
+	if leg != Caller && leg != Callee {
+		return
+	}
+	p := packet{at: time.Now(), src: src, dst: dst, data: append([]byte(nil), pkt...), leg: leg}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.closed {
+		return
+	}
+	select {
+	case rec.queue <- p:
+	default:
+	}
+}
+
+// Close stops the recording and finalizes the file once queued packets are written,
+// returning its path or empty string if nothing was recorded. Safe to be called from both call legs
+func (rec *Recorder) Close() string {
+	rec.once.Do(func() {
+		rec.mu.Lock()
+		rec.closed = true
+		close(rec.queue)
+		rec.mu.Unlock()
+		<-rec.done
+	})
+	return rec.path
+}
+
+// run is the writer goroutine, finalizing the file when the queue is closed
+func (rec *Recorder) run() {
+	defer close(rec.done)
+	var failed bool
+	for p := range rec.queue {
+		if !failed {
+			failed = !rec.record(p)
+		}
+	}
+	switch rec.format {
+	case wavFormat:
+		if err := rec.writeWav(); err != nil {
+			rec.path = ""
+		}
+	case pcapFormat:
+		_ = rec.pcap.Flush()
+		_ = rec.pcapFile.Close()
+	}
+}
+
+// record writes a packet, returning false when the recording file cannot be created
+func (rec *Recorder) record(p packet) bool {
+	pt, ssrc, ts, payload, ok := parseRTP(p.data)
+	if !ok {
+		return true
+	}
+
+	if rec.format == undecided {
+		switch {
+		case codec.IsG711(pt):
+			rec.format = wavFormat
+		case pt == payloadCN:
+			return true
+		default:
+			rec.format = pcapFormat
+		}
+		if err := rec.open(); err != nil {
+			rec.format, rec.path = undecided, ""
+			return false
+		}
+	}
+
+	switch rec.format {
+	case wavFormat:
+		if codec.IsG711(pt) {
+			rec.legs[p.leg].write(p.at.Sub(rec.start), pt, ssrc, ts, payload)
+		}
+	case pcapFormat:
+		writePcapRecord(rec.pcap, p.at, p.data, p.src, p.dst)
+	}
+	return true
+}
+
+func (rec *Recorder) open() error {
+	switch rec.format {
+	case wavFormat:
+		rec.path = filepath.Join(rec.dir, rec.name+".wav")
+		for i := range rec.legs {
+			f, err := os.CreateTemp(rec.dir, fmt.Sprintf("%s.leg%d.*.raw", rec.name, i))
+			if err != nil {
+				rec.legs[0].discard()
+				return err
+			}
+			rec.legs[i].file = f
+		}
+	case pcapFormat:
+		rec.path = filepath.Join(rec.dir, rec.name+".pcap")
+		f, err := os.Create(rec.path)
+		if err != nil {
+			return err
+		}
+		rec.pcapFile, rec.pcap = f, bufio.NewWriter(f)
+		writePcapHeader(rec.pcap)
+	}
+	return nil
+}
+
+// =================================================================================================
+
+// write places the samples of a packet received at elapsed since the recording start
+func (lt *legTrack) write(elapsed time.Duration, pt uint8, ssrc, ts uint32, payload []byte) {
+	// anchor first packet (and any SSRC change) on wall clock, then follow RTP timestamps
+	if !lt.started || ssrc != lt.ssrc {
+		lt.rebase(elapsed, ssrc, ts)
+	}
+	pos := lt.baseSample + int64(int32(ts-lt.baseTS))
+	if pos < 0 || pos-lt.endSample > maxTSJumpSample {
+		lt.rebase(elapsed, ssrc, ts)
+		pos = lt.baseSample
+	}
+
+	samples := codec.DecodeG711(make([]int16, 0, len(payload)), pt, payload)
+	buf := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(s))
+	}
+	if _, err := lt.file.WriteAt(buf, 2*pos); err != nil {
+		return
+	}
+	lt.endSample = max(lt.endSample, pos+int64(len(samples)))
+}
+
+func (lt *legTrack) rebase(elapsed time.Duration, ssrc, ts uint32) {
+	lt.started = true
+	lt.ssrc = ssrc
+	lt.baseTS = ts
+	lt.baseSample = max(int64(elapsed.Seconds()*codec.G711ClockRate), lt.endSample)
+}
+
+func (lt *legTrack) discard() {
+	if lt.file == nil {
+		return
+	}
+	_ = lt.file.Close()
+	_ = os.Remove(lt.file.Name())
+}
+
+// =================================================================================================
+
+func parseRTP(pkt []byte) (pt uint8, ssrc, ts uint32, payload []byte, ok bool) {
+	if len(pkt) < 12 || pkt[0]>>6 != 2 {
+		return
+	}
+	pt = pkt[1] & 0x7F
+	ts = binary.BigEndian.Uint32(pkt[4:8])
+	ssrc = binary.BigEndian.Uint32(pkt[8:12])
+	offset := 12 + 4*int(pkt[0]&0x0F)
+	if pkt[0]&0x10 != 0 { // header extension
+		if len(pkt) < offset+4 {
+			return
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(pkt[offset+2:offset+4]))
+	}
+	end := len(pkt)
+	if pkt[0]&0x20 != 0 { // padding
+		end -= int(pkt[end-1])
+	}
+	if offset > end {
+		return
+	}
+	return pt, ssrc, ts, pkt[offset:end], true
+}
@@ -0,0 +1,120 @@
+package recording_test
+
+import (
+	"SRGo/recording"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func rtpPacket(pt uint8, seq uint16, ts uint32, payloadLen int) []byte {
+	pkt := make([]byte, 12+payloadLen)
+	pkt[0] = 0x80
+	pkt[1] = pt
+	binary.BigEndian.PutUint16(pkt[2:], seq)
+	binary.BigEndian.PutUint32(pkt[4:], ts)
+	binary.BigEndian.PutUint32(pkt[8:], 0x11223344)
+	for i := 12; i < len(pkt); i++ {
+		pkt[i] = 0xD5 // PCMA silence
+	}
+	return pkt
+}
+
+func TestWavHeader(t *testing.T) {
+	t.Parallel()
+
+	rec, err := recording.New(t.TempDir(), "wav@test")
+	require.NoError(t, err)
+
+	const packets, ptime = 50, 160
+	for i := range packets {
+		rec.Write(recording.Caller, rtpPacket(8, uint16(i), uint32(i*ptime), ptime), nil, nil)
+		rec.Write(recording.Callee, rtpPacket(8, uint16(i), uint32(i*ptime), ptime), nil, nil)
+	}
+	path := rec.Close()
+	require.Equal(t, "wav_test.wav", filepath.Base(path), "Call-ID sanitized")
+	require.Equal(t, path, rec.Close(), "closing twice")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Greater(t, len(data), 44)
+
+	dataSize := binary.LittleEndian.Uint32(data[40:])
+	require.Equal(t, "RIFF", string(data[0:4]))
+	require.Equal(t, 36+dataSize, binary.LittleEndian.Uint32(data[4:]))
+	require.Equal(t, "WAVEfmt ", string(data[8:16]))
+	require.Equal(t, uint16(2), binary.LittleEndian.Uint16(data[22:]), "stereo")
+	require.Equal(t, uint32(8000), binary.LittleEndian.Uint32(data[24:]), "sample rate")
+	require.Equal(t, uint32(32000), binary.LittleEndian.Uint32(data[28:]), "byte rate")
+	require.Equal(t, uint16(4), binary.LittleEndian.Uint16(data[32:]), "block align")
+	require.Equal(t, uint16(16), binary.LittleEndian.Uint16(data[34:]), "bits per sample")
+	require.Equal(t, "data", string(data[36:40]))
+	require.Equal(t, uint32(len(data)-44), dataSize)
+	require.Zero(t, dataSize%4)
+	require.GreaterOrEqual(t, dataSize, uint32(packets*ptime*4))
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.raw"))
+	require.Empty(t, matches, "leg temp files removed")
+}
+
+func TestPcapRecord(t *testing.T) {
+	t.Parallel()
+
+	rec, err := recording.New(t.TempDir(), "pcap-test")
+	require.NoError(t, err)
+
+	pkt := rtpPacket(18, 1, 0, 20) // G.729
+	src := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4000}
+	dst := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 7000}
+	rec.Write(recording.Caller, pkt, src, dst)
+	path := rec.Close()
+	require.Equal(t, "pcap-test.pcap", filepath.Base(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, data, 24+16+20+8+len(pkt))
+
+	// global header
+	require.Equal(t, uint32(0xa1b2c3d4), binary.LittleEndian.Uint32(data[0:]))
+	require.Equal(t, uint16(2), binary.LittleEndian.Uint16(data[4:]))
+	require.Equal(t, uint16(4), binary.LittleEndian.Uint16(data[6:]))
+	require.Equal(t, uint32(228), binary.LittleEndian.Uint32(data[20:]), "raw IPv4 link type")
+
+	// record header
+	recHdr := data[24:]
+	require.NotZero(t, binary.LittleEndian.Uint32(recHdr[0:]), "timestamp")
+	require.Equal(t, uint32(28+len(pkt)), binary.LittleEndian.Uint32(recHdr[8:]), "captured length")
+	require.Equal(t, uint32(28+len(pkt)), binary.LittleEndian.Uint32(recHdr[12:]), "original length")
+
+	ip := recHdr[16:]
+	require.Equal(t, byte(0x45), ip[0])
+	require.Equal(t, uint16(28+len(pkt)), binary.BigEndian.Uint16(ip[2:]))
+	require.Equal(t, byte(17), ip[9], "UDP")
+	require.Equal(t, src.IP.To4(), net.IP(ip[12:16]))
+	require.Equal(t, dst.IP.To4(), net.IP(ip[16:20]))
+	var sum uint32
+	for i := 0; i < 20; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(ip[i:]))
+	}
+	sum = (sum >> 16) + (sum & 0xFFFF)
+	require.Equal(t, uint32(0xFFFF), sum, "IPv4 header checksum")
+
+	udp := ip[20:]
+	require.Equal(t, uint16(4000), binary.BigEndian.Uint16(udp[0:]))
+	require.Equal(t, uint16(7000), binary.BigEndian.Uint16(udp[2:]))
+	require.Equal(t, uint16(8+len(pkt)), binary.BigEndian.Uint16(udp[4:]))
+	require.Equal(t, pkt, udp[8:])
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	t.Parallel()
+
+	rec, err := recording.New(t.TempDir(), "closed")
+	require.NoError(t, err)
+	require.Empty(t, rec.Close(), "nothing recorded")
+	rec.Write(recording.Caller, rtpPacket(8, 1, 0, 160), nil, nil)
+}
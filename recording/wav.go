@@ -0,0 +1,76 @@
+package recording
+
+import (
+	"SRGo/codec"
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const (
+	wavChannels      = 2
+	wavBitsPerSample = 16
+	wavChunkSamples  = 4000
+)
+
+// writeWav interleaves both leg tracks into the final stereo WAV file and removes the temp files
+func (rec *Recorder) writeWav() error {
+	defer rec.legs[Caller].discard()
+	defer rec.legs[Callee].discard()
+
+	f, err := os.Create(rec.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	total := max(rec.legs[Caller].endSample, rec.legs[Callee].endSample)
+	w := bufio.NewWriter(f)
+	writeWavHeader(w, uint32(total*wavChannels*wavBitsPerSample/8))
+
+	left := make([]byte, 2*wavChunkSamples)
+	right := make([]byte, 2*wavChunkSamples)
+	frame := make([]byte, 4)
+	for pos := int64(0); pos < total; pos += wavChunkSamples {
+		n := min(wavChunkSamples, total-pos)
+		readChunk(rec.legs[Caller].file, left[:2*n], 2*pos)
+		readChunk(rec.legs[Callee].file, right[:2*n], 2*pos)
+		for i := range n {
+			copy(frame[:2], left[2*i:2*i+2])
+			copy(frame[2:], right[2*i:2*i+2])
+			if _, err := w.Write(frame); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// readChunk reads samples at offset, silence is returned beyond the end of the track
+func readChunk(f *os.File, buf []byte, offset int64) {
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		n = 0
+	}
+	clear(buf[n:])
+}
+
+func writeWavHeader(w io.Writer, dataSize uint32) {
+	const byteRate = codec.G711ClockRate * wavChannels * wavBitsPerSample / 8
+	hdr := make([]byte, 44)
+	copy(hdr[0:], "RIFF")
+	binary.LittleEndian.PutUint32(hdr[4:], 36+dataSize)
+	copy(hdr[8:], "WAVE")
+	copy(hdr[12:], "fmt ")
+	binary.LittleEndian.PutUint32(hdr[16:], 16) // PCM fmt chunk size
+	binary.LittleEndian.PutUint16(hdr[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(hdr[22:], wavChannels)
+	binary.LittleEndian.PutUint32(hdr[24:], codec.G711ClockRate)
+	binary.LittleEndian.PutUint32(hdr[28:], byteRate)
+	binary.LittleEndian.PutUint16(hdr[32:], wavChannels*wavBitsPerSample/8)
+	binary.LittleEndian.PutUint16(hdr[34:], wavBitsPerSample)
+	copy(hdr[36:], "data")
+	binary.LittleEndian.PutUint32(hdr[40:], dataSize)
+	_, _ = w.Write(hdr)
+}
@@ -0,0 +1,84 @@
+package resolver
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const DefaultENUMSuffix = "e164.arpa"
+
+var ErrBadNumber = errors.New("not an E.164 number")
+
+// ENUMDomain returns the ENUM domain of an E.164 number e.g. +4420 with e164.arpa is 0.2.4.4.e164.arpa., RFC 6116
+func ENUMDomain(number, suffix string) (string, error) {
+	digits := strings.TrimPrefix(number, "+")
+	if digits == "" || len(digits) > 15 || strings.Trim(digits, "0123456789") != "" {
+		return "", ErrBadNumber
+	}
+	var sb strings.Builder
+	for i := len(digits) - 1; i >= 0; i-- {
+		sb.WriteByte(digits[i])
+		sb.WriteByte('.')
+	}
+	sb.WriteString(dnsName(strings.TrimPrefix(suffix, ".")))
+	return sb.String(), nil
+}
+
+// ENUM returns the SIP URIs of the E.164 number, best first, from its terminal E2U+sip NAPTR records.
+// As per RFC 3403, once a record matches, records of higher order values are not used
+func (r *Resolver) ENUM(number, suffix string) ([]string, error) {
+	domain, err := ENUMDomain(number, suffix)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.LookupNAPTR(domain)
+	if err != nil {
+		return nil, err
+	}
+	aus := "+" + strings.TrimPrefix(number, "+")
+	var uris []string
+	var order uint16
+	for _, rec := range records {
+		if len(uris) > 0 && rec.Order != order {
+			break
+		}
+		if !strings.EqualFold(rec.Flags, "u") || !isSIPService(rec.Services) {
+			continue
+		}
+		if uri, ok := applyNAPTRRegexp(rec.Regexp, aus); ok {
+			uris = append(uris, uri)
+			order = rec.Order
+		}
+	}
+	return uris, nil
+}
+
+// isSIPService accepts "E2U+sip" (RFC 6116) and the obsolete "SIP+E2U" (RFC 2916)
+func isSIPService(services string) bool {
+	s := strings.ToLower(services)
+	return s == "e2u+sip" || strings.HasPrefix(s, "e2u+sip:") || s == "sip+e2u"
+}
+
+// applyNAPTRRegexp applies a substitution expression such as !^.*$!sip:info@example.com! to the number
+func applyNAPTRRegexp(expr, aus string) (string, bool) {
+	if len(expr) < 3 {
+		return "", false
+	}
+	parts := strings.Split(expr[1:], expr[:1])
+	if len(parts) != 3 {
+		return "", false
+	}
+	pattern := parts[0]
+	if strings.Contains(parts[2], "i") {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil || !re.MatchString(aus) {
+		return "", false
+	}
+	repl := backrefRegex.ReplaceAllString(strings.ReplaceAll(parts[1], "$", "$$"), "$${$1}")
+	return re.ReplaceAllString(aus, repl), true
+}
+
+var backrefRegex = regexp.MustCompile(`\\(\d)`)
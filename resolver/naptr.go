@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// NAPTR record, RFC 3403
+type NAPTR struct {
+	Flags       string
+	Services    string
+	Regexp      string
+	Replacement string
+	Order       uint16
+	Preference  uint16
+}
+
+var errBadNAPTR = errors.New("bad NAPTR record")
+
+// LookupNAPTR returns the NAPTR records of name, sorted by order then preference
+func (r *Resolver) LookupNAPTR(name string) ([]NAPTR, error) {
+	answers, err := r.Lookup(name, TypeNAPTR)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]NAPTR, 0, len(answers))
+	for _, a := range answers {
+		ur, ok := a.Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		if rec, err := parseNAPTR(ur.Data); err == nil {
+			records = append(records, rec)
+		}
+	}
+	slices.SortStableFunc(records, func(a, b NAPTR) int {
+		return cmp.Or(cmp.Compare(a.Order, b.Order), cmp.Compare(a.Preference, b.Preference))
+	})
+	return records, nil
+}
+
+// parseNAPTR parses the RDATA, its replacement domain name being never compressed
+func parseNAPTR(data []byte) (NAPTR, error) {
+	var rec NAPTR
+	if len(data) < 4 {
+		return rec, errBadNAPTR
+	}
+	rec.Order = uint16(data[0])<<8 | uint16(data[1])
+	rec.Preference = uint16(data[2])<<8 | uint16(data[3])
+	data = data[4:]
+	for _, field := range []*string{&rec.Flags, &rec.Services, &rec.Regexp} {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return rec, errBadNAPTR
+		}
+		*field = string(data[1 : 1+data[0]])
+		data = data[1+data[0]:]
+	}
+	var labels []string
+	for {
+		if len(data) < 1 || len(data) < 1+int(data[0]) || data[0] > 63 {
+			return rec, errBadNAPTR
+		}
+		l := int(data[0])
+		if l == 0 {
+			break
+		}
+		labels = append(labels, string(data[1:1+l]))
+		data = data[1+l:]
+	}
+	rec.Replacement = strings.Join(labels, ".")
+	return rec, nil
+}
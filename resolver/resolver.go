@@ -0,0 +1,232 @@
+// Package resolver is a small caching DNS stub resolver for the record types the standard library cannot query e.g. NAPTR
+package resolver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	TypeNAPTR dnsmessage.Type = 35
+
+	negativeTTL = 30 * time.Second // NXDOMAIN and empty answers cached when no SOA minimum is given
+	maxTTL      = time.Hour
+	maxUDPSize  = 4096
+)
+
+var (
+	ErrServerFailure = errors.New("dns server failure")
+	errNoServers     = errors.New("no dns server")
+)
+
+type (
+	Resolver struct {
+		cache   map[cacheKey]cacheEntry
+		servers []string
+		timeout time.Duration
+		mu      sync.Mutex
+	}
+
+	cacheKey struct {
+		name  string
+		qtype dnsmessage.Type
+	}
+
+	cacheEntry struct {
+		expiry  time.Time
+		answers []dnsmessage.Resource
+	}
+)
+
+// New returns a resolver querying the servers (host:port, port 53 by default) in turn, each attempt up to timeout
+func New(servers []string, timeout time.Duration) *Resolver {
+	r := &Resolver{cache: make(map[cacheKey]cacheEntry), timeout: timeout}
+	for _, s := range servers {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, "53")
+		}
+		r.servers = append(r.servers, s)
+	}
+	return r
+}
+
+// SystemServers returns the nameservers of /etc/resolv.conf
+func SystemServers() []string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var servers []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if fields := strings.Fields(sc.Text()); len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// Lookup returns the answers of type qtype for name, from the cache while their TTL lasts
+func (r *Resolver) Lookup(name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	name = strings.ToLower(dnsName(name))
+	key := cacheKey{name: name, qtype: qtype}
+	now := time.Now()
+
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && now.Before(entry.expiry) {
+		return entry.answers, nil
+	}
+
+	answers, ttl, err := r.exchange(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		r.mu.Lock()
+		for k, e := range r.cache { // keep the cache small, DNS answers are short lived
+			if now.After(e.expiry) {
+				delete(r.cache, k)
+			}
+		}
+		r.cache[key] = cacheEntry{expiry: now.Add(ttl), answers: answers}
+		r.mu.Unlock()
+	}
+	return answers, nil
+}
+
+func (r *Resolver) exchange(name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	req, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = errNoServers
+	for _, server := range r.servers {
+		var resp *dnsmessage.Message
+		if resp, err = r.exchangeWith(server, req, q.Header.ID); err != nil {
+			continue
+		}
+		switch resp.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+			answers, ttl := filterAnswers(resp, qtype)
+			return answers, ttl, nil
+		default:
+			err = fmt.Errorf("%w: %s from %s", ErrServerFailure, resp.RCode, server)
+		}
+	}
+	return nil, 0, err
+}
+
+func (r *Resolver) exchangeWith(server string, req []byte, id uint16) (*dnsmessage.Message, error) {
+	resp, err := r.roundTrip("udp", server, req)
+	if err == nil && resp.Truncated {
+		resp, err = r.roundTrip("tcp", server, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.ID != id || !resp.Response {
+		return nil, fmt.Errorf("%w: bad response from %s", ErrServerFailure, server)
+	}
+	return resp, nil
+}
+
+func (r *Resolver) roundTrip(network, server string, req []byte) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, server, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(r.timeout))
+
+	var buf []byte
+	if network == "tcp" { // 2 bytes length prefixed
+		if _, err = conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(req)))); err == nil {
+			_, err = conn.Write(req)
+		}
+		var lb [2]byte
+		if err == nil {
+			_, err = readFull(conn, lb[:])
+		}
+		if err == nil {
+			buf = make([]byte, binary.BigEndian.Uint16(lb[:]))
+			_, err = readFull(conn, buf)
+		}
+	} else {
+		if _, err = conn.Write(req); err == nil {
+			buf = make([]byte, maxUDPSize)
+			var n int
+			n, err = conn.Read(buf)
+			buf = buf[:n]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func readFull(conn net.Conn, b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		m, err := conn.Read(b[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// filterAnswers keeps the answers of type qtype (following CNAMEs), with the TTL they can be cached for
+func filterAnswers(resp *dnsmessage.Message, qtype dnsmessage.Type) ([]dnsmessage.Resource, time.Duration) {
+	var answers []dnsmessage.Resource
+	ttl := maxTTL
+	for _, a := range resp.Answers {
+		if a.Header.Type == qtype {
+			answers = append(answers, a)
+			ttl = min(ttl, time.Duration(a.Header.TTL)*time.Second)
+		}
+	}
+	if len(answers) > 0 {
+		return answers, ttl
+	}
+	for _, a := range resp.Authorities {
+		if soa, ok := a.Body.(*dnsmessage.SOAResource); ok {
+			return nil, min(time.Duration(soa.MinTTL)*time.Second, time.Duration(a.Header.TTL)*time.Second)
+		}
+	}
+	return nil, negativeTTL
+}
+
+func dnsName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
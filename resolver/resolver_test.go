@@ -0,0 +1,243 @@
+package resolver_test
+
+import (
+	"SRGo/resolver"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is an in-process DNS server answering from a fixed zone
+type dnsStub struct {
+	zone    map[string][]dnsmessage.Resource // key: lowercase name + "/" + type
+	queries map[string]int
+	conn    net.PacketConn
+	mu      sync.Mutex
+}
+
+func newDNSStub(t *testing.T) *dnsStub {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &dnsStub{zone: make(map[string][]dnsmessage.Resource), queries: make(map[string]int), conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *dnsStub) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *dnsStub) add(name string, ttl uint32, qtype dnsmessage.Type, body dnsmessage.ResourceBody) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hdr := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET, TTL: ttl}
+	key := strings.ToLower(name) + "/" + qtype.String()
+	s.zone[key] = append(s.zone[key], dnsmessage.Resource{Header: hdr, Body: body})
+}
+
+func (s *dnsStub) count(name string, qtype dnsmessage.Type) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[strings.ToLower(name)+"/"+qtype.String()]
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var req dnsmessage.Message
+		if req.Unpack(buf[:n]) != nil || len(req.Questions) != 1 {
+			continue
+		}
+		q := req.Questions[0]
+		key := strings.ToLower(q.Name.String()) + "/" + q.Type.String()
+		s.mu.Lock()
+		s.queries[key]++
+		answers := s.zone[key]
+		s.mu.Unlock()
+
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: req.ID, Response: true, RecursionAvailable: true},
+			Questions: req.Questions,
+			Answers:   answers,
+		}
+		if len(answers) == 0 {
+			resp.RCode = dnsmessage.RCodeNameError
+		}
+		out, err := resp.Pack()
+		if err == nil {
+			_, _ = s.conn.WriteTo(out, addr)
+		}
+	}
+}
+
+func naptr(order, pref uint16, flags, services, re, replacement string) *dnsmessage.UnknownResource {
+	data := []byte{byte(order >> 8), byte(order), byte(pref >> 8), byte(pref)}
+	for _, s := range []string{flags, services, re} {
+		data = append(data, byte(len(s)))
+		data = append(data, s...)
+	}
+	for l := range strings.SplitSeq(strings.TrimSuffix(replacement, "."), ".") {
+		if l != "" {
+			data = append(data, byte(len(l)))
+			data = append(data, l...)
+		}
+	}
+	data = append(data, 0)
+	return &dnsmessage.UnknownResource{Type: resolver.TypeNAPTR, Data: data}
+}
+
+func TestENUMDomain(t *testing.T) {
+	t.Parallel()
+
+	d, err := resolver.ENUMDomain("+4420", resolver.DefaultENUMSuffix)
+	require.NoError(t, err)
+	require.Equal(t, "0.2.4.4.e164.arpa.", d)
+	d, err = resolver.ENUMDomain("2012", "nrenum.net.")
+	require.NoError(t, err)
+	require.Equal(t, "2.1.0.2.nrenum.net.", d)
+	_, err = resolver.ENUMDomain("+20abc", resolver.DefaultENUMSuffix)
+	require.ErrorIs(t, err, resolver.ErrBadNumber)
+}
+
+func TestENUM(t *testing.T) {
+	t.Parallel()
+
+	stub := newDNSStub(t)
+	const domain = "4.3.2.1.0.2.e164.arpa."
+	stub.add(domain, 300, resolver.TypeNAPTR, naptr(100, 20, "u", "E2U+sip", `!^.*$!sip:backup@gw2.example.com!`, "."))
+	stub.add(domain, 300, resolver.TypeNAPTR, naptr(100, 10, "u", "E2U+sip", `!^\+(20)(.*)$!sip:\2;npdi;rn=+\1999@gw1.example.com!`, "."))
+	stub.add(domain, 300, resolver.TypeNAPTR, naptr(50, 10, "u", "E2U+email", `!^.*$!mailto:info@example.com!`, "."))
+	stub.add(domain, 300, resolver.TypeNAPTR, naptr(200, 10, "u", "E2U+sip", `!bad(!sip:x@y!`, "."))
+	stub.add(domain, 300, resolver.TypeNAPTR, naptr(150, 10, "u", "E2U+sip", `!^.*$!sip:ignored@gw3.example.com!`, ".")) // higher order
+
+	r := resolver.New([]string{stub.addr()}, time.Second)
+	uris, err := r.ENUM("+201234", resolver.DefaultENUMSuffix)
+	require.NoError(t, err)
+	require.Equal(t, []string{"sip:1234;npdi;rn=+20999@gw1.example.com", "sip:backup@gw2.example.com"}, uris)
+
+	// cached for the TTL
+	_, err = r.ENUM("201234", "e164.arpa")
+	require.NoError(t, err)
+	require.Equal(t, 1, stub.count(domain, resolver.TypeNAPTR))
+
+	// not found, negative answer
+	uris, err = r.ENUM("+209999", resolver.DefaultENUMSuffix)
+	require.NoError(t, err)
+	require.Empty(t, uris)
+}
+
+func TestTTLExpiry(t *testing.T) {
+	t.Parallel()
+
+	stub := newDNSStub(t)
+	stub.add("1.2.e164.arpa.", 0, resolver.TypeNAPTR, naptr(10, 10, "u", "E2U+sip", `!^.*$!sip:a@b!`, "."))
+	r := resolver.New([]string{stub.addr()}, time.Second)
+	for range 2 {
+		uris, err := r.ENUM("+21", resolver.DefaultENUMSuffix)
+		require.NoError(t, err)
+		require.Equal(t, []string{"sip:a@b"}, uris)
+	}
+	require.Equal(t, 2, stub.count("1.2.e164.arpa.", resolver.TypeNAPTR), "TTL 0 not cached")
+}
+
+func TestServerFailover(t *testing.T) {
+	t.Parallel()
+
+	stub := newDNSStub(t)
+	stub.add("1.2.e164.arpa.", 60, resolver.TypeNAPTR, naptr(10, 10, "u", "E2U+sip", `!^.*$!sip:a@b!`, "."))
+
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0") // never answers
+	require.NoError(t, err)
+	defer dead.Close()
+
+	r := resolver.New([]string{dead.LocalAddr().String(), stub.addr()}, 200*time.Millisecond)
+	uris, err := r.ENUM("+21", resolver.DefaultENUMSuffix)
+	require.NoError(t, err)
+	require.Equal(t, []string{"sip:a@b"}, uris)
+
+	r = resolver.New([]string{dead.LocalAddr().String()}, 100*time.Millisecond)
+	_, err = r.ENUM("+21", resolver.DefaultENUMSuffix)
+	require.Error(t, err)
+}
+
+func srv(prio, weight, port uint16, target string) *dnsmessage.SRVResource {
+	return &dnsmessage.SRVResource{Priority: prio, Weight: weight, Port: port, Target: dnsmessage.MustNewName(target)}
+}
+
+func a(ip string) *dnsmessage.AResource {
+	return &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())}
+}
+
+func TestResolveSIP(t *testing.T) {
+	t.Parallel()
+
+	stub := newDNSStub(t)
+	stub.add("pbx.example.test.", 60, resolver.TypeNAPTR, naptr(10, 10, "s", "SIP+D2T", "", "_sip._tcp.pbx.example.test."))
+	stub.add("pbx.example.test.", 60, resolver.TypeNAPTR, naptr(20, 10, "s", "SIP+D2U", "", "_sip._udp.pbx.example.test."))
+	stub.add("_sip._udp.pbx.example.test.", 60, dnsmessage.TypeSRV, srv(20, 0, 5080, "backup.example.test."))
+	stub.add("_sip._udp.pbx.example.test.", 60, dnsmessage.TypeSRV, srv(10, 0, 5070, "main.example.test."))
+	stub.add("main.example.test.", 60, dnsmessage.TypeA, a("192.0.2.1"))
+	stub.add("backup.example.test.", 60, dnsmessage.TypeA, a("192.0.2.2"))
+	stub.add("pbx.example.test.", 60, dnsmessage.TypeA, a("192.0.2.9"))
+	stub.add("_sip._udp.gw.example.test.", 60, dnsmessage.TypeSRV, srv(10, 0, 5062, "main.example.test."))
+
+	r := resolver.New([]string{stub.addr()}, time.Second)
+
+	// NAPTR -> SRV -> A, priority ordered
+	addrs, err := r.ResolveSIP("pbx.example.test", 5060, false)
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	require.Equal(t, "192.0.2.1:5070", addrs[0].String())
+	require.Equal(t, "192.0.2.2:5080", addrs[1].String())
+
+	// no NAPTR, SRV only
+	addrs, err = r.ResolveSIP("gw.example.test", 5060, false)
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, "192.0.2.1:5062", addrs[0].String())
+
+	// explicit port, A only
+	addrs, err = r.ResolveSIP("pbx.example.test", 5090, true)
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, "192.0.2.9:5090", addrs[0].String())
+	require.Zero(t, stub.count("pbx.example.test.", dnsmessage.TypeSRV))
+
+	// IP literal, no lookup
+	addrs, err = r.ResolveSIP("198.51.100.7", 5060, false)
+	require.NoError(t, err)
+	require.Equal(t, "198.51.100.7:5060", addrs[0].String())
+}
+
+func TestLookupSRVWeights(t *testing.T) {
+	t.Parallel()
+
+	stub := newDNSStub(t)
+	stub.add("_sip._udp.w.example.test.", 0, dnsmessage.TypeSRV, srv(10, 0, 5060, "zero.example.test."))
+	stub.add("_sip._udp.w.example.test.", 0, dnsmessage.TypeSRV, srv(10, 100, 5060, "heavy.example.test."))
+	stub.add("_sip._udp.w.example.test.", 0, dnsmessage.TypeSRV, srv(5, 1, 5060, "first.example.test."))
+
+	r := resolver.New([]string{stub.addr()}, time.Second)
+	heavy := 0
+	for range 50 {
+		recs, err := r.LookupSRV("_sip._udp.w.example.test.")
+		require.NoError(t, err)
+		require.Len(t, recs, 3)
+		require.Equal(t, "first.example.test", recs[0].Target)
+		if recs[1].Target == "heavy.example.test" {
+			heavy++
+		}
+	}
+	require.Greater(t, heavy, 40, "weight 100 should nearly always precede weight 0")
+}
@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// SRV record, RFC 2782
+type SRV struct {
+	Target   string
+	Port     uint16
+	Priority uint16
+	Weight   uint16
+}
+
+var ErrNoAddress = errors.New("no address found")
+
+// LookupSRV returns the SRV records of name, ordered by priority then weighted random selection
+func (r *Resolver) LookupSRV(name string) ([]SRV, error) {
+	answers, err := r.Lookup(name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]SRV, 0, len(answers))
+	for _, a := range answers {
+		if srv, ok := a.Body.(*dnsmessage.SRVResource); ok {
+			records = append(records, SRV{Target: strings.TrimSuffix(srv.Target.String(), "."), Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+		}
+	}
+	if len(records) == 1 && records[0].Target == "" { // "." target: service decidedly not available
+		return nil, nil
+	}
+	slices.SortFunc(records, func(a, b SRV) int { return cmp.Compare(a.Priority, b.Priority) })
+	for i := 0; i < len(records); {
+		j := i
+		for j < len(records) && records[j].Priority == records[i].Priority {
+			j++
+		}
+		shuffleByWeight(records[i:j])
+		i = j
+	}
+	return records, nil
+}
+
+// shuffleByWeight orders same priority records by repeated weighted random selection
+func shuffleByWeight(records []SRV) {
+	for i := range records {
+		total := 0
+		for _, rec := range records[i:] {
+			total += int(rec.Weight)
+		}
+		if total == 0 {
+			rand.Shuffle(len(records)-i, func(a, b int) { records[i+a], records[i+b] = records[i+b], records[i+a] })
+			return
+		}
+		pick := rand.IntN(total)
+		for j := i; j < len(records); j++ {
+			if pick -= int(records[j].Weight); pick < 0 {
+				records[i], records[j] = records[j], records[i]
+				break
+			}
+		}
+	}
+}
+
+// LookupIPv4 returns the A records of host, falling back to the system resolver e.g. for /etc/hosts names
+func (r *Resolver) LookupIPv4(host string) ([]net.IP, error) {
+	answers, err := r.Lookup(host, dnsmessage.TypeA)
+	var ips []net.IP
+	for _, a := range answers {
+		if rec, ok := a.Body.(*dnsmessage.AResource); ok {
+			ips = append(ips, net.IP(rec.A[:]))
+		}
+	}
+	if len(ips) > 0 {
+		return ips, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	sysips, syserr := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if syserr != nil {
+		return nil, cmp.Or(err, syserr)
+	}
+	return sysips, nil
+}
+
+// ResolveSIP returns the UDP addresses to try in order for a SIP host, RFC 3263: without explicit port,
+// NAPTR (SIP+D2U) then SRV (_sip._udp) records are used when found, otherwise the A records of host on port
+func (r *Resolver) ResolveSIP(host string, port int, explicitPort bool) ([]*net.UDPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []*net.UDPAddr{{IP: ip, Port: port}}, nil
+	}
+	if !explicitPort {
+		var srvNames []string
+		if naptrs, err := r.LookupNAPTR(host); err == nil {
+			for _, n := range naptrs {
+				if strings.EqualFold(n.Flags, "s") && strings.EqualFold(n.Services, "SIP+D2U") && n.Replacement != "" {
+					srvNames = append(srvNames, n.Replacement)
+				}
+			}
+		}
+		if len(srvNames) == 0 {
+			srvNames = []string{"_sip._udp." + host}
+		}
+		var addrs []*net.UDPAddr
+		for _, name := range srvNames {
+			srvs, _ := r.LookupSRV(name)
+			for _, srv := range srvs {
+				ips, _ := r.LookupIPv4(srv.Target)
+				for _, ip := range ips {
+					addrs = append(addrs, &net.UDPAddr{IP: ip, Port: int(srv.Port)})
+				}
+			}
+			if len(addrs) > 0 {
+				return addrs, nil
+			}
+		}
+	}
+	ips, err := r.LookupIPv4(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, ErrNoAddress
+	}
+	addrs := make([]*net.UDPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, &net.UDPAddr{IP: ip, Port: port})
+	}
+	return addrs, nil
+}
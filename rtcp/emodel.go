@@ -0,0 +1,38 @@
+package rtcp
+
+// Simplified ITU-T G.107 E-model for G.711 with packet loss concealment
+
+const (
+	codecDelayMS = 10   // G.711 packetization and processing
+	bpl          = 25.1 // G.711 packet loss robustness factor (G.113 Appendix I)
+	ro           = 93.2 // basic signal-to-noise ratio with default values
+)
+
+// RFactor estimates the transmission rating from round-trip time, jitter (ms) and packet loss (%)
+func RFactor(rttMS, jitterMS, lossPct float64) float64 {
+	// one way delay, jitter buffer assumed twice the jitter
+	d := rttMS/2 + 2*jitterMS + codecDelayMS
+	id := 0.024 * d
+	if d > 177.3 {
+		id += 0.11 * (d - 177.3)
+	}
+	lossPct = min(max(lossPct, 0), 100)
+	ie := 95 * lossPct / (lossPct + bpl)
+	return min(max(ro-id-ie, 0), 100)
+}
+
+// MOS converts an R factor to the Mean Opinion Score (1 - 4.5)
+func MOS(r float64) float64 {
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+	return 1 + 0.035*r + 7e-6*r*(r-60)*(100-r)
+}
+
+// EstimateMOS estimates the MOS from round-trip time, jitter (ms) and packet loss (%)
+func EstimateMOS(rttMS, jitterMS, lossPct float64) float64 {
+	return MOS(RFactor(rttMS, jitterMS, lossPct))
+}
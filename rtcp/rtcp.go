@@ -0,0 +1,99 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	TypeSR = 200 // Sender Report
+	TypeRR = 201 // Receiver Report
+
+	headerLen      = 4
+	reportBlockLen = 24
+	senderInfoLen  = 20
+)
+
+var ErrInvalidPacket = errors.New("invalid RTCP packet")
+
+type (
+	// ReportBlock is the reception statistics of one source (RFC 3550 section 6.4.1)
+	ReportBlock struct {
+		SSRC           uint32
+		CumulativeLost int32
+		HighestSeq     uint32
+		Jitter         uint32 // in RTP timestamp units
+		LSR            uint32 // middle 32 bits of the last SR NTP timestamp
+		DLSR           uint32 // delay since last SR, in 1/65536 seconds
+		FractionLost   uint8  // fraction of packets lost since previous report, out of 256
+	}
+
+	// Report is a parsed SR or RR
+	Report struct {
+		Blocks     []ReportBlock
+		SenderSSRC uint32
+		NTPMiddle  uint32 // SR only - the value echoed as LSR by receivers
+		Type       uint8
+	}
+)
+
+// Parse extracts the SR and RR packets of a compound RTCP packet, skipping other types (SDES, BYE, APP ...)
+func Parse(b []byte) ([]Report, error) {
+	var reports []Report
+	for len(b) > 0 {
+		if len(b) < headerLen || b[0]>>6 != 2 {
+			return reports, ErrInvalidPacket
+		}
+		count := int(b[0] & 0x1F)
+		pt := b[1]
+		size := (int(binary.BigEndian.Uint16(b[2:4])) + 1) * 4
+		if size > len(b) {
+			return reports, ErrInvalidPacket
+		}
+		pkt := b[:size]
+		b = b[size:]
+
+		var offset int
+		rpt := Report{Type: pt}
+		switch pt {
+		case TypeSR:
+			if len(pkt) < 8+senderInfoLen {
+				return reports, ErrInvalidPacket
+			}
+			rpt.NTPMiddle = binary.BigEndian.Uint32(pkt[10:14])
+			offset = 8 + senderInfoLen
+		case TypeRR:
+			if len(pkt) < 8 {
+				return reports, ErrInvalidPacket
+			}
+			offset = 8
+		default:
+			continue
+		}
+		rpt.SenderSSRC = binary.BigEndian.Uint32(pkt[4:8])
+		if len(pkt) < offset+count*reportBlockLen {
+			return reports, ErrInvalidPacket
+		}
+		for i := range count {
+			rpt.Blocks = append(rpt.Blocks, parseReportBlock(pkt[offset+i*reportBlockLen:]))
+		}
+		reports = append(reports, rpt)
+	}
+	return reports, nil
+}
+
+func parseReportBlock(b []byte) ReportBlock {
+	lost := int32(binary.BigEndian.Uint32(b[4:8]) & 0x00FFFFFF)
+	if lost&0x00800000 != 0 { // 24 bits signed
+		lost -= 1 << 24
+	}
+	return ReportBlock{
+		SSRC:           binary.BigEndian.Uint32(b[0:4]),
+		FractionLost:   b[4],
+		CumulativeLost: lost,
+		HighestSeq:     binary.BigEndian.Uint32(b[8:12]),
+		Jitter:         binary.BigEndian.Uint32(b[12:16]),
+		LSR:            binary.BigEndian.Uint32(b[16:20]),
+		DLSR:           binary.BigEndian.Uint32(b[20:24]),
+	}
+}
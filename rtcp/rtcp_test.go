@@ -0,0 +1,87 @@
+package rtcp_test
+
+import (
+	"SRGo/rtcp"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func reportBlock(ssrc uint32, fraction uint8, lost int32, jitter, lsr, dlsr uint32) []byte {
+	b := make([]byte, 24)
+	binary.BigEndian.PutUint32(b[0:], ssrc)
+	binary.BigEndian.PutUint32(b[4:], uint32(lost)&0x00FFFFFF)
+	b[4] = fraction
+	binary.BigEndian.PutUint32(b[8:], 1000)
+	binary.BigEndian.PutUint32(b[12:], jitter)
+	binary.BigEndian.PutUint32(b[16:], lsr)
+	binary.BigEndian.PutUint32(b[20:], dlsr)
+	return b
+}
+
+func header(pt uint8, count int, words int) []byte {
+	return []byte{0x80 | byte(count), pt, byte(words >> 8), byte(words)}
+}
+
+func TestParseCompound(t *testing.T) {
+	t.Parallel()
+
+	// SR with one report block
+	sr := header(rtcp.TypeSR, 1, 12)
+	sr = binary.BigEndian.AppendUint32(sr, 0x11111111)
+	sr = binary.BigEndian.AppendUint64(sr, 0xAAAABBBBCCCCDDDD) // NTP
+	sr = binary.BigEndian.AppendUint32(sr, 160)                // RTP ts
+	sr = binary.BigEndian.AppendUint32(sr, 50)                 // packets
+	sr = binary.BigEndian.AppendUint32(sr, 8000)               // octets
+	sr = append(sr, reportBlock(0x22222222, 64, 12, 80, 0x12345678, 65536)...)
+
+	// SDES skipped
+	sdes := append(header(202, 1, 2), 0, 0, 0, 1, 1, 1, 'a', 0)
+
+	// RR with negative cumulative loss (duplicates)
+	rr := header(rtcp.TypeRR, 1, 7)
+	rr = binary.BigEndian.AppendUint32(rr, 0x33333333)
+	rr = append(rr, reportBlock(0x44444444, 0, -3, 8, 0, 0)...)
+
+	pkt := append(append(sr, sdes...), rr...)
+	reports, err := rtcp.Parse(pkt)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+
+	require.Equal(t, uint8(rtcp.TypeSR), reports[0].Type)
+	require.Equal(t, uint32(0x11111111), reports[0].SenderSSRC)
+	require.Equal(t, uint32(0xBBBBCCCC), reports[0].NTPMiddle)
+	require.Len(t, reports[0].Blocks, 1)
+	require.Equal(t, rtcp.ReportBlock{SSRC: 0x22222222, FractionLost: 64, CumulativeLost: 12, HighestSeq: 1000, Jitter: 80, LSR: 0x12345678, DLSR: 65536}, reports[0].Blocks[0])
+
+	require.Equal(t, uint8(rtcp.TypeRR), reports[1].Type)
+	require.Equal(t, int32(-3), reports[1].Blocks[0].CumulativeLost)
+}
+
+func TestParseTruncated(t *testing.T) {
+	t.Parallel()
+
+	rr := header(rtcp.TypeRR, 1, 7)
+	rr = binary.BigEndian.AppendUint32(rr, 1)
+	_, err := rtcp.Parse(rr)
+	require.ErrorIs(t, err, rtcp.ErrInvalidPacket)
+
+	_, err = rtcp.Parse([]byte{0x00, 201, 0, 1})
+	require.ErrorIs(t, err, rtcp.ErrInvalidPacket)
+}
+
+func TestEstimateMOS(t *testing.T) {
+	t.Parallel()
+
+	perfect := rtcp.EstimateMOS(0, 0, 0)
+	require.InDelta(t, 4.4, perfect, 0.05)
+
+	require.Less(t, rtcp.EstimateMOS(0, 0, 5), perfect, "loss degrades quality")
+	require.Less(t, rtcp.EstimateMOS(400, 0, 0), rtcp.EstimateMOS(100, 0, 0), "delay degrades quality")
+	require.Less(t, rtcp.EstimateMOS(100, 40, 0), rtcp.EstimateMOS(100, 0, 0), "jitter degrades quality")
+	require.InDelta(t, 1.0, rtcp.EstimateMOS(2000, 500, 100), 0.5)
+
+	require.InDelta(t, 1.0, rtcp.MOS(-5), 0)
+	require.InDelta(t, 4.5, rtcp.MOS(120), 0)
+}
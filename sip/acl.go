@@ -0,0 +1,111 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"SRGo/acl"
+	. "SRGo/global"
+	"SRGo/guid"
+	"SRGo/sip/status"
+)
+
+// asAddr is the AS address, resolved at start then at each AS probing so that a hostname AS is followed when it moves
+var asAddr atomic.Pointer[net.UDPAddr]
+
+// resolveAS refreshes the AS address, the last resolved one being kept while the AS cannot be resolved
+func resolveAS() {
+	if SkipAS {
+		return
+	}
+	addr := ASUserAgent.GetUDPAddr()
+	if addr == nil {
+		if asAddr.Load() == nil {
+			LogWarning(LTConfiguration, "AS address not resolvable - not trusted until resolved", "as", ASUserAgent.String())
+		}
+		return
+	}
+	if prev := asAddr.Swap(addr); !AreUdpAddrsEqual(prev, addr) {
+		LogInfo(LTConfiguration, "AS address resolved - trusted peer", "address", addr.String())
+	}
+}
+
+// fromAS tells whether src is the AS, always a trusted peer whatever the ACL
+func fromAS(src *net.UDPAddr) bool {
+	return src != nil && AreUdpAddrsEqual(src, asAddr.Load())
+}
+
+// isAS tells whether src is the AS or an ACL peer with the AS role, so that calls from it are told apart from the ones towards it
+func isAS(src *net.UDPAddr) bool {
+	return fromAS(src) || ACL.PeerOf(src).IsAS()
+}
+
+// trusted tells whether src is the AS or an ACL peer
+func trusted(src *net.UDPAddr) bool {
+	return fromAS(src) || ACL.PeerOf(src) != nil
+}
+
+// SetACL puts the ACL in use once its peer signalling profiles are checked
+func SetACL(a *acl.ACL) error {
+	for _, p := range a.Peers() {
+		if err := profileRules(p).Validate(); err != nil {
+			return fmt.Errorf("%w: peer %s profile: %w", acl.ErrBadConfig, p.Name, err)
+		}
+	}
+	ACL = a
+	return nil
+}
+
+// profileRules returns the header rules of the peer signalling profile, nil if none
+func profileRules(p *acl.Peer) *HeaderRules {
+	if p == nil || p.Profile == nil {
+		return nil
+	}
+	return &HeaderRules{Set: p.Profile.SetHeaders, Remove: p.Profile.RemoveHeaders}
+}
+
+// admitted applies the ACL to dialogue creating and out-of-dialogue requests, and the signalling profile of the peer they come from.
+// In-dialogue requests, ACK and CANCEL are not filtered as they only match existing calls, nor requests from the AS
+func admitted(msg *SipMessage, src *net.UDPAddr, conn *net.UDPConn) bool {
+	if !msg.IsRequest() || msg.ToTag != "" {
+		return true
+	}
+	method := msg.StartLine.Method
+	if method == ACK || method == CANCEL || fromAS(src) {
+		return true
+	}
+	decision := ACL.Check(src, method.String())
+	if decision.Allowed {
+		profileRules(decision.Peer).Apply(msg.Headers)
+		return true
+	}
+	action := "drop"
+	if ACL.Reject403() {
+		action = "403"
+		sendStatelessResponse(msg, status.Forbidden, src, conn)
+	}
+	Prometrics.ACLRejections.WithLabelValues(method.String(), decision.Reason, action).Inc()
+	rejected(src)
+	if LogEnabled(LTSecurity, LLDebug) {
+		LogDebug(LTSecurity, "Request rejected by ACL", "method", method.String(), "source", src.String(), "reason", decision.Reason, "action", action, "callId", msg.CallID)
+	}
+	return false
+}
+
+// sendStatelessResponse answers a request without creating a session
+func sendStatelessResponse(msg *SipMessage, stsCode int, dst *net.UDPAddr, conn *net.UDPConn) {
+	rsp := NewResponseMessage(stsCode, "")
+	hdrs := NewSHsPointer(true)
+	hdrs.AddHeaderValues(Via, msg.Headers.HeaderValues(Via))
+	hdrs.AddHeader(From, msg.Headers.ValueHeader(From))
+	hdrs.AddHeader(To, msg.Headers.ValueHeader(To)+";tag="+guid.NewTag())
+	hdrs.AddHeader(Call_ID, msg.CallID)
+	hdrs.AddHeader(CSeq, msg.Headers.ValueHeader(CSeq))
+	rsp.Headers = hdrs
+	rsp.PrepareMessageBytes(nil)
+	countMessage(rsp, msg.StartLine.Method, OUTBOUND)
+	if _, err := conn.WriteToUDP(rsp.Bytes, dst); err != nil {
+		LogError(LTSystem, "Failed to send message", "error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package sip_test
+
+import (
+	"SRGo/acl"
+	"SRGo/global"
+	"SRGo/sip"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestASFollowedWhenResolvedAgain(t *testing.T) {
+	skt, err := global.BuildUdpSocket("192.0.2.50:5060", global.SipPort)
+	require.NoError(t, err)
+	sip.SkipAS = false
+	sip.ASUserAgent = global.NewSipUdpUserAgentFromSocket(skt)
+	a, err := acl.New(acl.Config{Peers: []*acl.Peer{
+		{Name: "pbx", CIDRs: []string{"198.51.100.0/24"}, Role: acl.RoleAS},
+		{Name: "carrier", CIDRs: []string{"203.0.113.0/24"}},
+	}})
+	require.NoError(t, err)
+	sip.ACL = a
+	defer func() { sip.ACL = acl.AllowAll() }()
+
+	oldAS := &net.UDPAddr{IP: net.ParseIP("192.0.2.50"), Port: 5060}
+	newAS := &net.UDPAddr{IP: net.ParseIP("192.0.2.60"), Port: 5060}
+	sip.ResolveAS()
+	require.True(t, sip.IsAS(oldAS))
+	require.True(t, sip.Trusted(oldAS))
+	require.False(t, sip.IsAS(newAS))
+
+	sip.ASUserAgent.SetUDPAddr(newAS) // AS hostname now resolving elsewhere
+	require.True(t, sip.IsAS(oldAS), "until resolved again")
+	sip.ResolveAS()
+	require.False(t, sip.IsAS(oldAS))
+	require.False(t, sip.Trusted(oldAS))
+	require.True(t, sip.IsAS(newAS))
+
+	require.True(t, sip.IsAS(&net.UDPAddr{IP: net.ParseIP("198.51.100.7"), Port: 5060}), "peer with the AS role")
+	carrier := &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 5060}
+	require.False(t, sip.IsAS(carrier))
+	require.True(t, sip.Trusted(carrier))
+	require.False(t, sip.Trusted(nil))
+}
@@ -1,6 +1,9 @@
 package sip
 
 import (
+	"bytes"
+	"fmt"
+
 	. "SRGo/global"
 
 	"github.com/Moatassem/sdp"
@@ -52,7 +55,24 @@ func NewInData(binbytes []byte) *MessageBody {
 	return &MessageBody{PartsContents: map[BodyType]ContentPart{AppJson: {hdrs, binbytes}}}
 }
 
+func NewDTMFRelay(signal string, durationMS int) *MessageBody {
+	ct := NewContentPart(DTMFRelay, fmt.Appendf(nil, "Signal=%s\r\nDuration=%d\r\n", signal, durationMS))
+	return &MessageBody{PartsContents: map[BodyType]ContentPart{DTMFRelay: ct}}
+}
+
 func (msgbody *MessageBody) ContainsSDP() bool {
 	_, ok := msgbody.PartsContents[SDP]
 	return ok
 }
+
+// Clone returns a deep copy of the body parts, its SDP session to be parsed again from the copied bytes
+func (msgbody *MessageBody) Clone() *MessageBody {
+	if msgbody == nil {
+		return nil
+	}
+	cl := NewBody()
+	for bt, ct := range msgbody.PartsContents {
+		cl.PartsContents[bt] = ContentPart{Headers: NewSHsFromMap(ct.Headers.InternalMap()), Bytes: bytes.Clone(ct.Bytes)}
+	}
+	return cl
+}
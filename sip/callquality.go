@@ -0,0 +1,160 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"SRGo/codec"
+	. "SRGo/global"
+	"SRGo/rtcp"
+)
+
+const srHistory = 8 // SRs relayed to a remote remembered for RTT calculation
+
+type (
+	// QualityStats summarizes the RTCP receiver reports sent by a call leg remote i.e. the quality of the media it received
+	QualityStats struct {
+		JitterMS    float64 // mean interarrival jitter
+		MaxJitterMS float64
+		LossPct     float64 // mean fraction lost
+		RTTMS       float64 // mean round-trip time between SRGo and the remote, 0 if unknown
+		MOS         float64 // E-model estimate
+		Lost        int32   // last cumulative number of packets lost
+		Reports     int
+	}
+
+	callQuality struct {
+		srSent    [srHistory]relayedSR
+		jitterSum float64
+		maxJitter float64
+		lossSum   float64
+		rttSum    float64
+		rttCount  int
+		reports   int
+		lost      int32
+		srNext    int
+		mu        sync.Mutex
+	}
+
+	relayedSR struct {
+		at        time.Time
+		ntpMiddle uint32
+	}
+)
+
+// inspectRTCP updates the quality stats of the session with the RTCP received from its remote.
+// SRs are remembered on the linked session as they are relayed to its remote, to calculate the RTT when echoed back in its RRs
+func (ss *SipSession) inspectRTCP(ms *MediaStream, pkt []byte) {
+	if ms.Kind != "" && ms.Kind != "audio" {
+		return
+	}
+	reports, _ := rtcp.Parse(pkt)
+	if len(reports) == 0 {
+		return
+	}
+	now := time.Now()
+	lnkdss := ss.LinkedSession
+	q := &ss.quality
+	for _, rpt := range reports {
+		if rpt.Type == rtcp.TypeSR && lnkdss != nil {
+			lnkdss.quality.relaySR(rpt.NTPMiddle, now)
+		}
+		for _, blk := range rpt.Blocks {
+			q.addBlock(blk, now)
+		}
+	}
+}
+
+func (q *callQuality) relaySR(ntpMiddle uint32, at time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.srSent[q.srNext] = relayedSR{ntpMiddle: ntpMiddle, at: at}
+	q.srNext = (q.srNext + 1) % srHistory
+}
+
+func (q *callQuality) addBlock(blk rtcp.ReportBlock, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jitter := float64(blk.Jitter) * 1000 / codec.G711ClockRate // narrowband audio clock assumed
+	q.reports++
+	q.jitterSum += jitter
+	q.maxJitter = max(q.maxJitter, jitter)
+	q.lossSum += float64(blk.FractionLost) * 100 / 256
+	q.lost = blk.CumulativeLost
+	if blk.LSR == 0 {
+		return
+	}
+	for _, sr := range q.srSent {
+		if sr.ntpMiddle != blk.LSR || sr.at.IsZero() {
+			continue
+		}
+		dlsr := time.Duration(blk.DLSR) * time.Second / 65536
+		if rtt := now.Sub(sr.at) - dlsr; rtt >= 0 {
+			q.rttSum += float64(rtt.Microseconds()) / 1000
+			q.rttCount++
+		}
+		return
+	}
+}
+
+// Quality returns the media quality stats reported by the session remote, false if no RTCP report was received
+func (ss *SipSession) Quality() (QualityStats, bool) {
+	q := &ss.quality
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.reports == 0 {
+		return QualityStats{}, false
+	}
+	stats := QualityStats{
+		JitterMS:    q.jitterSum / float64(q.reports),
+		MaxJitterMS: q.maxJitter,
+		LossPct:     q.lossSum / float64(q.reports),
+		Lost:        q.lost,
+		Reports:     q.reports,
+	}
+	if q.rttCount > 0 {
+		stats.RTTMS = q.rttSum / float64(q.rttCount)
+	}
+	stats.MOS = rtcp.EstimateMOS(stats.RTTMS, stats.JitterMS, stats.LossPct)
+	return stats, true
+}
+
+// callQuality returns the worst stats of both call legs
+func (ss *SipSession) callQuality() (QualityStats, bool) {
+	stats, ok := ss.Quality()
+	if lnkdss := ss.LinkedSession; lnkdss != nil {
+		if other, ok2 := lnkdss.Quality(); ok2 {
+			if !ok || other.MOS < stats.MOS {
+				stats.MOS = other.MOS
+			}
+			stats.JitterMS = max(stats.JitterMS, other.JitterMS)
+			stats.MaxJitterMS = max(stats.MaxJitterMS, other.MaxJitterMS)
+			stats.LossPct = max(stats.LossPct, other.LossPct)
+			stats.RTTMS = max(stats.RTTMS, other.RTTMS)
+			stats.Lost = max(stats.Lost, other.Lost)
+			stats.Reports += other.Reports
+			ok = true
+		}
+	}
+	return stats, ok
+}
+
+// observeQuality exports the quality stats of the session leg when released
+func (ss *SipSession) observeQuality() {
+	stats, ok := ss.Quality()
+	if !ok {
+		return
+	}
+	Prometrics.CallMOS.Observe(stats.MOS)
+	Prometrics.CallJitter.Observe(stats.JitterMS)
+	Prometrics.CallPacketLoss.Observe(stats.LossPct)
+	if stats.RTTMS > 0 {
+		Prometrics.CallRoundTrip.Observe(stats.RTTMS)
+	}
+	ss.logInfo(LTMediaStack, "Call leg quality", "mos", stats.MOS, "jitterMs", stats.JitterMS, "lossPercent", stats.LossPct, "rttMs", stats.RTTMS, "reports", stats.Reports)
+}
+
+func (qs QualityStats) String() string {
+	return fmt.Sprintf("MOS: %.2f, Jitter: %.1fms, Loss: %.2f%%, RTT: %.0fms", qs.MOS, qs.JitterMS, qs.LossPct, qs.RTTMS)
+}
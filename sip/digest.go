@@ -0,0 +1,189 @@
+package sip
+
+import (
+	"crypto/md5" //nolint:gosec // mandated by RFC 2617
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	. "SRGo/global"
+	"SRGo/guid"
+	"SRGo/sip/status"
+)
+
+// DigestChallenge is a parsed WWW-Authenticate or Proxy-Authenticate header, RFC 2617 & RFC 8760
+type DigestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	QOP       string // "auth" when offered, "" for the legacy RFC 2069 scheme
+	Stale     bool
+}
+
+// ParseDigestChallenge parses a Digest challenge, only MD5 and SHA-256 algorithms are supported
+func ParseDigestChallenge(header string) (*DigestChallenge, error) {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, fmt.Errorf("unsupported authentication scheme %q", scheme)
+	}
+	ch := &DigestChallenge{Algorithm: "MD5"}
+	for _, p := range splitDigestParams(params) {
+		k, v, _ := strings.Cut(p, "=")
+		v = strings.Trim(strings.TrimSpace(v), `"`)
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "realm":
+			ch.Realm = v
+		case "nonce":
+			ch.Nonce = v
+		case "opaque":
+			ch.Opaque = v
+		case "algorithm":
+			ch.Algorithm = strings.ToUpper(v)
+		case "stale":
+			ch.Stale = strings.EqualFold(v, "true")
+		case "qop":
+			for q := range strings.SplitSeq(v, ",") {
+				if strings.EqualFold(strings.TrimSpace(q), "auth") {
+					ch.QOP = "auth"
+				}
+			}
+		}
+	}
+	if ch.Nonce == "" {
+		return nil, fmt.Errorf("missing nonce")
+	}
+	if ch.newHash() == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", ch.Algorithm)
+	}
+	return ch, nil
+}
+
+// splitDigestParams splits comma separated parameters, ignoring commas within quotes
+func splitDigestParams(s string) []string {
+	var params []string
+	var quoted bool
+	start := 0
+	for i := range len(s) {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, s[start:])
+}
+
+func (ch *DigestChallenge) newHash() hash.Hash {
+	switch ch.Algorithm {
+	case "MD5":
+		return md5.New() //nolint:gosec
+	case "SHA-256":
+		return sha256.New()
+	}
+	return nil
+}
+
+func (ch *DigestChallenge) digest(parts ...string) string {
+	h := ch.newHash()
+	h.Write([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Authorization returns the Authorization or Proxy-Authorization header value answering the challenge.
+// nc is the count of requests sent with the challenge nonce, cnonce is only used with qop
+func (ch *DigestChallenge) Authorization(username, password, method, uri string, nc int, cnonce string) string {
+	ha1 := ch.digest(username, ch.Realm, password)
+	ha2 := ch.digest(method, uri)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `Digest username="%s", realm="%s", nonce="%s", uri="%s"`, username, ch.Realm, ch.Nonce, uri)
+	if ch.QOP != "" {
+		ncs := fmt.Sprintf("%08x", nc)
+		fmt.Fprintf(&sb, `, response="%s", qop=%s, nc=%s, cnonce="%s"`, ch.digest(ha1, ch.Nonce, ncs, cnonce, ch.QOP, ha2), ch.QOP, ncs, cnonce)
+	} else {
+		fmt.Fprintf(&sb, `, response="%s"`, ch.digest(ha1, ch.Nonce, ha2))
+	}
+	fmt.Fprintf(&sb, ", algorithm=%s", ch.Algorithm)
+	if ch.Opaque != "" {
+		fmt.Fprintf(&sb, `, opaque="%s"`, ch.Opaque)
+	}
+	return sb.String()
+}
+
+// authorizeChallenge returns the authorization header answering the 401/407 challenge of the transaction,
+// failing if the challenged request already carried credentials and the nonce is not stale
+func authorizeChallenge(trans *Transaction, sipmsg *SipMessage, username, password string) (string, string, error) {
+	challengeHdr, authHdr := WWW_Authenticate, Authorization
+	if sipmsg.StartLine.StatusCode == status.ProxyAuthenticationRequired {
+		challengeHdr, authHdr = Proxy_Authenticate, Proxy_Authorization
+	}
+	ch, err := ParseDigestChallenge(sipmsg.Headers.ValueHeader(challengeHdr))
+	if err != nil {
+		return "", "", fmt.Errorf("bad challenge: %w", err)
+	}
+	if trans.RequestMessage.Headers.HeaderNameExists(authHdr) && !ch.Stale {
+		return "", "", errors.New("credentials rejected")
+	}
+	ruri := trans.RequestMessage.StartLine.RUri
+	return authHdr.String(), ch.Authorization(username, password, trans.Method.String(), ruri, 1, guid.NewTag()), nil
+}
+
+// credentials returns the digest credentials of the outbound session: its route ones, otherwise its trunk ones
+func (ss *SipSession) credentials() (string, string) {
+	if rd := ss.RoutingData(); rd != nil && rd.AuthUsername != "" {
+		return rd.AuthUsername, rd.AuthPassword
+	}
+	if ss.trunk != nil {
+		return ss.trunk.AuthUsername, ss.trunk.Password
+	}
+	return "", ""
+}
+
+// answerChallenge re-sends the outbound INVITE challenged by a 401/407 with the session credentials,
+// with a new CSeq and branch and transparently to the inbound leg. Returns false when the challenge cannot be answered
+func (ss *SipSession) answerChallenge(trans *Transaction, sipmsg *SipMessage) bool {
+	username, password := ss.credentials()
+	if username == "" {
+		return false
+	}
+	if trans.IsACKed { // retransmitted challenge, already answered: its ACK is sent again (RFC 3261 17.1.1.2)
+		if trans.ACKTransaction != nil {
+			ss.SendSTMessage(trans.ACKTransaction)
+		}
+		return true
+	}
+	authHeader, authValue, err := authorizeChallenge(trans, sipmsg, username, password)
+	if err != nil {
+		ss.logWarning(LTSIPStack, "Unable to answer INVITE challenge", "username", username, "error", err)
+		return false
+	}
+	ss.SendCreatedRequest(ACK, trans, ZeroBody())
+
+	prev := trans.RequestMessage
+	ss.ToTag = "" // of the challenge response
+	ss.ToHeader = prev.Headers.ValueHeader(To)
+
+	st := ss.addOutgoingRequest(INVITE, nil)
+	sl := *prev.StartLine
+	hdrs := NewSHsFromMap(prev.Headers.InternalMap())
+	hdrs.SetHeader(Via, fmt.Sprintf("%s;branch=%s", GenerateViaWithoutBranch(ss.UDPListenser()), st.ViaBranch))
+	hdrs.SetHeader(CSeq, fmt.Sprintf("%s %s", Uint32ToStr(st.CSeq), INVITE.String()))
+	hdrs.Set(authHeader, authValue)
+
+	sipmsg2 := &SipMessage{MsgType: REQUEST, StartLine: &sl, Headers: &hdrs, Body: prev.Body, MaxFwds: prev.MaxFwds}
+	st.From, st.To = trans.From, ss.ToHeader
+	st.RequestMessage = sipmsg2
+	st.SentMessage = sipmsg2
+
+	ss.logDebug(LTSIPStack, "Answering INVITE challenge", "username", username, "statusCode", sipmsg.StartLine.StatusCode)
+	ss.SendSTMessage(st)
+	return true
+}
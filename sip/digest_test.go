@@ -0,0 +1,35 @@
+package sip_test
+
+import (
+	"SRGo/sip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	t.Parallel()
+
+	// RFC 2617 section 3.5 example
+	ch, err := sip.ParseDigestChallenge(`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	require.NoError(t, err)
+	require.Equal(t, "testrealm@host.com", ch.Realm)
+	require.Equal(t, "auth", ch.QOP)
+	require.Equal(t, "MD5", ch.Algorithm)
+
+	auth := ch.Authorization("Mufasa", "Circle Of Life", "GET", "/dir/index.html", 1, "0a4f113b")
+	require.Contains(t, auth, `response="6629fae49393a05397450978507c4ef1"`)
+	require.Contains(t, auth, `nc=00000001, cnonce="0a4f113b"`)
+	require.Contains(t, auth, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+
+	ch, err = sip.ParseDigestChallenge(`Digest realm="sip.example.com", nonce="abc", algorithm=SHA-256, stale=TRUE`)
+	require.NoError(t, err)
+	require.True(t, ch.Stale)
+	require.Empty(t, ch.QOP)
+	require.Contains(t, ch.Authorization("bob", "secret", "INVITE", "sip:100@sip.example.com", 1, ""), "algorithm=SHA-256")
+
+	_, err = sip.ParseDigestChallenge(`Basic realm="x"`)
+	require.Error(t, err)
+	_, err = sip.ParseDigestChallenge(`Digest realm="x", nonce="n", algorithm=MD5-sess`)
+	require.Error(t, err)
+}
@@ -0,0 +1,368 @@
+package sip
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"SRGo/codec"
+	. "SRGo/global"
+
+	"github.com/Moatassem/sdp"
+)
+
+type (
+	DTMFMode string
+
+	// DTMFEvent is a DTMF digit interworked between the call legs
+	DTMFEvent struct {
+		Time       time.Time `json:"time"`
+		Signal     string    `json:"signal"`
+		DurationMS int       `json:"durationMs"`
+		ReceivedAs DTMFMode  `json:"receivedAs"`
+		SentAs     DTMFMode  `json:"sentAs"`
+		FromLeg    string    `json:"fromLeg"`
+	}
+
+	// dtmfDetector follows RFC 4733 events received on a stream, an event being identified by its RTP timestamp
+	dtmfDetector struct {
+		ts      uint32
+		started bool
+		ended   bool
+	}
+)
+
+const (
+	DTMFTransparent DTMFMode = "Transparent" // DTMF relayed as received
+	DTMFRFC4733     DTMFMode = "RFC4733"     // called side uses RFC 4733 telephone-event, calling side SIP INFO
+	DTMFINFO        DTMFMode = "INFO"        // called side uses SIP INFO, calling side RFC 4733 telephone-event
+)
+
+const (
+	telephoneEvent         = "telephone-event"
+	defaultTEPayload uint8 = 101
+	dtmfPacketMS           = 50  // RFC 4733 event packets interval
+	dtmfDefaultMS          = 160 // used when INFO has no Duration
+	dtmfEndPackets         = 3   // end of event packets are sent 3 times
+	dtmfVolume             = 10  // -dBm0
+)
+
+var dtmfSignals = func() map[byte]string {
+	m := make(map[byte]string, len(DicDTMFSignal))
+	for s, e := range DicDTMFSignal {
+		m[e] = s
+	}
+	return m
+}()
+
+func (dm DTMFMode) IsValid() bool {
+	return dm == DTMFTransparent || dm == DTMFRFC4733 || dm == DTMFINFO
+}
+
+// dtmfMethod returns the DTMF method used on this leg, Transparent when no interworking applies
+func (ss *SipSession) dtmfMethod() DTMFMode {
+	rd := ss.RoutingData()
+	if rd == nil || !rd.SteerMedia || rd.DTMFMode == "" || rd.DTMFMode == DTMFTransparent {
+		return DTMFTransparent
+	}
+	if ss.Direction == OUTBOUND {
+		return rd.DTMFMode
+	}
+	if rd.DTMFMode == DTMFINFO {
+		return DTMFRFC4733
+	}
+	return DTMFINFO
+}
+
+func (ss *SipSession) DTMFEvents() []DTMFEvent {
+	inss := ss.inboundLeg()
+	inss.dtmfMutex.Lock()
+	defer inss.dtmfMutex.Unlock()
+	return append([]DTMFEvent(nil), inss.dtmfEvents...)
+}
+
+// logDTMF adds the event to the call DTMF log, kept on the inbound leg
+func (ss *SipSession) logDTMF(signal string, durationMS int, received, sent DTMFMode) {
+	inss := ss.inboundLeg()
+	inss.dtmfMutex.Lock()
+	inss.dtmfEvents = append(inss.dtmfEvents, DTMFEvent{Time: time.Now(), Signal: signal, DurationMS: durationMS, ReceivedAs: received, SentAs: sent, FromLeg: ss.Direction.String()})
+	inss.dtmfMutex.Unlock()
+	inss.logInfo(LTDTMF, "DTMF interworked", "signal", signal, "durationMs", durationMS, "receivedAs", received, "fromLeg", ss.Direction.String(), "sentAs", sent)
+}
+
+// =================================================================================================
+// SDP negotiation
+
+// negotiateDTMF learns the telephone-event payload type of the linked leg remote from the SDP it sent,
+// then adapts this SDP to the DTMF method of this leg: telephone-event stripped for INFO, added for RFC 4733
+func (ss *SipSession) negotiateDTMF(sdpSession *sdp.Session) {
+	method := ss.dtmfMethod()
+	if method == DTMFTransparent {
+		return
+	}
+	media := firstAudioMedia(sdpSession)
+	if media == nil {
+		return
+	}
+	pt, found := telephoneEventPayload(media)
+	if found {
+		if lnkdss := ss.LinkedSession; lnkdss != nil {
+			lnkdss.dtmfPayload.Store(uint32(pt))
+		}
+	}
+	switch method {
+	case DTMFINFO:
+		removeTelephoneEvent(media)
+	case DTMFRFC4733:
+		if found {
+			if ss.dtmfPayload.Load() == 0 {
+				ss.dtmfPayload.Store(uint32(pt))
+			}
+			return
+		}
+		pt = uint8(ss.dtmfPayload.Load()) // learned from this leg remote offer, if any
+		if pt == 0 {
+			pt = freeDynamicPayload(media)
+			ss.dtmfPayload.Store(uint32(pt))
+		}
+		media.Format = append(media.Format, &sdp.Format{Payload: pt, Name: telephoneEvent, ClockRate: 8000, Params: []string{"0-16"}})
+	}
+}
+
+func firstAudioMedia(sdpSession *sdp.Session) *sdp.Media {
+	for _, media := range sdpSession.Media {
+		if media.Type == "audio" && media.Port != 0 {
+			return media
+		}
+	}
+	return nil
+}
+
+func telephoneEventPayload(media *sdp.Media) (uint8, bool) {
+	for _, f := range media.Format {
+		if strings.EqualFold(f.Name, telephoneEvent) && (f.ClockRate == 0 || f.ClockRate == 8000) {
+			return f.Payload, true
+		}
+	}
+	return 0, false
+}
+
+func removeTelephoneEvent(media *sdp.Media) {
+	formats := media.Format[:0]
+	for _, f := range media.Format {
+		if !strings.EqualFold(f.Name, telephoneEvent) {
+			formats = append(formats, f)
+		}
+	}
+	media.Format = formats
+}
+
+func freeDynamicPayload(media *sdp.Media) uint8 {
+	used := make(map[uint8]bool, len(media.Format))
+	for _, f := range media.Format {
+		used[f.Payload] = true
+	}
+	if !used[defaultTEPayload] {
+		return defaultTEPayload
+	}
+	for pt := uint8(96); pt <= 127; pt++ {
+		if !used[pt] {
+			return pt
+		}
+	}
+	return defaultTEPayload
+}
+
+// =================================================================================================
+// RFC 4733 -> SIP INFO
+
+// interceptDTMF consumes telephone-event packets received on a leg using RFC 4733 while the linked leg uses INFO.
+// Returns true if the packet must not be relayed
+func (ss *SipSession) interceptDTMF(ms *MediaStream, pkt []byte) bool {
+	if ms.Kind != "audio" && ms.Kind != "" {
+		return false
+	}
+	tept := ss.dtmfPayload.Load()
+	if tept == 0 || len(pkt) < 16 || uint32(pkt[1]&0x7F) != tept || ss.dtmfMethod() != DTMFRFC4733 {
+		return false
+	}
+	payload, ok := rtpPayload(pkt)
+	if !ok || len(payload) < 4 {
+		return true
+	}
+	ts := binary.BigEndian.Uint32(pkt[4:8])
+	event := payload[0]
+	ended := payload[1]&0x80 != 0
+	duration := int(binary.BigEndian.Uint16(payload[2:4])) / 8 // ms at 8 kHz
+
+	det := &ms.dtmfRx
+	if !det.started || det.ts != ts {
+		det.ts, det.started, det.ended = ts, true, false
+	}
+	if ended && !det.ended {
+		det.ended = true
+		signal, ok := dtmfSignals[event]
+		if !ok {
+			return true
+		}
+		ss.logDTMF(signal, duration, DTMFRFC4733, DTMFINFO)
+		if lnkdss := ss.LinkedSession; lnkdss != nil {
+			go lnkdss.sendDTMFInfo(signal, duration)
+		}
+	}
+	return true
+}
+
+func (ss *SipSession) sendDTMFInfo(signal string, durationMS int) {
+	if !ss.IsEstablished() {
+		return
+	}
+	ss.SendCreatedRequest(INFO, nil, NewDTMFRelay(signal, durationMS))
+}
+
+// =================================================================================================
+// SIP INFO -> RFC 4733
+
+// handleDTMFInfo answers an INFO carrying DTMF on a leg using INFO and plays it as RFC 4733 on the linked leg.
+// Returns false if the INFO does not carry DTMF, to be relayed as is
+func (ss *SipSession) handleDTMFInfo(trans *Transaction, sipmsg *SipMessage) bool {
+	signal, durationMS, ok := sipmsg.GetDTMF()
+	if !ok {
+		return false
+	}
+	ss.SendCreatedResponse(trans, 200, ZeroBody())
+	ss.logDTMF(signal, durationMS, DTMFINFO, DTMFRFC4733)
+
+	lnkdss := ss.LinkedSession
+	if lnkdss == nil {
+		return true
+	}
+	var lnkdms *MediaStream
+	for _, ms := range lnkdss.MediaStreams() {
+		if ms.Kind == "audio" {
+			lnkdms = ms
+			break
+		}
+	}
+	tept := uint8(lnkdss.dtmfPayload.Load())
+	if lnkdms == nil || tept == 0 {
+		lnkdss.logWarning(LTDTMF, "No telephone-event negotiated - DTMF dropped", "signal", signal)
+		return true
+	}
+	go lnkdms.sendDTMF(tept, DicDTMFSignal[signal], durationMS)
+	return true
+}
+
+// sendDTMF injects RFC 4733 event packets into the RTP stream sent to the stream remote
+func (ms *MediaStream) sendDTMF(pt uint8, event byte, durationMS int) {
+	rmt := ms.RemoteUdpAddr()
+	if rmt == nil {
+		return
+	}
+	ts := ms.out.eventTimestamp()
+
+	send := func(ep codec.EventPacket) {
+		pkt := make([]byte, 16)
+		pkt[0] = 0x80
+		pkt[1] = pt
+		if ep.Marker {
+			pkt[1] |= 0x80
+		}
+		ssrc, seq := ms.out.injectSeq()
+		binary.BigEndian.PutUint16(pkt[2:4], seq)
+		binary.BigEndian.PutUint32(pkt[4:8], ts+ep.TSOffset)
+		binary.BigEndian.PutUint32(pkt[8:12], ssrc)
+		pkt[12] = event
+		pkt[13] = dtmfVolume
+		if ep.End {
+			pkt[13] |= 0x80
+		}
+		binary.BigEndian.PutUint16(pkt[14:16], ep.Duration)
+		_, _ = ms.Pair.RTP.WriteToUDP(pkt, rmt)
+	}
+
+	packets := codec.EventPackets(durationMS, dtmfPacketMS, dtmfEndPackets)
+	ticker := time.NewTicker(dtmfPacketMS * time.Millisecond)
+	defer ticker.Stop()
+	for i, ep := range packets {
+		send(ep)
+		// wait for the next interval, unless the next packet starts a new segment
+		if !ep.End && i+1 < len(packets) && packets[i+1].TSOffset == ep.TSOffset {
+			<-ticker.C
+		}
+	}
+}
+
+// =================================================================================================
+// RTP sent on a stream
+
+// rtpHeaderLen returns the RTP header length, CSRCs and header extension included
+func rtpHeaderLen(pkt []byte) (int, bool) {
+	offset := 12 + 4*int(pkt[0]&0x0F)
+	if pkt[0]&0x10 != 0 { // header extension
+		if len(pkt) < offset+4 {
+			return 0, false
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(pkt[offset+2:offset+4]))
+	}
+	return offset, offset <= len(pkt)
+}
+
+// rtpPayload returns the RTP payload, padding excluded
+func rtpPayload(pkt []byte) ([]byte, bool) {
+	offset, ok := rtpHeaderLen(pkt)
+	if !ok {
+		return nil, false
+	}
+	end := len(pkt)
+	if pkt[0]&0x20 != 0 && end > offset {
+		end -= int(pkt[end-1])
+	}
+	if end < offset {
+		return nil, false
+	}
+	return pkt[offset:end], true
+}
+
+// eventTimestamp estimates the current timestamp of the sent RTP stream
+func (out *rtpOut) eventTimestamp() uint32 {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if !out.active {
+		out.ssrc = rand.Uint32()
+		out.lastSeq = uint16(rand.UintN(1 << 16))
+		out.lastTS = rand.Uint32()
+		out.lastSent = time.Now()
+		out.active = true
+	}
+	return out.lastTS + uint32(time.Since(out.lastSent).Milliseconds()*8)
+}
+
+// injectSeq reserves the next sequence number, shifting the relayed packets that follow
+func (out *rtpOut) injectSeq() (uint32, uint16) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.lastSeq++
+	out.seqOffset++
+	return out.ssrc, out.lastSeq
+}
+
+// relay rewrites the packet sequence number after injected packets and sends it
+func (ms *MediaStream) relay(pkt []byte, rmt *net.UDPAddr) {
+	out := &ms.out
+	if len(pkt) >= 12 && pkt[0]>>6 == 2 {
+		out.mu.Lock()
+		if ssrc := binary.BigEndian.Uint32(pkt[8:12]); !out.active || ssrc != out.ssrc {
+			out.ssrc, out.seqOffset, out.active = ssrc, 0, true
+		}
+		seq := binary.BigEndian.Uint16(pkt[2:4]) + out.seqOffset
+		binary.BigEndian.PutUint16(pkt[2:4], seq)
+		out.lastSeq = seq
+		out.lastTS = binary.BigEndian.Uint32(pkt[4:8])
+		out.lastSent = time.Now()
+		out.mu.Unlock()
+	}
+	_, _ = ms.Pair.RTP.WriteToUDP(pkt, rmt)
+}
@@ -0,0 +1,74 @@
+package sip
+
+import (
+	"strings"
+
+	. "SRGo/global"
+	"SRGo/q850"
+	"SRGo/sip/status"
+)
+
+// routeENUM resolves the called userpart through ENUM when the route has an enumSuffix, routing the call to the best SIP URI found.
+// Without ENUM answer the route own outRuriHostport, if any, is kept. Returns false when the call got rejected
+func (ss1 *SipSession) routeENUM(trans1 *Transaction, upart2 *string) bool {
+	rd := ss1.RoutingData()
+	uris, err := DNSResolver.ENUM(*upart2, rd.ENUMSuffix)
+	if err != nil {
+		ss1.logWarning(LTExternalData, "ENUM lookup failed", "number", *upart2, "suffix", rd.ENUMSuffix, "error", err)
+	}
+	for _, uri := range uris {
+		user, hostport, ok := splitSIPURI(uri)
+		if !ok {
+			continue
+		}
+		skt, err := BuildUdpSocket(hostport, SipPort)
+		if err == nil {
+			_, err = skt.Targets()
+		}
+		if err != nil {
+			ss1.logWarning(LTExternalData, "ENUM target unresolvable", "uri", uri, "error", err)
+			continue
+		}
+		rdc := *rd // per call copy, as its target depends on the number
+		rdc.RemoteUDPSocket = skt
+		ss1.SetRoutingData(&rdc)
+		if user != "" {
+			*upart2 = user
+		}
+		ss1.logDebug(LTExternalData, "ENUM routed", "uri", uri)
+		return true
+	}
+	if rd.RemoteUDPSocket != nil {
+		return true
+	}
+	if err != nil {
+		ss1.RejectMe(trans1, status.ServiceUnavailable, q850.TemporaryFailure, "ENUM lookup failed")
+	} else {
+		ss1.RejectMe(trans1, status.NotFound, q850.UnallocatedNumber, "No ENUM record found")
+	}
+	return false
+}
+
+// splitSIPURI returns the userpart (with its parameters) and hostport of a sip: or sips: URI
+func splitSIPURI(uri string) (string, string, bool) {
+	var rest string
+	switch lower := strings.ToLower(uri); {
+	case strings.HasPrefix(lower, "sips:"):
+		rest = uri[5:]
+	case strings.HasPrefix(lower, "sip:"):
+		rest = uri[4:]
+	default:
+		return "", "", false
+	}
+	if i := strings.IndexAny(rest, "?>"); i >= 0 {
+		rest = rest[:i]
+	}
+	user, hostport, found := strings.Cut(rest, "@")
+	if !found {
+		user, hostport = "", rest
+	}
+	if i := strings.IndexByte(hostport, ';'); i >= 0 {
+		hostport = hostport[:i]
+	}
+	return user, hostport, hostport != ""
+}
@@ -0,0 +1,59 @@
+package sip
+
+import (
+	"SRGo/events"
+	. "SRGo/global"
+)
+
+// publishEvent publishes a call event identified by the inbound leg, set fills the event specific fields
+func (ss *SipSession) publishEvent(t events.Type, set func(e *events.Event)) {
+	if !EventBus.Active() {
+		return
+	}
+	inss := ss.inboundLeg()
+	e := events.Event{
+		Type:   t,
+		CallID: inss.CallID,
+		From:   GetURIUsername(inss.FromHeader),
+		To:     GetURIUsername(inss.ToHeader),
+		Route:  inss.trafficRoute,
+		Peer:   inss.trafficPeer,
+	}
+	if set != nil {
+		set(&e)
+	}
+	EventBus.Publish(e)
+}
+
+// party names the side of the call the session remote is
+func (ss *SipSession) party() string {
+	if ss.Direction == INBOUND {
+		return "caller"
+	}
+	return "callee"
+}
+
+// setHeld records whether the session remote put the call on hold, publishing the change
+func (ss *SipSession) setHeld(held bool) {
+	if ss.isHeld.Swap(held) == held {
+		return
+	}
+	t := events.Resume
+	if held {
+		t = events.Hold
+	}
+	ss.publishEvent(t, func(e *events.Event) { e.Party = ss.party() })
+}
+
+// publishRelease is called once when the inbound session of a routed call is dropped
+func (ss *SipSession) publishRelease() {
+	if ss.trafficRoute == "" {
+		return
+	}
+	ss.publishEvent(events.Release, func(e *events.Event) {
+		e.StatusCode = ss.FinalStatusCode()
+		if cause := ss.terminationCause.Load(); cause != nil {
+			e.Cause = *cause
+		}
+	})
+}
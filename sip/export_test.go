@@ -0,0 +1,106 @@
+package sip
+
+import (
+	"SRGo/guid"
+	"time"
+
+	. "SRGo/global"
+
+	"github.com/Moatassem/sdp"
+)
+
+// test access to the unexported call counting
+var (
+	CallStarted = (*TrafficCounters).callStarted
+	CallEnded   = (*TrafficCounters).callEnded
+)
+
+func (ss *SipSession) CountCallStart(peer string) { ss.countCallStart(peer) }
+
+func (ss *SipSession) CountPeerFailed(code int) { ss.countPeerFailed(code) }
+
+var ExpireLadders = expireLadders
+
+// LadderOf returns the entries of a new ladder the given start lines are added to
+func LadderOf(startLines ...string) []LadderEntry {
+	l := newLadder()
+	for _, sl := range startLines {
+		l.add(LadderEntry{StartLine: sl})
+	}
+	return l.Entries()
+}
+
+// RetainLadder retains the ladder of a dropped call with a single message
+func RetainLadder(callID string) {
+	ss := NewSS(INBOUND)
+	ss.CallID = callID
+	ss.ladder = newLadder()
+	ss.ladder.add(LadderEntry{CallID: callID})
+	ss.retainLadder()
+}
+
+// NewSessionOf returns the session created for a received message, and whether it traces its ladder
+func NewSessionOf(payload []byte) (*SipSession, bool) {
+	sipmsg, _, err := processPDU(payload)
+	if err != nil {
+		panic(err)
+	}
+	ss, _ := sessionGetter(sipmsg)
+	return ss, ss.ladder != nil
+}
+
+func (ss *SipSession) CountCallEnd() { ss.countCallEnd() }
+
+// SetFromServer marks the record as returned by the routing server
+func (rr *RoutingRecord) SetFromServer() { rr.fromServer = true }
+
+// AddTransactionOf adds a transaction in the session direction, with the responses it already got
+func (ss *SipSession) AddTransactionOf(method Method, responses ...int) *Transaction {
+	trans := NewST()
+	trans.Method = method
+	trans.Direction = ss.Direction
+	trans.ViaBranch = guid.NewViaBranch()
+	trans.CSeq = 1
+	trans.Responses = responses
+	ss.AddTransaction(trans)
+	return trans
+}
+
+// ReceiveResponse processes a response received to the transaction
+func (ss *SipSession) ReceiveResponse(trans *Transaction, code int) {
+	ss.addIncomingResponse(&SipMessage{
+		MsgType:    RESPONSE,
+		StartLine:  &StartLine{StatusCode: code},
+		ViaBranch:  trans.ViaBranch,
+		CSeqNum:    trans.CSeq,
+		CSeqMethod: trans.Method,
+	})
+}
+
+// SetAnsweredAt sets when the inbound session was answered
+func (ss *SipSession) SetAnsweredAt(t time.Time) { ss.answeredAt.Store(t.UnixNano()) }
+
+func (ss *SipSession) AnchorMediaStreams(sdpSession *sdp.Session) { ss.anchorMediaStreams(sdpSession) }
+
+var (
+	ResolveAS = resolveAS
+	IsAS      = isAS
+	Trusted   = trusted
+)
+
+var ProcessPDU = processPDU
+
+// NewInboundCall returns the inbound session and INVITE transaction of a received INVITE
+func NewInboundCall(payload []byte) (*SipSession, *Transaction) {
+	sipmsg, _, err := processPDU(payload)
+	if err != nil {
+		panic(err)
+	}
+	ss, _ := sessionGetter(sipmsg)
+	return ss, ss.addIncomingRequest(sipmsg, nil)
+}
+
+var (
+	RouteTargets = (*SipSession).routeTargets
+	Failover     = (*SipSession).failover
+)
@@ -0,0 +1,36 @@
+package sip
+
+import (
+	"net"
+
+	. "SRGo/global"
+	"SRGo/guard"
+)
+
+// flooding applies the flood protection to requests of untrusted sources, dropping the rest of the packet
+// when the source exceeds its request rate or is a scanner. The AS and trusted peers of the ACL are exempt
+func flooding(msg *SipMessage, src *net.UDPAddr) bool {
+	if !msg.IsRequest() || trusted(src) {
+		return false
+	}
+	reason, banned := FloodGuard.Request(src.IP, msg.Headers.ValueHeader(User_Agent))
+	if reason == "" {
+		return false
+	}
+	Prometrics.FloodDrops.WithLabelValues(reason).Inc()
+	if banned {
+		LogWarning(LTSecurity, "Source IP banned", "ip", src.IP.String(), "reason", reason, "method", msg.StartLine.Method.String(),
+			"userAgent", msg.Headers.ValueHeader(User_Agent))
+	}
+	return true
+}
+
+// rejected counts a request of src refused by the ACL or as invalid towards its ban
+func rejected(src *net.UDPAddr) {
+	if src == nil || trusted(src) {
+		return
+	}
+	if FloodGuard.Rejected(src.IP) {
+		LogWarning(LTSecurity, "Source IP banned", "ip", src.IP.String(), "reason", guard.ReasonRejected)
+	}
+}
@@ -0,0 +1,52 @@
+package sip
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	. "SRGo/global"
+)
+
+// HeaderRules manipulates the headers of the outbound INVITE of a route: headers removed first, then set
+type HeaderRules struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// headers built by the B2BUA, which rules cannot touch
+var protectedHeaders = append(MandatoryHeaders[:], "Contact", "Max-Forwards", "Content-Length", "Content-Type", "Route")
+
+func (hr *HeaderRules) Validate() error {
+	if hr == nil {
+		return nil
+	}
+	for _, h := range slices.Concat(slices.Collect(maps.Keys(hr.Set)), hr.Remove) {
+		if h == "" || strings.ContainsAny(h, ": \r\n") {
+			return fmt.Errorf("invalid header name %q", h)
+		}
+		if slices.ContainsFunc(protectedHeaders, func(p string) bool { return strings.EqualFold(p, h) }) {
+			return fmt.Errorf("header %s cannot be manipulated", h)
+		}
+	}
+	for h, v := range hr.Set {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid value of header %s", h)
+		}
+	}
+	return nil
+}
+
+// Apply is nil-safe
+func (hr *HeaderRules) Apply(headers *SipHeaders) {
+	if hr == nil {
+		return
+	}
+	for _, h := range hr.Remove {
+		headers.Delete(h)
+	}
+	for h, v := range hr.Set {
+		headers.Set(h, v)
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"runtime"
 	"time"
 
+	"SRGo/acl"
 	"SRGo/cl"
 	. "SRGo/global"
+	"SRGo/guard"
 	"SRGo/phone"
 )
 
@@ -35,16 +37,16 @@ var (
 	sippTesting               bool
 	ProxyUdpServer            *net.UDPAddr
 	RoutingEngineDB           *RoutingEngine
+	RouteServer               *RoutingServer   // nil unless a routing server is set, then the Routing DB is the fallback
+	ACL                       = acl.AllowAll() // access control of out-of-dialogue requests and trusted peers
 	ServerIPv4                net.IP
 )
 
-func readJsonFile() []byte {
-	fmt.Print("Locating Routing DB...")
-
+func readJsonFile() ([]byte, string) {
 	exePath, err := os.Executable()
 	if err != nil {
-		fmt.Println("Error getting executable path:", err)
-		return nil
+		LogError(LTConfigFiles, "Error getting executable path", "error", err)
+		return nil, ""
 	}
 	exeDir := filepath.Dir(exePath)
 
@@ -52,27 +54,26 @@ func readJsonFile() []byte {
 
 	data, err := os.ReadFile(jsonPath)
 	if err != nil {
-		fmt.Println("Error reading JSON file:", err)
-		return nil
+		LogError(LTConfigFiles, "Error reading Routing DB", "file", jsonPath, "error", err)
+		return nil, jsonPath
 	}
 
-	fmt.Println("Found:", jsonPath)
+	LogInfo(LTConfigFiles, "Routing DB found", "file", jsonPath)
 
-	return data
+	return data, jsonPath
 }
 
 func StartServer(asUdpskt *UdpSocket, ipv4 string, sup, kai, htp, indint int, uproxy string) *net.UDPConn {
-	fmt.Print("Initializing System...")
-
 	Sessions = NewConcurrentMapMutex[*SipSession](QueueSize)
 
 	SkipAS = asUdpskt == nil
 	ASUserAgent = NewSipUdpUserAgentFromSocket(asUdpskt)
+	resolveAS()
 
 	InitializeEngine()
 	MediaPortPool = NewMediaPortPool()
 
-	fmt.Println("Done")
+	LogInfo(LTSystem, "System initialized")
 
 	if SkipAS {
 		RoutingEngineDB = NewRoutingEngine()
@@ -93,10 +94,10 @@ func StartServer(asUdpskt *UdpSocket, ipv4 string, sup, kai, htp, indint int, up
 
 	if uproxy != "" {
 		if prxy, ok := BuildUdpAddr(uproxy, SipPort); !ok {
-			LogWarning(LTConfiguration, fmt.Sprintf("Bad Proxy UDP Server specified [%s] - Ignored", uproxy))
+			LogWarning(LTConfiguration, "Bad Proxy UDP Server specified - Ignored", "proxy", uproxy)
 		} else {
 			ProxyUdpServer = prxy
-			LogInfo(LTConfiguration, fmt.Sprintf("Proxy UDP Server provided [%s] - Proxy mode activated", uproxy))
+			LogInfo(LTConfiguration, "Proxy UDP Server provided - Proxy mode activated", "proxy", uproxy)
 		}
 	}
 
@@ -110,24 +111,28 @@ func StartServer(asUdpskt *UdpSocket, ipv4 string, sup, kai, htp, indint int, up
 		ServerIPv4 = net.ParseIP(ipv4)
 	}
 
-	fmt.Print("Attempting to listen on SIP...")
 	serverUDPListener, err := StartListening(ServerIPv4, SipUdpPort, DscpAF41)
 	if err != nil {
-		fmt.Println(err)
+		LogError(LTConnectivity, "Unable to listen on SIP", "error", err)
 		os.Exit(2)
 	}
+	FloodGuard = guard.New(FloodConfig, Prometrics, &WtGrp)
+	LogInfo(LTSystem, "Flood protection set", "maxRequestsPerSec", FloodConfig.MaxRequestsPerSec, "maxRejected", FloodConfig.MaxRejected,
+		"banDuration", FloodConfig.BanDuration.String())
+
 	startWorkers(serverUDPListener)
 	udpLoopWorkers(serverUDPListener)
-	fmt.Println("Success: UDP", serverUDPListener.LocalAddr().String())
+	LogInfo(LTSIPStack, "Listening on SIP", "udp", serverUDPListener.LocalAddr().String())
 
-	fmt.Print("Starting SIP Probing...")
 	WtGrp.Add(1)
 	go periodicUAProbing(serverUDPListener)
-	fmt.Println("Done")
 
-	fmt.Print("Setting Rate Limiter...")
+	WtGrp.Add(1)
+	go pruneLadders()
+	LogInfo(LTSIPStack, "SIP Probing started")
+
 	CallLimiter = cl.NewCallLimiter(RateLimit, Prometrics, &WtGrp)
-	fmt.Println("Done:", ratelimitStringer())
+	LogInfo(LTSystem, "Rate Limiter set", "limit", ratelimitStringer())
 
 	return serverUDPListener
 }
@@ -147,6 +152,7 @@ func periodicUAProbing(conn *net.UDPConn) {
 	defer WtGrp.Done()
 	ticker := time.NewTicker(time.Duration(ProbingInterval) * time.Second)
 	for range ticker.C {
+		resolveAS()
 		ProbeUA(conn, ASUserAgent)
 		for _, phne := range phone.Phones.All() {
 			if phne.IsReachable && phne.IsRegistered {
@@ -187,7 +193,7 @@ func udpLoopWorkers(conn *net.UDPConn) {
 			buf, _ := BufferPool.Get().(*[]byte)
 			n, addr, err := conn.ReadFromUDP(*buf)
 			if err != nil {
-				fmt.Println(err)
+				LogError(LTConnectivity, "Error reading SIP socket", "error", err)
 				continue
 			}
 			packetQueue <- Packet{sourceAddr: addr, buffer: buf, bytesCount: n}
@@ -203,22 +209,43 @@ func worker(conn *net.UDPConn, queue <-chan Packet) {
 }
 
 func processPacket(packet Packet, conn *net.UDPConn) {
+	defer BufferPool.Put(packet.buffer)
+	if FloodGuard.IsBanned(packet.sourceAddr.IP) {
+		Prometrics.FloodDrops.WithLabelValues(guard.ReasonBanned).Inc()
+		return
+	}
 	pdu := (*packet.buffer)[:packet.bytesCount]
 	for len(pdu) > 0 {
 		msg, pdutmp, err := processPDU(pdu)
 		if err != nil {
-			// fmt.Println("Bad PDU -", err)
-			// fmt.Println(string(pdu))
+			Prometrics.ParseErrors.Inc()
+			LogDebug(LTBadSIPMessage, "Bad PDU", "source", packet.sourceAddr.String(), "error", err, "pdu", string(pdu))
 			break
 		} else if msg == nil {
 			break
 		}
+		raw := pdu[:len(pdu)-len(pdutmp)]
+		traceIngress(msg, raw, packet.sourceAddr, conn)
 		pdu = pdutmp
+		if LogEnabled(LTSIPStack, LLDebug) {
+			LogDebug(LTSIPStack, "SIP message received", "callId", msg.CallID, "message", msg.String(), "source", packet.sourceAddr.String())
+		}
+		if msg.IsRequest() {
+			countMessage(msg, msg.StartLine.Method, INBOUND)
+		} else {
+			countMessage(msg, msg.CSeqMethod, INBOUND)
+		}
+		if flooding(msg, packet.sourceAddr) {
+			break
+		}
+		if !admitted(msg, packet.sourceAddr, conn) {
+			continue
+		}
 		ss, newSesType := sessionGetter(msg)
 		if ss != nil {
 			ss.SetRemoteUDPnListenser(packet.sourceAddr, conn)
+			ss.addLadderEntry(INBOUND, raw, packet.sourceAddr, GetUDPAddrFromConn(conn))
 		}
 		sipStack(msg, ss, newSesType)
 	}
-	BufferPool.Put(packet.buffer)
 }
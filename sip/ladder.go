@@ -0,0 +1,147 @@
+package sip
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	. "SRGo/global"
+)
+
+type (
+	// LadderEntry is a SIP message received or sent on a call leg
+	LadderEntry struct {
+		Time      time.Time `json:"time"`
+		CallID    string    `json:"callId"`
+		Direction string    `json:"direction"` // INBOUND if received, OUTBOUND if sent
+		Src       string    `json:"src"`
+		Dst       string    `json:"dst"`
+		StartLine string    `json:"startLine"`
+		Raw       string    `json:"raw"`
+	}
+
+	// ladder is the bounded ring of the SIP messages of a call, shared by both its legs
+	ladder struct {
+		entries []LadderEntry
+		next    int
+		mu      sync.Mutex
+	}
+
+	retainedLadder struct {
+		ladder  *ladder
+		endedAt time.Time
+		callID  string
+	}
+)
+
+var (
+	retainedLadders   = make(map[string]retainedLadder) // ladders of dropped sessions by Call-ID
+	retainedOrder     []retainedLadder                  // oldest dropped first, for expiry and eviction
+	retainedLaddersMu sync.Mutex
+)
+
+// newLadder returns the ladder of a new call, nil when tracing is disabled
+func newLadder() *ladder {
+	if LadderMaxMessages <= 0 {
+		return nil
+	}
+	return &ladder{}
+}
+
+func (l *ladder) add(e LadderEntry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < LadderMaxMessages {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// Entries returns the messages oldest first
+func (l *ladder) Entries() []LadderEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append(slices.Clone(l.entries[l.next:]), l.entries[:l.next]...)
+}
+
+func (session *SipSession) addLadderEntry(dir Direction, raw []byte, src, dst *net.UDPAddr) {
+	if session.ladder == nil { // not an INVITE dialog
+		return
+	}
+	startLine, _, _ := bytes.Cut(raw, []byte("\r\n"))
+	session.ladder.add(LadderEntry{
+		Time:      time.Now(),
+		CallID:    session.CallID,
+		Direction: dir.String(),
+		Src:       src.String(),
+		Dst:       dst.String(),
+		StartLine: string(startLine),
+		Raw:       string(raw),
+	})
+}
+
+// retainLadder keeps the ladder of the dropped session for the retention window,
+// evicting the oldest retained ladder beyond LadderMaxRetained
+func (session *SipSession) retainLadder() {
+	if LadderRetentionSec <= 0 || LadderMaxRetained <= 0 || session.ladder == nil {
+		return
+	}
+	rl := retainedLadder{ladder: session.ladder, endedAt: time.Now(), callID: session.CallID}
+	retainedLaddersMu.Lock()
+	defer retainedLaddersMu.Unlock()
+	retainedLadders[rl.callID] = rl
+	retainedOrder = append(retainedOrder, rl)
+	for len(retainedLadders) > LadderMaxRetained {
+		popRetainedLadder()
+	}
+}
+
+// popRetainedLadder drops the oldest retained ladder - Unsafe
+func popRetainedLadder() {
+	oldest := retainedOrder[0]
+	retainedOrder[0] = retainedLadder{}
+	retainedOrder = retainedOrder[1:]
+	if rl, ok := retainedLadders[oldest.callID]; ok && rl.endedAt.Equal(oldest.endedAt) { // not retained again since
+		delete(retainedLadders, oldest.callID)
+	}
+}
+
+// CallLadder returns the SIP messages of the call of a live or recently dropped session, both legs included
+func CallLadder(callID string) ([]LadderEntry, bool) {
+	if ss, ok := Sessions.Load(callID); ok && ss.ladder != nil {
+		return ss.ladder.Entries(), true
+	}
+	retainedLaddersMu.Lock()
+	rl, ok := retainedLadders[callID]
+	retainedLaddersMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return rl.ladder.Entries(), true
+}
+
+func pruneLadders() {
+	defer WtGrp.Done()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		expireLadders(now)
+	}
+}
+
+// expireLadders drops the ladders retained for longer than the retention window
+func expireLadders(now time.Time) {
+	retention := time.Duration(LadderRetentionSec) * time.Second
+	retainedLaddersMu.Lock()
+	defer retainedLaddersMu.Unlock()
+	for len(retainedOrder) > 0 && now.Sub(retainedOrder[0].endedAt) >= retention {
+		popRetainedLadder()
+	}
+}
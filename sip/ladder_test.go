@@ -0,0 +1,92 @@
+package sip_test
+
+import (
+	"SRGo/cl"
+	"SRGo/global"
+	"SRGo/prometheus"
+	"SRGo/sip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startLines(entries []sip.LadderEntry) []string {
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, e.StartLine)
+	}
+	return lines
+}
+
+func TestLadderRing(t *testing.T) {
+	defer func(n int) { global.LadderMaxMessages = n }(global.LadderMaxMessages)
+	global.LadderMaxMessages = 3
+
+	require.Equal(t, []string{"1", "2"}, startLines(sip.LadderOf("1", "2")))
+	require.Equal(t, []string{"1", "2", "3"}, startLines(sip.LadderOf("1", "2", "3")))
+	require.Equal(t, []string{"3", "4", "5"}, startLines(sip.LadderOf("1", "2", "3", "4", "5")), "oldest overwritten")
+	require.Equal(t, []string{"5", "6", "7"}, startLines(sip.LadderOf("1", "2", "3", "4", "5", "6", "7")))
+}
+
+func TestLadderRetention(t *testing.T) {
+	defer func(sec, maxRetained int) {
+		global.LadderRetentionSec, global.LadderMaxRetained = sec, maxRetained
+	}(global.LadderRetentionSec, global.LadderMaxRetained)
+	global.LadderRetentionSec, global.LadderMaxRetained = 60, 2
+	global.Prometrics = prometheus.NewMetrics("test")
+	sip.Sessions = sip.NewConcurrentMapMutex[*sip.SipSession](10)
+
+	retained := func(callIDs ...string) []string {
+		var ids []string
+		for _, callID := range callIDs {
+			if _, ok := sip.CallLadder(callID); ok {
+				ids = append(ids, callID)
+			}
+		}
+		return ids
+	}
+
+	sip.RetainLadder("ret-a")
+	sip.RetainLadder("ret-b")
+	sip.RetainLadder("ret-c")
+	require.Equal(t, []string{"ret-b", "ret-c"}, retained("ret-a", "ret-b", "ret-c"), "oldest evicted")
+
+	sip.RetainLadder("ret-b") // retained again, evicted as the newest
+	sip.RetainLadder("ret-d")
+	require.Equal(t, []string{"ret-b", "ret-d"}, retained("ret-a", "ret-b", "ret-c", "ret-d"))
+
+	sip.ExpireLadders(time.Now().Add(59 * time.Second))
+	require.Equal(t, []string{"ret-b", "ret-d"}, retained("ret-b", "ret-d"), "within the retention window")
+	sip.ExpireLadders(time.Now().Add(time.Minute))
+	require.Empty(t, retained("ret-b", "ret-d"))
+}
+
+func TestLadderINVITEOnly(t *testing.T) {
+	global.Prometrics = prometheus.NewMetrics("test")
+	global.CallLimiter = cl.NewCallLimiter(-1, global.Prometrics, &sync.WaitGroup{})
+	sip.Sessions = sip.NewConcurrentMapMutex[*sip.SipSession](10)
+
+	request := func(method, callID string) []byte {
+		return []byte(strings.ReplaceAll(strings.Join([]string{
+			method + " sip:1234@192.0.2.10 SIP/2.0",
+			"Via: SIP/2.0/UDP 192.0.2.1:5060;branch=z9hG4bK-" + callID,
+			"Max-Forwards: 70",
+			"From: <sip:1000@192.0.2.1>;tag=abc",
+			"To: <sip:1234@192.0.2.10>",
+			"Call-ID: " + callID,
+			"CSeq: 1 " + method,
+			"Contact: <sip:1000@192.0.2.1:5060>",
+			"Content-Length: 0",
+			"", "",
+		}, "\n"), "\n", "\r\n"))
+	}
+
+	for method, traced := range map[string]bool{"INVITE": true, "OPTIONS": false, "REGISTER": false, "MESSAGE": false} {
+		ss, hasLadder := sip.NewSessionOf(request(method, "ladder-"+method))
+		require.NotNil(t, ss, method)
+		require.Equal(t, traced, hasLadder, method)
+	}
+}
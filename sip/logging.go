@@ -0,0 +1,29 @@
+package sip
+
+import (
+	. "SRGo/global"
+)
+
+// session log lines carry the Call-ID and direction, to correlate all the lines of a call leg
+
+func (session *SipSession) logArgs(args []any) []any {
+	return append([]any{"callId", session.CallID, "direction", session.Direction.String()}, args...)
+}
+
+func (session *SipSession) logDebug(lt LogTitle, msg string, args ...any) {
+	if LogEnabled(lt, LLDebug) {
+		LogDebug(lt, msg, session.logArgs(args)...)
+	}
+}
+
+func (session *SipSession) logInfo(lt LogTitle, msg string, args ...any) {
+	LogInfo(lt, msg, session.logArgs(args)...)
+}
+
+func (session *SipSession) logWarning(lt LogTitle, msg string, args ...any) {
+	LogWarning(lt, msg, session.logArgs(args)...)
+}
+
+func (session *SipSession) logError(lt LogTitle, msg string, args ...any) {
+	LogError(lt, msg, session.logArgs(args)...)
+}
@@ -2,59 +2,175 @@ package sip
 
 import (
 	"SRGo/global"
-	"fmt"
-	"log"
 	"net"
-
 	"sync"
+	"time"
 )
 
+const mediaBindAttempts = 16 // ports skipped at most when binding fails (e.g. port taken by another process)
+
 var MediaPortPool *MediaPool
 
+// MediaPair holds the RTP socket (even port) and its RTCP socket (next odd port)
+type MediaPair struct {
+	RTP  *net.UDPConn
+	RTCP *net.UDPConn
+	Port int // RTP port
+}
+
+type quarantinedPort struct {
+	releasedAt time.Time
+	port       int
+}
+
+// MediaPool hands out RTP/RTCP port pairs in O(1) from a free ring.
+// Released pairs are quarantined for MediaQuarantineSec before being reused,
+// so late packets of a finished call do not leak into a new one.
 type MediaPool struct {
-	alloc map[int]bool
-	mu    sync.Mutex
+	free       portRing[int]
+	quarantine portRing[quarantinedPort]
+	reserved   map[int]bool // RTP ports handed out, guarding against double release
+	total      int
+	inUse      int
+	mu         sync.Mutex
 }
 
 func NewMediaPortPool() *MediaPool {
-	mpp := &MediaPool{alloc: make(map[int]bool, global.MediaEndPort-global.MediaStartPort+1)}
-	for port := global.MediaStartPort; port <= global.MediaEndPort; port++ {
-		mpp.alloc[port] = false
+	start := global.MediaStartPort
+	if start%2 != 0 {
+		start++
 	}
+	total := max((global.MediaEndPort-start+1)/2, 0)
+	mpp := &MediaPool{
+		free:       newPortRing[int](total),
+		quarantine: newPortRing[quarantinedPort](total),
+		reserved:   make(map[int]bool, total),
+		total:      total,
+	}
+	for port := start; port+1 <= global.MediaEndPort; port += 2 {
+		mpp.free.push(port)
+	}
+	mpp.updateMetrics()
 	return mpp
 }
 
-func (mpp *MediaPool) ReserveSocket() *net.UDPConn {
-	mpp.mu.Lock()
-	defer mpp.mu.Unlock()
-	for port, used := range mpp.alloc {
-		if !used {
-			socket, err := global.StartListening(ServerIPv4, port, DscpEF)
-			if err != nil {
-				continue
-			}
-			mpp.alloc[port] = true
-			return socket
+func (mpp *MediaPool) ReservePair() *MediaPair {
+	for range mediaBindAttempts {
+		port, ok := mpp.take()
+		if !ok {
+			break
+		}
+		rtp, err := global.StartListening(ServerIPv4, port, DscpEF)
+		if err != nil {
+			mpp.putBack(port)
+			continue
 		}
+		rtcp, err := global.StartListening(ServerIPv4, port+1, DscpEF)
+		if err != nil {
+			rtp.Close()
+			mpp.putBack(port)
+			continue
+		}
+		return &MediaPair{RTP: rtp, RTCP: rtcp, Port: port}
 	}
-	log.Printf("No available ports for IPv4 %s\n", ServerIPv4)
+	global.Prometrics.MediaPoolExhausted.Inc()
+	global.LogWarning(global.LTMediaStack, "No available port pairs", "ipv4", ServerIPv4.String())
 	return nil
 }
 
-func (mpp *MediaPool) ReleaseSocket(conn *net.UDPConn) bool {
-	if conn == nil {
-		return true
+// ReleasePair closes the pair sockets and quarantines its ports; releasing a pair twice is a no-op
+func (mpp *MediaPool) ReleasePair(pair *MediaPair) {
+	if pair == nil || !mpp.putBack(pair.Port) {
+		return
 	}
-	port := global.GetUDPortFromConn(conn)
-	conn.Close()
+	pair.RTP.Close()
+	pair.RTCP.Close()
+}
+
+// InUse returns the number of reserved pairs and the pool capacity
+func (mpp *MediaPool) InUse() (int, int) {
+	mpp.mu.Lock()
+	defer mpp.mu.Unlock()
+	return mpp.inUse, mpp.total
+}
 
+func (mpp *MediaPool) take() (int, bool) {
 	mpp.mu.Lock()
 	defer mpp.mu.Unlock()
 
-	if mpp.alloc[port] {
-		mpp.alloc[port] = false
-		return true
+	// recycle pairs whose quarantine has elapsed - oldest first, so stop at the first still quarantined
+	now := time.Now()
+	for mpp.quarantine.len() > 0 && now.Sub(mpp.quarantine.peek().releasedAt) >= global.MediaQuarantineSec*time.Second {
+		qp, _ := mpp.quarantine.pop()
+		mpp.free.push(qp.port)
+	}
+
+	port, ok := mpp.free.pop()
+	if ok {
+		mpp.reserved[port] = true
+		mpp.inUse++
 	}
-	global.LogWarning(global.LTMediaStack, fmt.Sprintf("Port [%d] already released!\n", port))
-	return false
+	mpp.updateMetrics()
+	return port, ok
+}
+
+// putBack quarantines a reserved port, returning false if it is not reserved (e.g. already released)
+func (mpp *MediaPool) putBack(port int) bool {
+	mpp.mu.Lock()
+	defer mpp.mu.Unlock()
+	if !mpp.reserved[port] {
+		return false
+	}
+	delete(mpp.reserved, port)
+	mpp.quarantine.push(quarantinedPort{releasedAt: time.Now(), port: port})
+	mpp.inUse--
+	mpp.updateMetrics()
+	return true
+}
+
+// Unsafe
+func (mpp *MediaPool) updateMetrics() {
+	global.Prometrics.MediaPairsInUse.Set(float64(mpp.inUse))
+	global.Prometrics.MediaPairsFree.Set(float64(mpp.free.len()))
+	global.Prometrics.MediaPairsQuarantined.Set(float64(mpp.quarantine.len()))
+}
+
+// =================================================================================================
+// Fixed capacity FIFO ring
+
+type portRing[T any] struct {
+	items []T
+	head  int
+	count int
+}
+
+func newPortRing[T any](capacity int) portRing[T] {
+	return portRing[T]{items: make([]T, capacity)}
+}
+
+func (r *portRing[T]) push(item T) {
+	if r.count == len(r.items) {
+		return
+	}
+	r.items[(r.head+r.count)%len(r.items)] = item
+	r.count++
+}
+
+func (r *portRing[T]) pop() (T, bool) {
+	var item T
+	if r.count == 0 {
+		return item, false
+	}
+	item = r.items[r.head]
+	r.head = (r.head + 1) % len(r.items)
+	r.count--
+	return item, true
+}
+
+func (r *portRing[T]) peek() T {
+	return r.items[r.head]
+}
+
+func (r *portRing[T]) len() int {
+	return r.count
 }
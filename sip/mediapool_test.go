@@ -0,0 +1,67 @@
+package sip_test
+
+import (
+	"SRGo/global"
+	"SRGo/prometheus"
+	"SRGo/sip"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newMediaPool returns a pool of the given number of RTP/RTCP pairs on the loopback
+func newMediaPool(t *testing.T, pairs int) *sip.MediaPool {
+	t.Helper()
+	global.Prometrics = prometheus.NewMetrics("test")
+	sip.ServerIPv4 = net.IPv4(127, 0, 0, 1)
+	global.MediaStartPort, global.MediaEndPort = 47000, 47000+2*pairs-1
+	return sip.NewMediaPortPool()
+}
+
+func TestMediaPoolExhaustion(t *testing.T) {
+	mpp := newMediaPool(t, 2)
+
+	p1, p2 := mpp.ReservePair(), mpp.ReservePair()
+	require.NotNil(t, p1)
+	require.NotNil(t, p2)
+	require.NotEqual(t, p1.Port, p2.Port)
+	require.Equal(t, p1.Port+1, p1.RTCP.LocalAddr().(*net.UDPAddr).Port, "RTCP on the next odd port")
+	require.Nil(t, mpp.ReservePair(), "pool exhausted")
+
+	inUse, total := mpp.InUse()
+	require.Equal(t, 2, inUse)
+	require.Equal(t, 2, total)
+
+	mpp.ReleasePair(p1)
+	mpp.ReleasePair(p2)
+}
+
+func TestMediaPoolQuarantine(t *testing.T) {
+	mpp := newMediaPool(t, 1)
+
+	p := mpp.ReservePair()
+	require.NotNil(t, p)
+	mpp.ReleasePair(p)
+
+	inUse, _ := mpp.InUse()
+	require.Zero(t, inUse)
+	require.Nil(t, mpp.ReservePair(), "released pair quarantined")
+}
+
+func TestMediaPoolDoubleRelease(t *testing.T) {
+	mpp := newMediaPool(t, 2)
+
+	p1, p2 := mpp.ReservePair(), mpp.ReservePair()
+	require.NotNil(t, p1)
+	require.NotNil(t, p2)
+
+	mpp.ReleasePair(p1)
+	mpp.ReleasePair(p1)
+	inUse, _ := mpp.InUse()
+	require.Equal(t, 1, inUse, "second release ignored")
+
+	mpp.ReleasePair(p2)
+	inUse, _ = mpp.InUse()
+	require.Zero(t, inUse)
+}
@@ -0,0 +1,232 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "SRGo/global"
+
+	"github.com/Moatassem/sdp"
+)
+
+type (
+	// MediaStream is a single anchored m-line, relayed through its own RTP/RTCP port pair
+	MediaStream struct {
+		remoteUdpAddr  atomic.Value                // *net.UDPAddr
+		remoteRTCPAddr atomic.Pointer[net.UDPAddr] // of the remote a=rtcp, nil if none
+		Pair           *MediaPair
+		Kind           string // m-line media type i.e. audio, video, image
+		Index          int    // m-line position in the SDP
+		out            rtpOut
+		dtmfRx         dtmfDetector // used by the stream reading goroutine only
+		running        atomic.Bool
+	}
+
+	// rtpOut tracks the RTP stream sent to the stream remote, so packets can be injected without breaking its sequence
+	rtpOut struct {
+		lastSent  time.Time
+		ssrc      uint32
+		lastTS    uint32
+		lastSeq   uint16
+		seqOffset uint16 // added to relayed packets after injected ones
+		active    bool
+		mu        sync.Mutex
+	}
+)
+
+func (ms *MediaStream) RemoteUdpAddr() *net.UDPAddr {
+	rmt, _ := ms.remoteUdpAddr.Load().(*net.UDPAddr)
+	return rmt
+}
+
+func (ms *MediaStream) SetRemoteUdpAddr(rmt *net.UDPAddr) {
+	if rmt == nil {
+		return
+	}
+	ms.remoteUdpAddr.Store(rmt)
+}
+
+// RemoteRTCPAddr returns the remote a=rtcp address if any, otherwise the remote RTP port + 1 (RFC 3550 default)
+func (ms *MediaStream) RemoteRTCPAddr() *net.UDPAddr {
+	if rmt := ms.remoteRTCPAddr.Load(); rmt != nil {
+		return rmt
+	}
+	rmt := ms.RemoteUdpAddr()
+	if rmt == nil {
+		return nil
+	}
+	return &net.UDPAddr{IP: rmt.IP, Port: rmt.Port + 1}
+}
+
+//============================================================
+
+func (ss *SipSession) MediaStream(idx int) *MediaStream {
+	ss.mediaMutex.RLock()
+	defer ss.mediaMutex.RUnlock()
+	if idx < 0 || idx >= len(ss.mediaStreams) {
+		return nil
+	}
+	return ss.mediaStreams[idx]
+}
+
+func (ss *SipSession) MediaStreams() []*MediaStream {
+	ss.mediaMutex.RLock()
+	defer ss.mediaMutex.RUnlock()
+	streams := make([]*MediaStream, 0, len(ss.mediaStreams))
+	for _, ms := range ss.mediaStreams {
+		if ms != nil {
+			streams = append(streams, ms)
+		}
+	}
+	return streams
+}
+
+// ReserveMediaStream returns the stream anchoring m-line idx, reserving a port pair if needed.
+// Returns nil when the pool is exhausted or the session media are already released
+func (ss *SipSession) ReserveMediaStream(idx int, kind string) *MediaStream {
+	ss.mediaMutex.Lock()
+	defer ss.mediaMutex.Unlock()
+	if ss.mediaReleased {
+		return nil
+	}
+	if idx < len(ss.mediaStreams) && ss.mediaStreams[idx] != nil {
+		ms := ss.mediaStreams[idx]
+		if kind != "" {
+			ms.Kind = kind
+		}
+		return ms
+	}
+	pair := MediaPortPool.ReservePair()
+	if pair == nil {
+		return nil
+	}
+	for len(ss.mediaStreams) <= idx {
+		ss.mediaStreams = append(ss.mediaStreams, nil)
+	}
+	ms := &MediaStream{Pair: pair, Kind: kind, Index: idx}
+	ss.mediaStreams[idx] = ms
+	return ms
+}
+
+// StartMediaStream launches the stream handlers once, based on the session routing data
+func (ss *SipSession) StartMediaStream(ms *MediaStream) {
+	if ms == nil || !ms.running.CompareAndSwap(false, true) {
+		return
+	}
+	if ss.RoutingData() != nil && ss.RoutingData().OutCallFlow == EchoResponder {
+		go ss.HandleEchoResponderMedia(ms)
+		return
+	}
+	go ss.HandleNSteerMedia(ms)
+}
+
+func (ss *SipSession) ReleaseMediaStreams() {
+	ss.mediaMutex.Lock()
+	defer ss.mediaMutex.Unlock()
+	for _, ms := range ss.mediaStreams {
+		if ms != nil {
+			MediaPortPool.ReleasePair(ms.Pair)
+		}
+	}
+	ss.mediaStreams = nil
+	ss.mediaReleased = true
+}
+
+// anchorMediaStreams reserves a port pair per active m-line, learns the linked session remote media addresses
+// and rewrites each m-line to point to the local pair. Streams with no port pair available are declined (port 0)
+func (ss *SipSession) anchorMediaStreams(sdpSession *sdp.Session) {
+	lnkdss := ss.LinkedSession
+	var localIPv4 string
+	for i, media := range sdpSession.Media {
+		if media.Port == 0 {
+			continue
+		}
+		ms := ss.ReserveMediaStream(i, media.Type)
+		if ms == nil {
+			ss.logWarning(LTMediaStack, "No media port pair available - stream declined", "media", media.Type)
+			media.Port = 0
+			continue
+		}
+		if lnkdss != nil {
+			if lnkdms := lnkdss.ReserveMediaStream(i, media.Type); lnkdms != nil {
+				if rmt := mediaUdpAddr(sdpSession, media); rmt != nil {
+					lnkdms.SetRemoteUdpAddr(rmt)
+					lnkdms.remoteRTCPAddr.Store(mediaRTCPAddr(rmt, media))
+				}
+				lnkdss.StartMediaStream(lnkdms)
+			}
+		}
+		ss.StartMediaStream(ms)
+
+		ipv4, port := GetUDPIPPortFromConn(ms.Pair.RTP)
+		localIPv4 = ipv4
+		media.Port = port
+		for _, conn := range media.Connection {
+			conn.Address = ipv4
+		}
+		for _, attr := range media.Attributes {
+			if attr.Name == "rtcp" {
+				attr.Value = rtcpAttribute(attr.Value, ipv4, port+1)
+			}
+		}
+	}
+	if localIPv4 != "" && sdpSession.Connection != nil {
+		sdpSession.Connection.Address = localIPv4
+	}
+}
+
+// rtcpAttribute rewrites an a=rtcp value (RFC 3605 "port [nettype addrtype address]") to the local RTCP port,
+// and to the local address when the attribute carries one
+func rtcpAttribute(value, ipv4 string, port int) string {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return strconv.Itoa(port)
+	}
+	return fmt.Sprintf("%d %s IP4 %s", port, fields[1], ipv4)
+}
+
+// mediaRTCPAddr returns the m-line a=rtcp address (RFC 3605), on the RTP address unless it carries one. Nil if none
+func mediaRTCPAddr(rtp *net.UDPAddr, media *sdp.Media) *net.UDPAddr {
+	for _, attr := range media.Attributes {
+		if attr.Name != "rtcp" {
+			continue
+		}
+		fields := strings.Fields(attr.Value)
+		if len(fields) == 0 {
+			return nil
+		}
+		port, err := strconv.Atoi(fields[0])
+		if err != nil || port <= 0 || port > 65535 {
+			return nil
+		}
+		ip := rtp.IP
+		if len(fields) >= 4 {
+			if ip = net.ParseIP(fields[3]); ip == nil {
+				return nil
+			}
+		}
+		return &net.UDPAddr{IP: ip, Port: port}
+	}
+	return nil
+}
+
+// mediaUdpAddr returns the m-line RTP address, using the media level connection if present
+func mediaUdpAddr(sdpSession *sdp.Session, media *sdp.Media) *net.UDPAddr {
+	conn := sdpSession.Connection
+	if len(media.Connection) > 0 {
+		conn = media.Connection[0]
+	}
+	if conn == nil {
+		return nil
+	}
+	ip := net.ParseIP(conn.Address)
+	if ip == nil {
+		return nil
+	}
+	return &net.UDPAddr{IP: ip, Port: media.Port}
+}
@@ -0,0 +1,75 @@
+package sip_test
+
+import (
+	"SRGo/global"
+	"SRGo/sip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Moatassem/sdp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnchorMediaStreams(t *testing.T) {
+	sip.MediaPortPool = newMediaPool(t, 6)
+	ss, lnkdss := sip.NewSS(global.INBOUND), sip.NewSS(global.OUTBOUND)
+	ss.LinkedSession = lnkdss
+	defer lnkdss.ReleaseMediaStreams()
+	defer ss.ReleaseMediaStreams()
+
+	sdpSession := &sdp.Session{
+		Connection: &sdp.Connection{Network: "IN", Type: "IP4", Address: "192.0.2.10"},
+		Media: []*sdp.Media{
+			{Type: sdp.Audio, Port: 4000, Attributes: sdp.Attributes{{Name: "rtcp", Value: "4101"}}},
+			{Type: sdp.Video, Port: 0}, // declined
+			{
+				Type:       sdp.Video,
+				Port:       5000,
+				Connection: []*sdp.Connection{{Network: "IN", Type: "IP4", Address: "192.0.2.20"}},
+				Attributes: sdp.Attributes{{Name: "rtcp", Value: "6001 IN IP4 192.0.2.30"}},
+			},
+			{Type: sdp.Audio, Port: 7000},
+		},
+	}
+	ss.AnchorMediaStreams(sdpSession)
+
+	require.Equal(t, "127.0.0.1", sdpSession.Connection.Address)
+	require.Len(t, ss.MediaStreams(), 3)
+	require.Len(t, lnkdss.MediaStreams(), 3)
+
+	tests := []struct {
+		idx        int
+		kind       string
+		remoteRTP  string
+		remoteRTCP string
+		rtcpAttr   string // rewritten a=rtcp, PORT standing for the local RTCP port
+	}{
+		{0, sdp.Audio, "192.0.2.10:4000", "192.0.2.10:4101", "PORT"},
+		{2, sdp.Video, "192.0.2.20:5000", "192.0.2.30:6001", "PORT IN IP4 127.0.0.1"},
+		{3, sdp.Audio, "192.0.2.10:7000", "192.0.2.10:7001", ""}, // RFC 3550 default
+	}
+	for _, tt := range tests {
+		media := sdpSession.Media[tt.idx]
+		ms, lnkdms := ss.MediaStream(tt.idx), lnkdss.MediaStream(tt.idx)
+		require.NotNil(t, ms, tt.idx)
+		require.NotNil(t, lnkdms, tt.idx)
+		require.Equal(t, tt.kind, ms.Kind)
+		require.Equal(t, ms.Pair.Port, media.Port, "m-line on the local pair")
+		require.NotEqual(t, ms.Pair.Port, lnkdms.Pair.Port)
+		require.Equal(t, tt.remoteRTP, lnkdms.RemoteUdpAddr().String())
+		require.Equal(t, tt.remoteRTCP, lnkdms.RemoteRTCPAddr().String())
+		if tt.rtcpAttr == "" {
+			require.Empty(t, media.Attributes)
+			continue
+		}
+		require.Equal(t, strings.Replace(tt.rtcpAttr, "PORT", strconv.Itoa(ms.Pair.Port+1), 1), media.Attributes[0].Value)
+	}
+	for _, conn := range sdpSession.Media[2].Connection {
+		require.Equal(t, "127.0.0.1", conn.Address)
+	}
+
+	require.Zero(t, sdpSession.Media[1].Port)
+	require.Nil(t, ss.MediaStream(1))
+	require.Nil(t, lnkdss.MediaStream(1))
+}
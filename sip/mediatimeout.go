@@ -0,0 +1,63 @@
+package sip
+
+import (
+	"time"
+
+	. "SRGo/global"
+	"SRGo/q850"
+)
+
+const mediaTimeoutReason = "media timeout"
+
+// touchRTP records the arrival of media on this leg
+func (ss *SipSession) touchRTP() {
+	ss.lastRTP.Store(time.Now().UnixNano())
+}
+
+// StartMediaTimeout watches the RTP received on both legs of an answered steered call,
+// releasing it once a leg stays silent longer than the route media timeout. Silence while on hold is not counted
+func (ss *SipSession) StartMediaTimeout() {
+	rd := ss.RoutingData()
+	if rd == nil || !rd.SteerMedia || rd.MediaTimeout <= 0 {
+		return
+	}
+	timeout := time.Duration(rd.MediaTimeout) * time.Second
+	go ss.mediaTimeoutHandler(ss.probDoneChan, timeout)
+}
+
+func (ss *SipSession) mediaTimeoutHandler(doneChan chan struct{}, timeout time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	since := time.Now() // silence is counted from answer or hold end
+	for {
+		select {
+		case <-doneChan:
+			return
+		case now := <-ticker.C:
+			if !ss.IsEstablished() {
+				return
+			}
+			lnkdss := ss.LinkedSession
+			if ss.isHeld.Load() || (lnkdss != nil && lnkdss.isHeld.Load()) {
+				since = now
+				continue
+			}
+			for _, leg := range []*SipSession{ss, lnkdss} {
+				if leg == nil {
+					continue
+				}
+				last := time.Unix(0, leg.lastRTP.Load())
+				if last.Before(since) {
+					last = since
+				}
+				if now.Sub(last) < timeout {
+					continue
+				}
+				ss.logWarning(LTMediaStack, "No RTP received - releasing call", "leg", leg.Direction.String(), "timeout", timeout.String())
+				ss.ReleaseCallCause(q850.RecoveryOnTimerExpiry, mediaTimeoutReason)
+				return
+			}
+		}
+	}
+}
@@ -52,7 +52,7 @@ func NewRequestMessage(md Method, up string) *SipMessage {
 
 func NewResponseMessage(sc int, rp string) *SipMessage {
 	if sc < 100 || sc > 699 {
-		LogWarning(LTSIPStack, fmt.Sprintf("[%d] - Bad status code in NewResponseMessage - replaced by 400", sc))
+		LogWarning(LTSIPStack, "Bad status code in NewResponseMessage - replaced by 400", "statusCode", sc)
 		sc = 400
 	}
 	sipmsg := &SipMessage{
@@ -166,15 +166,42 @@ func (sipmsg *SipMessage) GetBodyPart(bt BodyType) (ContentPart, bool) {
 	return cntnt, ok
 }
 
+// GetDTMF returns the digit and duration (ms) carried in an application/dtmf-relay or application/dtmf body
+func (sipmsg *SipMessage) GetDTMF() (string, int, bool) {
+	if sipmsg.WithNoBody() {
+		return "", 0, false
+	}
+	if ct, ok := sipmsg.GetBodyPart(DTMFRelay); ok {
+		var signal string
+		duration := dtmfDefaultMS
+		for line := range strings.Lines(string(ct.Bytes)) {
+			line = strings.TrimRight(line, "\r\n")
+			if mtch := DicFieldRegExp[SignalDTMF].FindStringSubmatch(line); mtch != nil {
+				signal = strings.TrimSpace(mtch[2])
+			} else if mtch := DicFieldRegExp[DurationDTMF].FindStringSubmatch(line); mtch != nil {
+				duration, _ = Str2IntDefaultMinMax(strings.TrimSpace(mtch[2]), dtmfDefaultMS, 1, 10000)
+			}
+		}
+		_, ok := DicDTMFSignal[signal]
+		return signal, duration, ok
+	}
+	if ct, ok := sipmsg.GetBodyPart(DTMF); ok {
+		signal := strings.TrimSpace(string(ct.Bytes))
+		_, ok := DicDTMFSignal[signal]
+		return signal, dtmfDefaultMS, ok
+	}
+	return "", 0, false
+}
+
 func (sipmsg *SipMessage) ParseSDPPartAndBuildAnswer() (int, string, bool) {
 	sdpses, err := sdp.Parse(sipmsg.Body.PartsContents[SDP].Bytes)
 	if err != nil {
-		LogError(LTSDPStack, fmt.Sprintf("Failed to parse SDP for Echo Responder: %v", err))
+		LogError(LTSDPStack, "Failed to parse SDP for Echo Responder", "callId", sipmsg.CallID, "error", err)
 		return 400, "Failed to parse SDP for Echo Responder", false
 	}
 	sdpses2, _, err := sdpses.BuildEchoResponderAnswer(sdp.SupportedCodecsStringList...)
 	if err != nil {
-		LogError(LTSDPStack, fmt.Sprintf("Failed to build Echo Responder SDP: %v", err))
+		LogError(LTSDPStack, "Failed to build Echo Responder SDP", "callId", sipmsg.CallID, "error", err)
 		return 488, "Failed to build Echo Responder SDP", false
 	}
 	sipmsg.Body.SdpSession = sdpses2
@@ -459,7 +486,13 @@ func (sipmsg *SipMessage) PrepareMessageBytes(ss *SipSession) {
 	sipmsg.Bytes = bb.Bytes()
 }
 
-func (sipmsg *SipMessage) ParseNPrepareSDP(ss *SipSession) {
+// ParseNPrepareSDP applies the route media policies to the SDP of a message sent by the session within transaction trans
+func (sipmsg *SipMessage) ParseNPrepareSDP(ss *SipSession, trans *Transaction) {
+	if sipmsg.IsResponse() && sipmsg.StartLine.StatusCode >= 300 {
+		if lnkdss := ss.LinkedSession; lnkdss != nil { // offer rejected by the linked session remote
+			lnkdss.sdpOfferPending.Store(false)
+		}
+	}
 	if sipmsg.WithNoBody() {
 		return
 	}
@@ -476,7 +509,7 @@ func (sipmsg *SipMessage) ParseNPrepareSDP(ss *SipSession) {
 	} else if msgbody.ContainsSDP() {
 		sdpSession, err = sdp.Parse(ct.Bytes)
 		if err != nil {
-			LogError(LTConfiguration, fmt.Sprintf("Failed to parse SDP: %v", err))
+			ss.logError(LTSDPStack, "Failed to parse SDP", "error", err)
 			return
 		}
 		sdpSession.Name = B2BUANameVersion
@@ -484,12 +517,17 @@ func (sipmsg *SipMessage) ParseNPrepareSDP(ss *SipSession) {
 		return
 	}
 
-	if ss.RoutingData != nil && (ss.RoutingData.SteerMedia || ss.RoutingData.OutCallFlow == EchoResponder) && ss.MediaConn != nil {
-		if lnkdss := ss.LinkedSession; lnkdss != nil {
-			lnkdss.SetRemoteMediaUdpAddr(sdpSession.GetEffectiveMediaUdpAddr(sdp.Audio))
+	if ss.RoutingData() != nil {
+		if lnkdss := ss.LinkedSession; lnkdss != nil && ss.RoutingData().SteerMedia {
+			lnkdss.setHeld(sdpSession.IsCallHeld()) // SDP sent by the linked session remote
 		}
-		ipv4, port := GetUDPIPPortFromConn(ss.MediaConn)
-		sdpSession.SetConnection(sdp.Audio, ipv4, port, false)
+		ss.RoutingData().SDPPolicy.Apply(sdpSession)
+	}
+
+	if ss.RoutingData() != nil && (ss.RoutingData().SteerMedia || ss.RoutingData().OutCallFlow == EchoResponder) {
+		ss.negotiateTranscoding(sdpSession, ss.isSDPOffer(sipmsg, trans))
+		ss.negotiateDTMF(sdpSession)
+		ss.anchorMediaStreams(sdpSession)
 	}
 
 	if ss.SDPSessionID == 0 {
@@ -511,6 +549,20 @@ func (sipmsg *SipMessage) ParseNPrepareSDP(ss *SipSession) {
 	msgbody.PartsContents[SDP] = ct
 }
 
+// isSDPOffer tells whether the SDP sent to the session remote is an offer, RFC 3264, from the negotiation state of both legs:
+// it answers the pending offer the linked leg sent to its remote, or repeats the answer of the transaction offer
+// (e.g. 200 OK after a reliable 18x); it is an offer otherwise, including a delayed offer in a 2xx answered in the ACK
+func (ss *SipSession) isSDPOffer(sipmsg *SipMessage, trans *Transaction) bool {
+	if lnkdss := ss.LinkedSession; lnkdss != nil && lnkdss.sdpOfferPending.CompareAndSwap(true, false) {
+		return false
+	}
+	if sipmsg.IsResponse() && trans != nil && trans.RequestMessage != nil && trans.RequestMessage.ContainsSDP() {
+		return false
+	}
+	ss.sdpOfferPending.Store(true)
+	return true
+}
+
 func (sipmsg *SipMessage) WithNoBody() bool {
 	return sipmsg.Body == nil
 }
@@ -3,6 +3,8 @@ package sip_test
 import (
 	"SRGo/global"
 	"SRGo/sip"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -46,3 +48,26 @@ func TestGetRegistrationData(t *testing.T) {
 	actual = data{contact, ext, ruri, ipport, expires}
 	require.Equal(t, expected, actual, "With proper username")
 }
+
+func TestBodyNotSharingPacketBuffer(t *testing.T) {
+	t.Parallel()
+
+	body := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\nm=audio 4000 RTP/AVP 0\r\n"
+	pdu := []byte(strings.Join([]string{
+		"INVITE sip:1234@192.0.2.10 SIP/2.0",
+		"Via: SIP/2.0/UDP 192.0.2.1:5060;branch=z9hG4bK-body",
+		"Max-Forwards: 70",
+		"From: <sip:1000@192.0.2.1>;tag=abc",
+		"To: <sip:1234@192.0.2.10>",
+		"Call-ID: body-copy",
+		"CSeq: 1 INVITE",
+		"Contact: <sip:1000@192.0.2.1:5060>",
+		"Content-Type: application/sdp",
+		"Content-Length: " + strconv.Itoa(len(body)),
+		"", body,
+	}, "\r\n"))
+	sipmsg, _, err := sip.ProcessPDU(pdu)
+	require.NoError(t, err)
+	clear(pdu) // packet buffer back to the pool and reused
+	require.Equal(t, body, string(sipmsg.Body.PartsContents[global.SDP].Bytes))
+}
@@ -0,0 +1,55 @@
+package sip
+
+import (
+	"errors"
+	"net"
+
+	. "SRGo/global"
+	"SRGo/recording"
+)
+
+// StartRecording records the audio of the call of this session (both legs), only possible when media is steered
+func (ss *SipSession) StartRecording() error {
+	if ss.RoutingData() == nil || !ss.RoutingData().SteerMedia {
+		return errors.New("media not steered")
+	}
+	inss := ss.inboundLeg()
+	if inss.recorder.Load() != nil {
+		return errors.New("call already recorded")
+	}
+	rec, err := recording.New(RecordingsDir, inss.CallID)
+	if err != nil {
+		return err
+	}
+	if !inss.recorder.CompareAndSwap(nil, rec) {
+		return errors.New("call already recorded")
+	}
+	if lnkdss := inss.LinkedSession; lnkdss != nil {
+		lnkdss.recorder.Store(rec)
+	}
+	inss.logInfo(LTMediaStack, "Recording started")
+	return nil
+}
+
+// StopRecording finalizes the call recording and returns the file path.
+// The recorder is kept on both legs so the CDR still gets the recording path
+func (ss *SipSession) StopRecording() (string, error) {
+	rec := ss.recorder.Load()
+	if rec == nil {
+		return "", errors.New("not recording")
+	}
+	return rec.Close(), nil
+}
+
+func (ss *SipSession) recordMedia(ms *MediaStream, pkt []byte, src *net.UDPAddr) {
+	rec := ss.recorder.Load()
+	if rec == nil || (ms.Kind != "" && ms.Kind != "audio") {
+		return
+	}
+	leg := recording.Caller
+	if ss.Direction == OUTBOUND {
+		leg = recording.Callee
+	}
+	dst, _ := ms.Pair.RTP.LocalAddr().(*net.UDPAddr)
+	rec.Write(leg, pkt, src, dst)
+}
@@ -1,10 +1,10 @@
 package sip
 
 import (
-	"fmt"
 	"net"
 	"time"
 
+	"SRGo/events"
 	. "SRGo/global"
 	"SRGo/phone"
 	"SRGo/q850"
@@ -17,14 +17,15 @@ import (
 func (ss1 *SipSession) RouteRequestExternal(trans1 *Transaction, sipmsg1 *SipMessage) {
 	defer LogCallStack()
 
-	if ss1.RoutingData == nil { // first invocation
-		ss1.RoutingData = &RoutingRecord{NoAnswerTimeout: 180, No18xTimeout: 60, MaxCallDuration: 0, OutRuriUserpart: sipmsg1.StartLine.UserPart}
+	rd := ss1.RoutingData()
+	if rd == nil { // first invocation
+		rd = &RoutingRecord{NoAnswerTimeout: 180, No18xTimeout: 60, MaxCallDuration: 0, OutRuriUserpart: sipmsg1.StartLine.UserPart}
+		ss1.SetRoutingData(rd)
 
-		asskt := ASUserAgent.GetUDPAddr()
-		if AreUdpAddrsEqual(ss1.RemoteUDP(), asskt) { // incoming from SIP Layer
-			if phone, ok := phone.Phones.Get(ss1.RoutingData.OutRuriUserpart); ok {
+		if isAS(ss1.RemoteUDP()) { // incoming from SIP Layer
+			if phone, ok := phone.Phones.Get(rd.OutRuriUserpart); ok {
 				ua := phone.GetUA()
-				ss1.RoutingData.RemoteUDPSocket = ua.GetUDPSocket()
+				rd.RemoteUDPSocket = ua.GetUDPSocket()
 				if !phone.IsRegistered {
 					ss1.RejectMe(trans1, status.TemporarilyUnavailable, q850.NoAnswerFromUser, "target not registered")
 					return
@@ -46,27 +47,45 @@ func (ss1 *SipSession) RouteRequestExternal(trans1 *Transaction, sipmsg1 *SipMes
 				return
 			}
 		} else {
-			ss1.RoutingData.RemoteUDPSocket = ASUserAgent.GetUDPSocket()
+			rd.RemoteUDPSocket = ASUserAgent.GetUDPSocket()
 			sipmsg1.AddRequestedBodyParts()
 		}
 		// isCallerPhone := phone.Phones.IsPhoneExt(getURIUsername(sipmsg1.FromHeader))
 	}
 
-	rd := ss1.RoutingData
+	if rd.RemoteUDPSocket.IsHostname() { // DNS lookups take up to their timeouts, not to be waited for by the SIP worker
+		go ss1.routeExternal(trans1, sipmsg1)
+		return
+	}
+	ss1.routeExternal(trans1, sipmsg1)
+}
+
+// routeExternal sends the call towards its external AS or phone target
+func (ss1 *SipSession) routeExternal(trans1 *Transaction, sipmsg1 *SipMessage) {
+	defer LogCallStack()
+
+	rd := ss1.RoutingData()
 
 	// if isMRF && ss1.IsBeingEstablished() && ss1.IsDelayedOfferCall && !trans1.RequestMessage.IsMethodAllowed(UPDATE) {
 	// 	ss1.RejectMe(trans1, status.ServiceUnavailable, q850.InterworkingUnspecified, "Delayed offer with no UPDATE support for MRF")
 	// 	return
 	// }
 
+	target := rd.RemoteUDPSocket.UDPAddr()
+	if target == nil {
+		ss1.RejectMe(trans1, status.ServiceUnavailable, q850.NoRouteToDestination, "Target not resolvable")
+		return
+	}
+
 	ss2 := NewSS(OUTBOUND)
-	ss2.SetRemoteUDP(rd.RemoteUDPSocket.UDPAddr())
+	ss2.SetRemoteUDP(target)
 	ss2.SetUDPListenser(ss1.UDPListenser())
-	ss2.RoutingData = rd
+	ss2.SetRoutingData(rd)
 	ss2.IsDelayedOfferCall = ss1.IsDelayedOfferCall
 
 	ss2.LinkedSession = ss1
 	ss1.LinkedSession = ss2
+	ss2.ladder = ss1.ladder
 
 	trans2, _ := ss2.CreateLinkedINVITE(rd.OutRuriUserpart, sipmsg1.Body)
 
@@ -81,22 +100,18 @@ func (ss1 *SipSession) RouteRequestExternal(trans1 *Transaction, sipmsg1 *SipMes
 
 	ss2.SetState(state.BeingEstablished)
 	ss2.AddMe()
+	ss1.countCallStart(ss2.RemoteUDP().String())
 	ss2.SendSTMessage(trans2)
 }
 
-//nolint:cyclop
 func (ss1 *SipSession) RouteRequestInternal(trans1 *Transaction, sipmsg1 *SipMessage) {
 	defer LogCallStack()
 
 	upart := sipmsg1.StartLine.UserPart
 
-	var upart2 string
-
 	if phone, ok := phone.Phones.Get(upart); ok {
-		ss1.RoutingData = &RoutingRecord{NoAnswerTimeout: 60, No18xTimeout: 30, MaxCallDuration: 7200, OutRuriUserpart: upart}
-		upart2 = upart
 		ua := phone.GetUA()
-		ss1.RoutingData.RemoteUDPSocket = ua.GetUDPSocket()
+		ss1.SetRoutingData(&RoutingRecord{NoAnswerTimeout: 60, No18xTimeout: 30, MaxCallDuration: 7200, OutRuriUserpart: upart, RemoteUDPSocket: ua.GetUDPSocket()})
 		if !phone.IsRegistered {
 			ss1.RejectMe(trans1, status.TemporarilyUnavailable, q850.NoAnswerFromUser, "target not registered")
 			return
@@ -113,87 +128,159 @@ func (ss1 *SipSession) RouteRequestInternal(trans1 *Transaction, sipmsg1 *SipMes
 			ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "no remaining body")
 			return
 		}
-
-		goto routeCall
+		ss1.routeCall(trans1, sipmsg1, upart)
+		return
 	}
 
-	ss1.RoutingData, upart2 = RoutingEngineDB.Get(upart)
-	if ss1.RoutingData != nil {
-		switch ss1.RoutingData.OutCallFlow {
-		case EchoResponder:
-			if ss1.IsDelayedOfferCall {
-				ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "Delayed offer not supported")
-				return
-			} else if !sipmsg1.Body.ContainsSDP() {
-				ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "No SDP in echo call")
-				return
-			}
-			ss1.answerEchoCall(trans1, sipmsg1)
-			return
-		case Transparent:
-		case TransformEarlyToFinal:
-			if ss1.IsDelayedOfferCall {
-				ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "Delayed offer not supported")
+	// routing server, ENUM and DNS lookups take up to their timeouts, not to be waited for by the SIP worker
+	go ss1.lookupRoute(trans1, sipmsg1, upart)
+}
+
+// lookupRoute finds the routing record of a call not towards a registered phone, then routes the call
+func (ss1 *SipSession) lookupRoute(trans1 *Transaction, sipmsg1 *SipMessage, upart string) {
+	defer LogCallStack()
+
+	var rd *RoutingRecord
+	var upart2 string
+	if RouteServer != nil {
+		var err error
+		if rd, upart2, err = RouteServer.Get(ss1.routingQuery(sipmsg1)); err != nil {
+			ss1.logWarning(LTExternalData, "Routing server lookup failed - Falling back to Routing DB", "error", err)
+			if rd, upart2 = RoutingEngineDB.Get(upart); rd == nil {
+				ss1.RejectMe(trans1, status.ServiceUnavailable, q850.TemporaryFailure, "Routing server unavailable")
 				return
 			}
 		}
+	} else {
+		rd, upart2 = RoutingEngineDB.Get(upart)
+	}
+	if rd == nil {
+		// if !sipmsg1.Body.ContainsSDP() {
+		// 	ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotImplemented, "Not supported SDP or delay offer")
+		// 	return
+		// }
+
+		ss1.RejectMe(trans1, status.NotFound, q850.UnallocatedNumber, "No target found")
+		return
+	}
+	ss1.SetRoutingData(rd)
 
-		if ss1.RoutingData.No18xTimeout <= 0 && ss1.RoutingData.NoAnswerTimeout <= 0 {
-			ss1.RejectMe(trans1, status.ServiceUnavailable, q850.NormalUnspecified, "Answer and 18x Timeouts cannot be both disabled")
+	switch rd.OutCallFlow {
+	case EchoResponder:
+		if ss1.IsDelayedOfferCall {
+			ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "Delayed offer not supported")
+			return
+		} else if !sipmsg1.Body.ContainsSDP() {
+			ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "No SDP in echo call")
 			return
 		}
+		ss1.answerEchoCall(trans1, sipmsg1)
+		return
+	case Transparent:
+	case TransformEarlyToFinal:
+		if ss1.IsDelayedOfferCall {
+			ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotAvailable, "Delayed offer not supported")
+			return
+		}
+	}
 
-		goto routeCall
+	if rd.No18xTimeout <= 0 && rd.NoAnswerTimeout <= 0 {
+		ss1.RejectMe(trans1, status.ServiceUnavailable, q850.NormalUnspecified, "Answer and 18x Timeouts cannot be both disabled")
+		return
 	}
 
-	// if !sipmsg1.Body.ContainsSDP() {
-	// 	ss1.RejectMe(trans1, status.NotAcceptableHere, q850.BearerCapabilityNotImplemented, "Not supported SDP or delay offer")
-	// 	return
-	// }
+	if rd.ENUMSuffix != "" && !ss1.routeENUM(trans1, &upart2) {
+		return
+	}
 
-	ss1.RejectMe(trans1, status.NotFound, q850.UnallocatedNumber, "No target found")
-	return
+	ss1.routeCall(trans1, sipmsg1, upart2)
+}
 
-routeCall:
-	rd := ss1.RoutingData
+// routeCall routes the call to the first resolved target of its routing record, others kept for failover
+func (ss1 *SipSession) routeCall(trans1 *Transaction, sipmsg1 *SipMessage, upart2 string) {
+	if !ss1.IsBeingEstablished() { // cancelled while looking up the route
+		return
+	}
+
+	rd := ss1.RoutingData()
 
 	if rd.SteerMedia {
-		ss1.MediaConn = MediaPortPool.ReserveSocket()
-		if ss1.MediaConn == nil {
+		ms1 := ss1.ReserveMediaStream(0, "")
+		if ms1 == nil {
 			ss1.RejectMe(trans1, status.ServiceUnavailable, q850.ResourceUnavailableUnspecified, "No media port available for ingress")
 			return
 		}
-		go ss1.HandleNSteerMedia()
+		ss1.StartMediaStream(ms1)
 	}
 
-	ss2 := NewSS(OUTBOUND)
-	ss2.EgressProxy = ProxyUdpServer
+	targetSkt := rd.RemoteUDPSocket
+	if rd.Trunk != "" {
+		trunk := GetTrunk(rd.Trunk)
+		if trunk == nil || !trunk.IsRegistered() {
+			ss1.RejectMe(trans1, status.ServiceUnavailable, q850.NetworkOutOfOrder, "Trunk not registered")
+			return
+		}
+		ss1.trunk = trunk
+		if targetSkt == nil {
+			targetSkt = trunk.registrar
+		}
+	}
 
-	if rd.RemoteUDPSocket == nil || rd.RemoteUDPSocket.UDPAddr() == nil {
-		ss2.SetRemoteUDP(ss1.RemoteUDP())
-	} else {
-		ss2.SetRemoteUDP(rd.RemoteUDPSocket.UDPAddr())
+	targets := []*net.UDPAddr{ss1.RemoteUDP()}
+	if targetSkt != nil {
+		var err error
+		if targets, err = targetSkt.Targets(); err != nil || len(targets) == 0 {
+			ss1.logWarning(LTExternalData, "Unable to resolve route target", "target", targetSkt.String(), "error", err)
+			ss1.RejectMe(trans1, status.ServiceUnavailable, q850.NoRouteToDestination, "Target not resolvable")
+			return
+		}
 	}
 
+	ss1.outUserpart = upart2
+	ss1.routeTargets(trans1, sipmsg1.Body, targets)
+}
+
+// routeTargets routes the call to the first target, others kept for failover.
+// The body is kept aside as each outbound leg rewrites the SDP of the copy it sends
+func (ss1 *SipSession) routeTargets(trans1 *Transaction, body *MessageBody, targets []*net.UDPAddr) {
+	ss1.routedBody = body.Clone()
+	ss1.failoverTargets = targets[1:]
+	ss1.routeOutbound(trans1, targets[0])
+}
+
+// routeOutbound creates and sends the outbound leg of the inbound session towards target
+func (ss1 *SipSession) routeOutbound(trans1 *Transaction, target *net.UDPAddr) {
+	rd := ss1.RoutingData()
+
+	ss2 := NewSS(OUTBOUND)
+	ss2.EgressProxy = ProxyUdpServer
+	ss2.SetRemoteUDP(target)
 	ss2.SetUDPListenser(ss1.UDPListenser())
-	ss2.RoutingData = rd
+	ss2.SetRoutingData(rd)
+	ss2.trunk = ss1.trunk
 	ss2.IsDelayedOfferCall = ss1.IsDelayedOfferCall
 	ss2.IsPRACKSupported = rd.OutCallFlow == Transparent && ss1.IsPRACKSupported
 
 	ss2.LinkedSession = ss1
 	ss1.LinkedSession = ss2
+	ss2.ladder = ss1.ladder
 
 	if rd.SteerMedia {
-		ss2.MediaConn = MediaPortPool.ReserveSocket()
-		if ss2.MediaConn == nil {
+		ms2 := ss2.ReserveMediaStream(0, "")
+		if ms2 == nil {
 			ss2.DropMe()
 			ss1.RejectMe(trans1, status.ServiceUnavailable, q850.ResourceUnavailableUnspecified, "No media port available for egress")
 			return
 		}
-		go ss2.HandleNSteerMedia()
+		ss2.StartMediaStream(ms2)
+		if rd.RecordCall && ss1.recorder.Load() == nil { // not already recording from a previous target
+			if err := ss1.StartRecording(); err != nil {
+				ss1.logWarning(LTMediaStack, "Unable to record call", "error", err)
+			}
+		}
 	}
 
-	trans2, _ := ss2.CreateLinkedINVITE(upart2, sipmsg1.Body)
+	trans2, _ := ss2.CreateLinkedINVITE(ss1.outUserpart, ss1.routedBody.Clone())
 
 	ss2.TransformEarlyToFinal = rd.OutCallFlow == TransformEarlyToFinal
 
@@ -203,9 +290,26 @@ routeCall:
 
 	ss2.SetState(state.BeingEstablished)
 	ss2.AddMe()
+	ss1.countCallStart(ss2.RemoteUDP().String())
 	ss2.SendSTMessage(trans2)
 }
 
+// failover routes the call to the next resolved target of the route, if any, when the outbound leg timed-out or got 503
+func (ss1 *SipSession) failover(trans1 *Transaction, statusCode int) bool {
+	if statusCode != status.RequestTimeout && statusCode != status.ServiceUnavailable {
+		return false
+	}
+	if len(ss1.failoverTargets) == 0 || ss1.RoutingData() == nil {
+		return false
+	}
+	target := ss1.failoverTargets[0]
+	ss1.failoverTargets = ss1.failoverTargets[1:]
+	ss1.logInfo(LTSIPStack, "Failing over to next target", "statusCode", statusCode, "target", target.String())
+	ss1.countPeerFailed(statusCode)
+	ss1.routeOutbound(trans1, target)
+	return true
+}
+
 func (ss1 *SipSession) RerouteRequest(rspnspk ResponsePack) {
 	defer LogCallStack()
 
@@ -226,12 +330,15 @@ func (ss1 *SipSession) RerouteRequest(rspnspk ResponsePack) {
 		return
 	}
 	if ss1.IsBeingEstablished() {
+		if ss1.failover(trans1, rspnspk.StatusCode) {
+			return
+		}
 		ss1.LinkedSession = nil
 		ss1.RejectMe(trans1, rspnspk.StatusCode, q850.NormalUnspecified, reason)
 		return
 	}
 	// rcv18x := trans1.StatusCodeExistsSYNC(180)
-	// if err := failure(reason, rcv18x, ss1.RoutingData); err != nil {
+	// if err := failure(reason, rcv18x, ss1.RoutingData()); err != nil {
 	// 	LogError(LTConfiguration, err.Error())
 	// 	if ss1.IsBeingEstablished() {
 	// 		ss1.LinkedSession = nil
@@ -256,8 +363,12 @@ func (ss *SipSession) HandleRefer(trans *Transaction, sipmsg *SipMessage) {
 		ss.Relayed18xNotify = nil
 	}
 
-	fmt.Println(referRuri)
+	ss.logDebug(LTSIPStack, "REFER received", "referTo", referRuri)
 	ss.SendCreatedResponse(trans, status.OK, ZeroBody())
+	ss.publishEvent(events.Transfer, func(e *events.Event) {
+		e.Party = ss.party()
+		e.ReferTo = referRuri
+	})
 }
 
 // ============================================================================
@@ -282,23 +393,21 @@ func ProbeUA(conn *net.UDPConn, ua *SipUdpUserAgent) {
 	ss.SendSTMessage(trans)
 }
 
-func (ss *SipSession) HandleNSteerMediaWithPool() {
-	if ss.MediaConn == nil {
-		return
-	}
-
+func (ss *SipSession) HandleNSteerMediaWithPool(ms *MediaStream) {
 	for {
 		buf, _ := RTPRXBufferPool.Get().(*[]byte)
-		n, _, err := ss.MediaConn.ReadFromUDP(*buf)
+		n, _, err := ms.Pair.RTP.ReadFromUDP(*buf)
 		if err != nil {
 			RTPRXBufferPool.Put(buf)
 			break
 		}
+		ss.touchRTP()
 		go func() {
-			lnkdss := ss.LinkedSession
-			if lnkdss != nil && lnkdss.MediaConn != nil {
-				if remoteAddr := lnkdss.RemoteMediaUdpAddr(); remoteAddr != nil {
-					lnkdss.MediaConn.WriteToUDP((*buf)[:n], remoteAddr) // data race but not critical
+			if lnkdss := ss.LinkedSession; lnkdss != nil {
+				if lnkdms := lnkdss.MediaStream(ms.Index); lnkdms != nil {
+					if remoteAddr := lnkdms.RemoteUdpAddr(); remoteAddr != nil {
+						lnkdms.relay(ss.transcodeRTP((*buf)[:n], nil), remoteAddr) // data race but not critical
+					}
 				}
 			}
 			RTPRXBufferPool.Put(buf)
@@ -306,49 +415,79 @@ func (ss *SipSession) HandleNSteerMediaWithPool() {
 	}
 }
 
-func (ss *SipSession) HandleNSteerMedia() {
+func (ss *SipSession) HandleNSteerMedia(ms *MediaStream) {
 	defer func() {
 		if LogCallStack() {
-			ss.HandleNSteerMedia()
+			ss.HandleNSteerMedia(ms)
 		}
 	}()
-	if ss.MediaConn == nil {
-		return
-	}
+	go ss.HandleNSteerRTCP(ms)
 	buf := make([]byte, RTPMaxSize)
+	tbuf := make([]byte, 0, RTPMaxSize)
 	for {
-		n, _, err := ss.MediaConn.ReadFromUDP(buf)
+		n, src, err := ms.Pair.RTP.ReadFromUDP(buf)
 		if err != nil {
 			break
 		}
+		ss.touchRTP()
+		ss.recordMedia(ms, buf[:n], src)
+		if ss.interceptDTMF(ms, buf[:n]) {
+			continue
+		}
 		lnkdss := ss.LinkedSession
-		if lnkdss != nil && lnkdss.MediaConn != nil {
-			if remoteAddr := lnkdss.RemoteMediaUdpAddr(); remoteAddr != nil {
-				lnkdss.MediaConn.WriteToUDP(buf[:n], remoteAddr)
+		if lnkdss == nil {
+			continue
+		}
+		if lnkdms := lnkdss.MediaStream(ms.Index); lnkdms != nil {
+			if remoteAddr := lnkdms.RemoteUdpAddr(); remoteAddr != nil {
+				lnkdms.relay(ss.transcodeRTP(buf[:n], tbuf), remoteAddr)
 			}
 		}
 	}
 }
 
-func (ss *SipSession) HandleEchoResponderMedia() {
+// HandleNSteerRTCP collects the call quality reported in RTCP and relays it to the linked stream remote RTCP address
+func (ss *SipSession) HandleNSteerRTCP(ms *MediaStream) {
 	defer func() {
 		if LogCallStack() {
-			ss.HandleEchoResponderMedia()
+			ss.HandleNSteerRTCP(ms)
 		}
 	}()
-	if ss.MediaConn == nil {
-		return
+	buf := make([]byte, RTPMaxSize)
+	for {
+		n, _, err := ms.Pair.RTCP.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		ss.inspectRTCP(ms, buf[:n])
+		lnkdss := ss.LinkedSession
+		if lnkdss == nil {
+			continue
+		}
+		if lnkdms := lnkdss.MediaStream(ms.Index); lnkdms != nil {
+			if remoteAddr := lnkdms.RemoteRTCPAddr(); remoteAddr != nil {
+				lnkdms.Pair.RTCP.WriteToUDP(buf[:n], remoteAddr)
+			}
+		}
 	}
+}
+
+func (ss *SipSession) HandleEchoResponderMedia(ms *MediaStream) {
+	defer func() {
+		if LogCallStack() {
+			ss.HandleEchoResponderMedia(ms)
+		}
+	}()
 	buf := make([]byte, RTPMaxSize)
 	for {
-		n, addr, err := ss.MediaConn.ReadFromUDP(buf)
+		n, addr, err := ms.Pair.RTP.ReadFromUDP(buf)
 		if err != nil {
 			break
 		}
-		if ss.isHeld {
+		if ss.isHeld.Load() {
 			continue
 		}
-		if _, err := ss.MediaConn.WriteToUDP(buf[:n], addr); err != nil {
+		if _, err := ms.Pair.RTP.WriteToUDP(buf[:n], addr); err != nil {
 			break
 		}
 	}
@@ -358,17 +497,18 @@ func (ss *SipSession) answerEchoCall(trans *Transaction, sipmsg *SipMessage) {
 	if ss == nil || trans == nil || sipmsg == nil {
 		return
 	}
+	ss.countCallStart("")
 
 	content, _ := sipmsg.GetBodyPart(SDP)
 
 	sdp1, err := sdp.Parse(content.Bytes)
 	if err != nil {
-		LogError(LTSDPStack, fmt.Sprintf("Failed to parse SDP: %v", err))
+		ss.logError(LTSDPStack, "Failed to parse SDP", "error", err)
 		ss.RejectMe(trans, status.NotAcceptableHere, q850.FacilityRejected, "Bad SDP in echo call")
 		return
 	}
 
-	if ss.MediaConn = MediaPortPool.ReserveSocket(); ss.MediaConn == nil {
+	if ss.ReserveMediaStream(0, "") == nil {
 		ss.RejectMe(trans, status.ServiceUnavailable, q850.ResourceUnavailableUnspecified, "No media port available for ingress")
 		return
 	}
@@ -391,7 +531,9 @@ func (ss *SipSession) answerEchoCall(trans *Transaction, sipmsg *SipMessage) {
 	msgbody.SdpSession = sdp2
 
 	ss.SendCreatedResponse(trans, 200, msgbody)
-	ss.isHeld = sdp1.IsCallHeld()
+	ss.setHeld(sdp1.IsCallHeld())
 
-	go ss.HandleEchoResponderMedia()
+	for _, ms := range ss.MediaStreams() {
+		ss.StartMediaStream(ms)
+	}
 }
@@ -0,0 +1,75 @@
+package sip_test
+
+import (
+	"SRGo/cl"
+	"SRGo/global"
+	"SRGo/sip"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Moatassem/sdp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverSteerMedia(t *testing.T) {
+	sip.MediaPortPool = newMediaPool(t, 6)
+	global.CallLimiter = cl.NewCallLimiter(-1, global.Prometrics, &sync.WaitGroup{})
+	sip.Sessions = sip.NewConcurrentMapMutex[*sip.SipSession](10)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	body := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\nm=audio 4000 RTP/AVP 0\r\n"
+	ss1, trans1 := sip.NewInboundCall([]byte(strings.Join([]string{
+		"INVITE sip:1234@192.0.2.10 SIP/2.0",
+		"Via: SIP/2.0/UDP 192.0.2.1:5060;branch=z9hG4bK-failover",
+		"Max-Forwards: 70",
+		"From: <sip:1000@192.0.2.1>;tag=abc",
+		"To: <sip:1234@192.0.2.10>",
+		"Call-ID: failover-steer-media",
+		"CSeq: 1 INVITE",
+		"Contact: <sip:1000@192.0.2.1:5060>",
+		"Content-Type: application/sdp",
+		"Content-Length: " + strconv.Itoa(len(body)),
+		"", body,
+	}, "\r\n")))
+	require.NotNil(t, trans1)
+	ss1.SetUDPListenser(conn)
+	ss1.SetRemoteUDP(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5060})
+	ss1.SetRoutingData(&sip.RoutingRecord{SteerMedia: true})
+	defer ss1.ReleaseMediaStreams()
+
+	// offer sent on the outbound leg to its target, anchored on its own media port
+	requireOffer := func(target *net.UDPAddr) {
+		t.Helper()
+		ss2 := ss1.LinkedSession
+		require.NotNil(t, ss2)
+		require.Equal(t, target.String(), ss2.RemoteUDP().String())
+		offer, err := sdp.Parse(ss2.CurrentRequestMessage().Body.PartsContents[global.SDP].Bytes)
+		require.NoError(t, err)
+		require.Equal(t, ss2.MediaStream(0).Pair.Port, offer.Media[0].Port)
+		require.Equal(t, "192.0.2.1:4000", ss1.MediaStream(0).RemoteUdpAddr().String(), "caller media")
+		require.Equal(t, body, string(trans1.RequestMessage.Body.PartsContents[global.SDP].Bytes), "inbound offer kept")
+	}
+
+	targets := []*net.UDPAddr{{IP: net.IPv4(127, 0, 0, 1), Port: 5071}, {IP: net.IPv4(127, 0, 0, 1), Port: 5072}}
+	sip.RouteTargets(ss1, trans1, trans1.RequestMessage.Body, targets)
+	requireOffer(targets[0])
+
+	first := ss1.LinkedSession
+	first.GetFirstTransaction().StopTransTimer(true)
+	first.DropMe() // the failed leg releases its media port
+
+	require.True(t, sip.Failover(ss1, trans1, 503))
+	requireOffer(targets[1])
+	second := ss1.LinkedSession
+	require.NotSame(t, first, second)
+	second.GetFirstTransaction().StopTransTimer(true)
+	second.DropMe()
+
+	require.False(t, sip.Failover(ss1, trans1, 503), "no target left")
+}
@@ -3,8 +3,11 @@ package sip
 import (
 	"SRGo/global"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"regexp"
+	"slices"
 	"sync"
 )
 
@@ -22,14 +25,29 @@ type (
 		DisallowDifferent18x bool              `json:"disallowDifferent18x"` // for 18x responses, if false, multiple different 18x responses can be sent
 		DisallowSimilar18x   bool              `json:"disallowSimilar18x"`   // for 18x responses, if false, multiple similar 18x responses can be sent
 		SteerMedia           bool              `json:"steerMedia"`
+		RecordCall           bool              `json:"recordCall"` // requires steerMedia
+		DTMFMode             DTMFMode          `json:"dtmfMode"`   // DTMF method towards the called side, requires steerMedia
+		SDPPolicy            *SDPPolicy        `json:"sdpPolicy,omitempty"`
+		HMR                  *HeaderRules      `json:"hmr,omitempty"`        // outbound INVITE header manipulation
+		ENUMSuffix           string            `json:"enumSuffix,omitempty"` // routed to the ENUM (NAPTR) SIP URI of the translated userpart under this domain
+		Trunk                string            `json:"trunk,omitempty"`      // calls sent from the AoR of this registered trunk, to its registrar if no outRuriHostport
+		Transcoding          bool              `json:"transcoding"`          // requires steerMedia
+		MediaTimeout         int               `json:"mediaTimeout"`         // seconds without RTP on a leg before releasing the call, requires steerMedia
+		AuthUsername         string            `json:"authUsername,omitempty"`
+		AuthPassword         string            `json:"authPassword,omitempty"` // with authUsername, answers outbound INVITE 401/407 digest challenges
 		IsDB                 bool              `json:"-"`
+		fromServer           bool              // returned by the routing server
 	}
 
 	CallFlow string
 
 	RoutingEngine struct {
-		routings []*RoutingRecord
-		mu       sync.RWMutex
+		routings     []*RoutingRecord
+		file         string // rdb.json path changes are persisted to
+		version      uint64 // of routings, incremented at each change
+		savedVersion uint64 // last version written to file
+		mu           sync.RWMutex
+		saveMu       sync.Mutex // serializes file writes, done out of mu so routing is not blocked by disk I/O
 	}
 )
 
@@ -39,24 +57,38 @@ const (
 	EchoResponder         CallFlow = "EchoResponder"
 )
 
+const redactedPassword = "********"
+
+var (
+	ErrRecordExists   = errors.New("routing record already exists")
+	ErrRecordNotFound = errors.New("routing record not found")
+	ErrRecordNotSaved = errors.New("routing DB updated but not saved")
+)
+
+type routingDBEntry struct {
+	UserpartPattern string         `json:"userpartPattern"`
+	RD              *RoutingRecord `json:"routingRecord"`
+}
+
 func NewRoutingEngine() *RoutingEngine {
 	return &RoutingEngine{}
 }
 
 func (re *RoutingEngine) ReloadConfig() {
-	data := readJsonFile()
+	data, file := readJsonFile()
 	re.ReadConfig(data)
+	re.mu.Lock()
+	re.file = file
+	re.mu.Unlock()
 }
 
 func (re *RoutingEngine) ReadConfig(data []byte) {
 	re.mu.Lock()
 	defer re.mu.Unlock()
 
-	var rdp []struct {
-		UserpartPattern string        `json:"userpartPattern"`
-		RD              RoutingRecord `json:"routingRecord"`
-	}
+	var rdp []routingDBEntry
 	if err := json.Unmarshal(data, &rdp); err != nil {
+		global.LogError(global.LTConfigFiles, "Error parsing Routing DB", "error", err)
 		return
 	}
 
@@ -64,32 +96,211 @@ func (re *RoutingEngine) ReadConfig(data []byte) {
 
 	re.routings = make([]*RoutingRecord, 0, total)
 
-	fmt.Print("Loading Routing DB...")
 	for _, r := range rdp {
-		if r.RD.OutCallFlow != EchoResponder && r.RD.No18xTimeout <= 0 && r.RD.NoAnswerTimeout <= 0 {
-			fmt.Println("Both No18xTimeout and NoAnswerTimeout are disabled - Skipped")
+		if r.RD == nil {
+			global.LogWarning(global.LTConfiguration, "Missing routingRecord - Skipped", "pattern", r.UserpartPattern)
 			continue
 		}
-		upRegex, err := regexp.Compile(r.UserpartPattern)
-		if err != nil {
-			fmt.Printf("Invalid UserpartPattern: %s - Skipped\n", err.Error())
+		if err := r.RD.prepare(r.UserpartPattern); err != nil {
+			global.LogWarning(global.LTConfiguration, "Invalid routing record - Skipped", "pattern", r.UserpartPattern, "error", err)
 			continue
 		}
-		r.RD.UserpartPattern = upRegex.String()
-		r.RD.InRegex = upRegex
-		if r.RD.OutRuriHostport != "" {
-			uaddr, err := global.BuildUdpSocket(r.RD.OutRuriHostport, global.SipPort)
-			if err != nil {
-				fmt.Printf("Bad OutRuriHostport: %s (%q) - Skipped\n", r.RD.OutRuriHostport, err)
-				continue
-			}
-			r.RD.RemoteUDPSocket = uaddr
+		re.routings = append(re.routings, r.RD)
+	}
+
+	global.LogInfo(global.LTConfiguration, "Routing DB loaded", "totalRecords", total, "validRecords", len(re.routings))
+}
+
+// prepare validates the record and compiles its pattern and remote socket, as done when loading the Routing DB
+func (rd *RoutingRecord) prepare(pattern string) error {
+	if rd.OutCallFlow != EchoResponder && rd.No18xTimeout <= 0 && rd.NoAnswerTimeout <= 0 {
+		return errors.New("both No18xTimeout and NoAnswerTimeout are disabled")
+	}
+	if rd.AuthPassword != "" && rd.AuthUsername == "" {
+		return errors.New("authPassword requires authUsername")
+	}
+	upRegex, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid userpartPattern: %w", err)
+	}
+	rd.UserpartPattern = upRegex.String()
+	rd.InRegex = upRegex
+	rd.RemoteUDPSocket = nil
+	if rd.OutRuriHostport != "" {
+		uaddr, err := global.BuildUdpSocket(rd.OutRuriHostport, global.SipPort)
+		if err != nil {
+			return fmt.Errorf("bad outRuriHostport: %w", err)
 		}
-		r.RD.IsDB = true
-		re.routings = append(re.routings, &r.RD)
+		rd.RemoteUDPSocket = uaddr
+	}
+	if rd.DTMFMode == "" {
+		rd.DTMFMode = DTMFTransparent
+	} else if !rd.DTMFMode.IsValid() {
+		return fmt.Errorf("invalid dtmfMode %q", rd.DTMFMode)
+	}
+	if rd.SDPPolicy != nil && !rd.SDPPolicy.IsValid() {
+		return fmt.Errorf("invalid sdpPolicy ptime %d", rd.SDPPolicy.Ptime)
+	}
+	if rd.ENUMSuffix != "" && rd.OutCallFlow == EchoResponder {
+		return errors.New("enumSuffix cannot be used with EchoResponder")
+	}
+	if err := rd.HMR.Validate(); err != nil {
+		return fmt.Errorf("invalid hmr: %w", err)
 	}
+	if rd.MediaTimeout < 0 {
+		return fmt.Errorf("invalid mediaTimeout %d", rd.MediaTimeout)
+	}
+	if rd.MediaTimeout > 0 && !rd.SteerMedia {
+		global.LogWarning(global.LTConfiguration, "MediaTimeout requires SteerMedia - Media timeout disabled", "pattern", pattern)
+		rd.MediaTimeout = 0
+	}
+	if rd.RecordCall && !rd.SteerMedia {
+		global.LogWarning(global.LTConfiguration, "RecordCall requires SteerMedia - Recording disabled", "pattern", pattern)
+		rd.RecordCall = false
+	}
+	if rd.Transcoding && !rd.SteerMedia {
+		global.LogWarning(global.LTConfiguration, "Transcoding requires SteerMedia - Transcoding disabled", "pattern", pattern)
+		rd.Transcoding = false
+	}
+	rd.IsDB = true
+	return nil
+}
+
+// Add validates and inserts the record at position (0 is the first record checked), or at the end if position is out of range
+func (re *RoutingEngine) Add(rd *RoutingRecord, position int) error {
+	if err := rd.prepare(rd.UserpartPattern); err != nil {
+		return err
+	}
+
+	re.mu.Lock()
+	if re.indexOf(rd.UserpartPattern) >= 0 {
+		re.mu.Unlock()
+		return ErrRecordExists
+	}
+	if position < 0 || position > len(re.routings) {
+		position = len(re.routings)
+	}
+	re.routings = slices.Insert(re.routings, position, rd)
+	snap := re.snapshot()
+	re.mu.Unlock()
 
-	fmt.Printf("Done: Total Records: %d, Valid Records: %d\n", total, len(re.routings))
+	global.LogInfo(global.LTConfiguration, "Routing record added", "pattern", rd.UserpartPattern, "position", position)
+	return re.save(snap)
+}
+
+// Update replaces the record having the given pattern, and moves it to position unless negative.
+// An empty or redacted authPassword keeps the current one. Calls in progress keep the record they were routed with
+func (re *RoutingEngine) Update(pattern string, rd *RoutingRecord, position int) error {
+	re.mu.Lock()
+	idx := re.indexOf(pattern)
+	if idx < 0 {
+		re.mu.Unlock()
+		return ErrRecordNotFound
+	}
+	if rd.AuthPassword == "" || rd.AuthPassword == redactedPassword { // as read from the API, kept unless authUsername is removed
+		rd.AuthPassword = ""
+		if rd.AuthUsername != "" {
+			rd.AuthPassword = re.routings[idx].AuthPassword
+		}
+	}
+	if err := rd.prepare(rd.UserpartPattern); err != nil {
+		re.mu.Unlock()
+		return err
+	}
+	if rd.UserpartPattern != pattern && re.indexOf(rd.UserpartPattern) >= 0 {
+		re.mu.Unlock()
+		return ErrRecordExists
+	}
+	re.routings = slices.Delete(re.routings, idx, idx+1)
+	if position < 0 {
+		position = idx
+	}
+	position = min(position, len(re.routings))
+	re.routings = slices.Insert(re.routings, position, rd)
+	snap := re.snapshot()
+	re.mu.Unlock()
+
+	global.LogInfo(global.LTConfiguration, "Routing record updated", "pattern", rd.UserpartPattern, "position", position)
+	return re.save(snap)
+}
+
+func (re *RoutingEngine) Delete(pattern string) error {
+	re.mu.Lock()
+	idx := re.indexOf(pattern)
+	if idx < 0 {
+		re.mu.Unlock()
+		return ErrRecordNotFound
+	}
+	re.routings = slices.Delete(re.routings, idx, idx+1)
+	snap := re.snapshot()
+	re.mu.Unlock()
+
+	global.LogInfo(global.LTConfiguration, "Routing record deleted", "pattern", pattern)
+	return re.save(snap)
+}
+
+func (re *RoutingEngine) indexOf(pattern string) int {
+	return slices.IndexFunc(re.routings, func(rd *RoutingRecord) bool { return rd.UserpartPattern == pattern })
+}
+
+// Config returns the Routing DB in the rdb.json format
+func (re *RoutingEngine) Config() ([]byte, error) {
+	re.mu.RLock()
+	defer re.mu.RUnlock()
+
+	return re.marshalConfig()
+}
+
+func (re *RoutingEngine) marshalConfig() ([]byte, error) {
+	rdp := make([]routingDBEntry, 0, len(re.routings))
+	for _, rd := range re.routings {
+		rdp = append(rdp, routingDBEntry{UserpartPattern: rd.UserpartPattern, RD: rd})
+	}
+	return json.MarshalIndent(rdp, "", "  ")
+}
+
+// routingSnapshot is a changed Routing DB and the file it is to be saved to
+type routingSnapshot struct {
+	file    string
+	data    []byte
+	version uint64
+	err     error
+}
+
+// snapshot marshals the changed Routing DB, to be saved once the lock is released - Unsafe
+func (re *RoutingEngine) snapshot() routingSnapshot {
+	re.version++
+	snap := routingSnapshot{file: re.file, version: re.version}
+	if snap.file != "" {
+		snap.data, snap.err = re.marshalConfig()
+	}
+	return snap
+}
+
+// save writes a Routing DB snapshot back to the file it was loaded from, through a temporary file so it is never left truncated.
+// Snapshots older than the last written one are skipped, concurrent changes being saved in any order
+func (re *RoutingEngine) save(snap routingSnapshot) error {
+	if snap.file == "" {
+		return nil
+	}
+	if snap.err != nil {
+		return fmt.Errorf("%w: %w", ErrRecordNotSaved, snap.err)
+	}
+	re.saveMu.Lock()
+	defer re.saveMu.Unlock()
+	if snap.version <= re.savedVersion {
+		return nil
+	}
+	tmp := snap.file + ".tmp"
+	if err := os.WriteFile(tmp, snap.data, 0o644); err != nil {
+		return fmt.Errorf("%w: %w", ErrRecordNotSaved, err)
+	}
+	if err := os.Rename(tmp, snap.file); err != nil {
+		return fmt.Errorf("%w: %w", ErrRecordNotSaved, err)
+	}
+	re.savedVersion = snap.version
+	global.LogInfo(global.LTConfigFiles, "Routing DB saved", "file", snap.file)
+	return nil
 }
 
 func (re *RoutingEngine) Get(userpart string) (*RoutingRecord, string) {
@@ -105,9 +316,31 @@ func (re *RoutingEngine) Get(userpart string) (*RoutingRecord, string) {
 	return nil, ""
 }
 
+// Position returns the index of the record in the Routing DB, -1 if not found
+func (re *RoutingEngine) Position(rd *RoutingRecord) int {
+	re.mu.RLock()
+	defer re.mu.RUnlock()
+
+	return slices.Index(re.routings, rd)
+}
+
 func (re *RoutingEngine) MarshalJSON() ([]byte, error) {
 	re.mu.RLock()
 	defer re.mu.RUnlock()
 
-	return json.Marshal(re.routings)
+	routings := make([]*RoutingRecord, 0, len(re.routings))
+	for _, rd := range re.routings {
+		routings = append(routings, rd.Redacted())
+	}
+	return json.Marshal(routings)
+}
+
+// Redacted returns a copy of the record with its password masked, for the API
+func (rd *RoutingRecord) Redacted() *RoutingRecord {
+	if rd.AuthPassword == "" {
+		return rd
+	}
+	rdc := *rd
+	rdc.AuthPassword = redactedPassword
+	return &rdc
 }
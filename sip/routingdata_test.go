@@ -0,0 +1,135 @@
+package sip_test
+
+import (
+	"SRGo/sip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRDB = `[
+  {"userpartPattern": "^(12355)$", "routingRecord": {"no18xTimeout": 7, "outRuriUserpart": "$1", "outCallFlow": "Transparent"}},
+  {"userpartPattern": "^(99999)$", "routingRecord": {"outCallFlow": "EchoResponder"}},
+  {"userpartPattern": "^(123", "routingRecord": {"no18xTimeout": 7}},
+  {"userpartPattern": "^(777)$", "routingRecord": {"outCallFlow": "Transparent"}},
+  {"userpartPattern": "\\d+", "routingRecord": {"noAnswerTimeout": 60, "outRuriUserpart": "12388", "outCallFlow": "Transparent"}}
+]`
+
+func patterns(t *testing.T, re *sip.RoutingEngine) []string {
+	t.Helper()
+	var out []string
+	for _, number := range []string{"12355", "99999", "4444", "55555"} {
+		if rd, _ := re.Get(number); rd != nil {
+			out = append(out, rd.UserpartPattern)
+		}
+	}
+	return out
+}
+
+func TestRoutingEngineCRUD(t *testing.T) {
+	t.Parallel()
+
+	re := sip.NewRoutingEngine()
+	re.ReadConfig([]byte(testRDB))
+
+	// invalid pattern and disabled timeouts are skipped, as on load
+	rd, up := re.Get("12355")
+	require.NotNil(t, rd)
+	require.Equal(t, "12355", up)
+	require.Equal(t, 0, re.Position(rd))
+	require.Equal(t, 2, re.Position(mustGet(t, re, "4444")))
+
+	err := re.Add(&sip.RoutingRecord{UserpartPattern: "^(4444)$", No18xTimeout: 5, OutRuriUserpart: "+1$1"}, 0)
+	require.NoError(t, err)
+	rd, up = re.Get("4444")
+	require.Equal(t, "^(4444)$", rd.UserpartPattern)
+	require.Equal(t, "+14444", up)
+	require.Equal(t, 0, re.Position(rd))
+
+	err = re.Add(&sip.RoutingRecord{UserpartPattern: "^(4444)$", No18xTimeout: 5}, -1)
+	require.ErrorIs(t, err, sip.ErrRecordExists)
+	err = re.Add(&sip.RoutingRecord{UserpartPattern: "^(5555)$"}, -1)
+	require.Error(t, err, "both timeouts disabled")
+	err = re.Add(&sip.RoutingRecord{UserpartPattern: "^(5555", No18xTimeout: 5}, -1)
+	require.Error(t, err, "invalid pattern")
+	err = re.Add(&sip.RoutingRecord{UserpartPattern: "^(5555)$", No18xTimeout: 5, DTMFMode: "bad"}, -1)
+	require.Error(t, err, "invalid dtmfMode")
+
+	// moved after the catch-all, so no longer hit
+	err = re.Update("^(4444)$", &sip.RoutingRecord{UserpartPattern: "^(4444)$", No18xTimeout: 5}, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"^(12355)$", "^(99999)$", `\d+`, `\d+`}, patterns(t, re))
+
+	err = re.Update("^(1)$", &sip.RoutingRecord{UserpartPattern: "^(1)$", No18xTimeout: 5}, -1)
+	require.ErrorIs(t, err, sip.ErrRecordNotFound)
+	err = re.Update("^(4444)$", &sip.RoutingRecord{UserpartPattern: `\d+`, No18xTimeout: 5}, -1)
+	require.ErrorIs(t, err, sip.ErrRecordExists)
+
+	require.NoError(t, re.Delete(`\d+`))
+	require.ErrorIs(t, re.Delete(`\d+`), sip.ErrRecordNotFound)
+	require.Equal(t, []string{"^(12355)$", "^(99999)$", "^(4444)$"}, patterns(t, re))
+
+	// the saved format loads back to the same records
+	data, err := re.Config()
+	require.NoError(t, err)
+	re2 := sip.NewRoutingEngine()
+	re2.ReadConfig(data)
+	require.Equal(t, patterns(t, re), patterns(t, re2))
+	_, up = re2.Get("12355")
+	require.Equal(t, "12355", up)
+}
+
+func mustGet(t *testing.T, re *sip.RoutingEngine, number string) *sip.RoutingRecord {
+	t.Helper()
+	rd, _ := re.Get(number)
+	require.NotNil(t, rd)
+	return rd
+}
+
+func TestRoutingCredentials(t *testing.T) {
+	t.Parallel()
+
+	re := sip.NewRoutingEngine()
+	re.ReadConfig([]byte(`[
+  {"userpartPattern": "^(1)$", "routingRecord": {"noAnswerTimeout": 60, "authUsername": "sr", "authPassword": "secret"}},
+  {"userpartPattern": "^(2)$", "routingRecord": {"noAnswerTimeout": 60, "authPassword": "secret"}}
+]`))
+
+	rd := mustGet(t, re, "1")
+	require.Equal(t, "secret", rd.AuthPassword)
+	rd2, _ := re.Get("2")
+	require.Nil(t, rd2, "password without username is skipped")
+
+	// the API hides the password, the saved file keeps it
+	data, err := re.MarshalJSON()
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "secret")
+	require.Contains(t, string(data), `"authUsername":"sr"`)
+	data, err = re.Config()
+	require.NoError(t, err)
+	require.Contains(t, string(data), "secret")
+
+	// a record read from the API and put back keeps its password
+	require.NoError(t, re.Update("^(1)$", rd.Redacted(), -1))
+	require.Equal(t, "secret", mustGet(t, re, "1").AuthPassword)
+	require.NoError(t, re.Update("^(1)$", &sip.RoutingRecord{UserpartPattern: "^(1)$", NoAnswerTimeout: 60, AuthUsername: "sr"}, -1))
+	require.Equal(t, "secret", mustGet(t, re, "1").AuthPassword)
+	require.NoError(t, re.Update("^(1)$", &sip.RoutingRecord{UserpartPattern: "^(1)$", NoAnswerTimeout: 60, AuthUsername: "sr", AuthPassword: "new"}, -1))
+	require.Equal(t, "new", mustGet(t, re, "1").AuthPassword)
+	require.NoError(t, re.Update("^(1)$", &sip.RoutingRecord{UserpartPattern: "^(1)$", NoAnswerTimeout: 60, AuthPassword: "********"}, -1))
+	require.Empty(t, mustGet(t, re, "1").AuthPassword, "dropped with authUsername")
+}
+
+func TestRoutingMediaTimeout(t *testing.T) {
+	t.Parallel()
+
+	re := sip.NewRoutingEngine()
+	err := re.Add(&sip.RoutingRecord{UserpartPattern: "^(1)$", NoAnswerTimeout: 60, MediaTimeout: -1, SteerMedia: true}, -1)
+	require.Error(t, err, "negative mediaTimeout")
+
+	require.NoError(t, re.Add(&sip.RoutingRecord{UserpartPattern: "^(2)$", NoAnswerTimeout: 60, MediaTimeout: 30}, -1))
+	require.Zero(t, mustGet(t, re, "2").MediaTimeout, "disabled without steerMedia")
+
+	require.NoError(t, re.Add(&sip.RoutingRecord{UserpartPattern: "^(3)$", NoAnswerTimeout: 60, MediaTimeout: 30, SteerMedia: true}, -1))
+	require.Equal(t, 30, mustGet(t, re, "3").MediaTimeout)
+}
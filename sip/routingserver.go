@@ -0,0 +1,165 @@
+package sip
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "SRGo/global"
+)
+
+type (
+	// RoutingQuery is POSTed to the routing server for each inbound call not towards a registered phone
+	RoutingQuery struct {
+		CallID     string              `json:"callId"`
+		Caller     string              `json:"caller"`
+		Callee     string              `json:"callee"`
+		SourceIP   string              `json:"sourceIp"`
+		SourcePort int                 `json:"sourcePort"`
+		Headers    map[string][]string `json:"headers"`
+	}
+
+	// RoutingServer asks an HTTP routing server for the routing record of each call; it answers 200 with a routing record
+	// (outRuriUserpart being the translated called userpart and userpartPattern, if any, the route name) or 404 when there is no route
+	RoutingServer struct {
+		client *http.Client
+		cache  map[string]cachedRoute
+		url    string
+		ttl    time.Duration
+		mu     sync.Mutex
+	}
+
+	cachedRoute struct {
+		expiry time.Time
+		rd     *RoutingRecord // nil when not routable
+	}
+)
+
+var errRoutingServer = errors.New("routing server failure")
+
+func NewRoutingServer(url string, timeout, cacheTTL time.Duration) *RoutingServer {
+	return &RoutingServer{
+		client: &http.Client{Timeout: timeout},
+		cache:  make(map[string]cachedRoute),
+		url:    url,
+		ttl:    cacheTTL,
+	}
+}
+
+func (ss *SipSession) routingQuery(sipmsg *SipMessage) RoutingQuery {
+	q := RoutingQuery{
+		CallID:  ss.CallID,
+		Caller:  GetURIUsername(sipmsg.Headers.ValueHeader(From)),
+		Callee:  sipmsg.StartLine.UserPart,
+		Headers: make(map[string][]string),
+	}
+	if rmt := ss.RemoteUDP(); rmt != nil {
+		q.SourceIP, q.SourcePort = rmt.IP.String(), rmt.Port
+	}
+	for _, h := range sipmsg.Headers.GetHeaderNames() {
+		_, q.Headers[h] = sipmsg.Headers.Values(h)
+	}
+	return q
+}
+
+// Get returns the routing record of the call and the called userpart to use, a nil record when there is no route,
+// or errRoutingServer when the server cannot be reached or answers otherwise
+func (rs *RoutingServer) Get(q RoutingQuery) (*RoutingRecord, string, error) {
+	key := strings.Join([]string{q.Caller, q.Callee, q.SourceIP}, "|")
+	now := time.Now()
+
+	rs.mu.Lock()
+	cr, ok := rs.cache[key]
+	rs.mu.Unlock()
+	if ok && now.Before(cr.expiry) {
+		Prometrics.RoutingServerLookups.WithLabelValues("cached").Inc()
+		return cr.rd, cr.rd.translatedUserpart(q.Callee), nil
+	}
+
+	rd, err := rs.query(q)
+	if err != nil {
+		Prometrics.RoutingServerLookups.WithLabelValues("failed").Inc()
+		return nil, "", fmt.Errorf("%w: %w", errRoutingServer, err)
+	}
+	if rd == nil {
+		Prometrics.RoutingServerLookups.WithLabelValues("noroute").Inc()
+	} else {
+		Prometrics.RoutingServerLookups.WithLabelValues("routed").Inc()
+	}
+
+	if rs.ttl > 0 {
+		rs.mu.Lock()
+		if len(rs.cache) >= QueueSize {
+			rs.purge(now)
+		}
+		rs.cache[key] = cachedRoute{expiry: now.Add(rs.ttl), rd: rd}
+		rs.mu.Unlock()
+	}
+	return rd, rd.translatedUserpart(q.Callee), nil
+}
+
+// purge removes the expired entries, then the oldest ones if the cache is still full - Unsafe
+func (rs *RoutingServer) purge(now time.Time) {
+	for k, v := range rs.cache {
+		if now.After(v.expiry) {
+			delete(rs.cache, k)
+		}
+	}
+	for len(rs.cache) >= QueueSize {
+		var oldest string
+		for k, v := range rs.cache {
+			if oldest == "" || v.expiry.Before(rs.cache[oldest].expiry) {
+				oldest = k
+			}
+		}
+		delete(rs.cache, oldest)
+	}
+}
+
+func (rs *RoutingServer) query(q RoutingQuery) (*RoutingRecord, error) {
+	body, _ := json.Marshal(q)
+	req, err := http.NewRequest(http.MethodPost, rs.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", B2BUANameVersion)
+	resp, err := rs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var rd RoutingRecord
+	if err := json.NewDecoder(resp.Body).Decode(&rd); err != nil {
+		return nil, fmt.Errorf("invalid routing record: %w", err)
+	}
+	if err := rd.prepare(rd.UserpartPattern); err != nil {
+		return nil, fmt.Errorf("invalid routing record: %w", err)
+	}
+	rd.fromServer = true
+	return &rd, nil
+}
+
+// translatedUserpart is the called userpart of a record from the routing server, already translated
+func (rd *RoutingRecord) translatedUserpart(callee string) string {
+	if rd == nil {
+		return ""
+	}
+	if rd.OutRuriUserpart == "" {
+		return callee
+	}
+	return rd.OutRuriUserpart
+}
@@ -0,0 +1,74 @@
+package sip_test
+
+import (
+	"SRGo/global"
+	"SRGo/prometheus"
+	"SRGo/sip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingServer(t *testing.T) {
+	global.Prometrics = prometheus.NewMetrics("test")
+
+	var queries atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		var q sip.RoutingQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+		switch q.Callee {
+		case "12355":
+			_, _ = w.Write([]byte(`{"userpartPattern": "^123", "outRuriUserpart": "+2012355", "outRuriHostport": "192.168.1.2:5098",
+				"no18xTimeout": 7, "outCallFlow": "Transparent", "hmr": {"set": {"X-Customer": "42"}, "remove": ["P-Charging-Vector"]}}`))
+		case "666":
+			_, _ = w.Write([]byte(`{"outRuriHostport": "192.168.1.2:5098"}`)) // both timeouts disabled
+		case "777":
+			_, _ = w.Write([]byte(`{"no18xTimeout": 7, "hmr": {"remove": ["Call-ID"]}}`))
+		case "500":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	rs := sip.NewRoutingServer(srv.URL, 100*time.Millisecond, time.Minute)
+	q := sip.RoutingQuery{Caller: "1001", Callee: "12355", SourceIP: "10.0.0.1"}
+
+	rd, up, err := rs.Get(q)
+	require.NoError(t, err)
+	require.Equal(t, "+2012355", up)
+	require.Equal(t, "^123", rd.UserpartPattern)
+	require.Equal(t, "routingserver", rd.RouteName(), "not labelled by its pattern")
+	require.Equal(t, "192.168.1.2:5098", rd.RemoteUDPSocket.String())
+	require.Equal(t, "42", rd.HMR.Set["X-Customer"])
+
+	rd2, up, err := rs.Get(q) // cached
+	require.NoError(t, err)
+	require.Same(t, rd, rd2)
+	require.Equal(t, "+2012355", up)
+	require.Equal(t, int32(1), queries.Load())
+
+	q.Callee = "999"
+	rd, _, err = rs.Get(q)
+	require.NoError(t, err)
+	require.Nil(t, rd, "no route")
+
+	for _, callee := range []string{"666", "777", "500", "slow"} {
+		q.Callee = callee
+		_, _, err = rs.Get(q)
+		require.Error(t, err, callee)
+	}
+
+	rs = sip.NewRoutingServer("http://127.0.0.1:1", 100*time.Millisecond, 0)
+	_, _, err = rs.Get(q)
+	require.Error(t, err, "unreachable")
+}
@@ -0,0 +1,149 @@
+package sip
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Moatassem/sdp"
+)
+
+// SDPPolicy rewrites the SDP of a route calls, applied to offers and answers sent on both call legs
+type SDPPolicy struct {
+	AllowedCodecs   []string `json:"allowedCodecs,omitempty"`   // when set, only these codecs are kept - telephone-event is kept unless denied
+	DeniedCodecs    []string `json:"deniedCodecs,omitempty"`    // codecs removed
+	CodecOrder      []string `json:"codecOrder,omitempty"`      // preferred codecs first, others keep their order after
+	StripAttributes []string `json:"stripAttributes,omitempty"` // attributes removed from session and media levels e.g. rtcp-fb, ssrc
+	Ptime           int      `json:"ptime,omitempty"`           // enforced on audio streams
+	StripVideo      bool     `json:"stripVideo,omitempty"`      // video streams declined (port 0), m-lines kept as per RFC 3264
+	ForceSendRecv   bool     `json:"forceSendRecv,omitempty"`
+}
+
+const maxPtime = 200 // ms
+
+// static payload types may come with no rtpmap
+var staticPayloadNames = map[uint8]string{0: "PCMU", 3: "GSM", 4: "G723", 8: "PCMA", 9: "G722", 13: "CN", 18: "G729"}
+
+func (p *SDPPolicy) IsValid() bool {
+	return p.Ptime >= 0 && p.Ptime <= maxPtime
+}
+
+// Apply rewrites the SDP session in place
+func (p *SDPPolicy) Apply(sdpSession *sdp.Session) {
+	if p == nil {
+		return
+	}
+	if len(p.StripAttributes) > 0 {
+		sdpSession.Attributes = p.stripAttributes(sdpSession.Attributes)
+	}
+	if p.ForceSendRecv {
+		sdpSession.Mode = sdp.SendRecv
+	}
+	for _, media := range sdpSession.Media {
+		if media.Port == 0 {
+			continue
+		}
+		if p.StripVideo && media.Type == "video" {
+			media.Port = 0
+			continue
+		}
+		if len(p.StripAttributes) > 0 {
+			media.Attributes = p.stripAttributes(media.Attributes)
+		}
+		if p.ForceSendRecv {
+			media.Mode = sdp.SendRecv
+		}
+		if media.Type != "audio" && media.Type != "video" {
+			continue
+		}
+		p.filterCodecs(media)
+		p.orderCodecs(media)
+		if p.Ptime > 0 && media.Type == "audio" {
+			setAttribute(media, "ptime", strconv.Itoa(p.Ptime))
+		}
+	}
+}
+
+func (p *SDPPolicy) filterCodecs(media *sdp.Media) {
+	if len(p.AllowedCodecs) == 0 && len(p.DeniedCodecs) == 0 {
+		return
+	}
+	formats := make([]*sdp.Format, 0, len(media.Format))
+	for _, f := range media.Format {
+		name := codecName(f)
+		if containsFold(p.DeniedCodecs, name) {
+			continue
+		}
+		if len(p.AllowedCodecs) > 0 && !containsFold(p.AllowedCodecs, name) && !strings.EqualFold(name, telephoneEvent) {
+			continue
+		}
+		formats = append(formats, f)
+	}
+	if !slices.ContainsFunc(formats, isMediaCodec) {
+		// no acceptable codec (telephone-event or comfort noise alone cannot carry audio),
+		// decline the stream keeping a format for a valid m-line
+		media.Port = 0
+		if len(media.Format) > 1 {
+			media.Format = media.Format[:1]
+		}
+		return
+	}
+	media.Format = formats
+}
+
+func (p *SDPPolicy) orderCodecs(media *sdp.Media) {
+	if len(p.CodecOrder) == 0 {
+		return
+	}
+	rank := func(f *sdp.Format) int {
+		name := codecName(f)
+		for i, c := range p.CodecOrder {
+			if strings.EqualFold(c, name) {
+				return i
+			}
+		}
+		return len(p.CodecOrder)
+	}
+	slices.SortStableFunc(media.Format, func(a, b *sdp.Format) int {
+		return rank(a) - rank(b)
+	})
+}
+
+func (p *SDPPolicy) stripAttributes(attrs []*sdp.Attr) []*sdp.Attr {
+	kept := attrs[:0]
+	for _, attr := range attrs {
+		if !containsFold(p.StripAttributes, attr.Name) {
+			kept = append(kept, attr)
+		}
+	}
+	return kept
+}
+
+func setAttribute(media *sdp.Media, name, value string) {
+	for _, attr := range media.Attributes {
+		if attr.Name == name {
+			attr.Value = value
+			return
+		}
+	}
+	media.Attributes = append(media.Attributes, &sdp.Attr{Name: name, Value: value})
+}
+
+// isMediaCodec tells whether the format carries media, rather than events or comfort noise
+func isMediaCodec(f *sdp.Format) bool {
+	name := codecName(f)
+	return !strings.EqualFold(name, telephoneEvent) && !strings.EqualFold(name, "CN")
+}
+
+func codecName(f *sdp.Format) string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return staticPayloadNames[f.Payload]
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(item string) bool {
+		return strings.EqualFold(item, s)
+	})
+}
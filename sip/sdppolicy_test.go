@@ -0,0 +1,81 @@
+package sip_test
+
+import (
+	"SRGo/sip"
+	"testing"
+
+	"github.com/Moatassem/sdp"
+	"github.com/stretchr/testify/require"
+)
+
+func audioSession() *sdp.Session {
+	return &sdp.Session{
+		Media: []*sdp.Media{
+			{
+				Type: "audio",
+				Port: 4000,
+				Format: []*sdp.Format{
+					{Payload: 0, Name: "PCMU"},
+					{Payload: 8, Name: "PCMA"},
+					{Payload: 18},
+					{Payload: 101, Name: "telephone-event"},
+				},
+				Attributes: []*sdp.Attr{{Name: "rtcp-fb", Value: "* nack"}, {Name: "ptime", Value: "20"}},
+			},
+			{Type: "video", Port: 4002, Format: []*sdp.Format{{Payload: 96, Name: "H264"}}},
+		},
+	}
+}
+
+func payloads(media *sdp.Media) []uint8 {
+	var pts []uint8
+	for _, f := range media.Format {
+		pts = append(pts, f.Payload)
+	}
+	return pts
+}
+
+func TestSDPPolicyCodecs(t *testing.T) {
+	t.Parallel()
+
+	s := audioSession()
+	(&sip.SDPPolicy{AllowedCodecs: []string{"pcma", "G729"}, CodecOrder: []string{"G729"}}).Apply(s)
+	require.Equal(t, 4000, s.Media[0].Port)
+	require.Equal(t, []uint8{18, 8, 101}, payloads(s.Media[0]), "static G729 named, telephone-event kept")
+
+	s = audioSession()
+	(&sip.SDPPolicy{DeniedCodecs: []string{"PCMU", "telephone-event"}}).Apply(s)
+	require.Equal(t, []uint8{8, 18}, payloads(s.Media[0]))
+}
+
+func TestSDPPolicyNoAllowedCodec(t *testing.T) {
+	t.Parallel()
+
+	s := audioSession()
+	(&sip.SDPPolicy{AllowedCodecs: []string{"opus", "H264"}}).Apply(s)
+	require.Zero(t, s.Media[0].Port, "telephone-event alone declined")
+	require.Len(t, s.Media[0].Format, 1, "a format kept for a valid m-line")
+	require.Equal(t, 4002, s.Media[1].Port)
+
+	s = audioSession()
+	(&sip.SDPPolicy{DeniedCodecs: []string{"PCMU", "PCMA", "G729"}}).Apply(s)
+	require.Zero(t, s.Media[0].Port)
+
+	s = audioSession()
+	s.Media[0].Format = nil
+	require.NotPanics(t, func() { (&sip.SDPPolicy{AllowedCodecs: []string{"PCMA"}}).Apply(s) })
+	require.Zero(t, s.Media[0].Port, "no format at all")
+}
+
+func TestSDPPolicyAttributes(t *testing.T) {
+	t.Parallel()
+
+	s := audioSession()
+	(&sip.SDPPolicy{StripAttributes: []string{"RTCP-FB"}, Ptime: 30, StripVideo: true}).Apply(s)
+	require.Equal(t, []*sdp.Attr{{Name: "ptime", Value: "30"}}, []*sdp.Attr(s.Media[0].Attributes))
+	require.Zero(t, s.Media[1].Port, "video declined")
+	require.Len(t, s.Media, 2, "declined m-line kept")
+
+	require.True(t, (&sip.SDPPolicy{Ptime: 200}).IsValid())
+	require.False(t, (&sip.SDPPolicy{Ptime: 201}).IsValid())
+}
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"SRGo/cdr"
 	. "SRGo/global"
+	"SRGo/phone"
 	"SRGo/q850"
+	"SRGo/recording"
 	"SRGo/sip/mode"
 	"SRGo/sip/state"
 	"SRGo/sip/status"
@@ -18,15 +22,15 @@ import (
 )
 
 type SipSession struct {
-	remoteMediaUdpAddr    atomic.Value // *net.UDPAddr
 	SDPSession            *sdp.Session
 	no18xSTimer           *time.Timer
-	MediaConn             *net.UDPConn
 	udpListenser          *net.UDPConn
 	RemoteUserAgent       *SipUdpUserAgent
 	LinkedSession         *SipSession
-	RoutingData           *RoutingRecord
-	probDoneChan          chan struct{} // used to send kill signal to probingTicker handler
+	trunk                 *Trunk                             // trunk registered by the session or its calls are sent through
+	ladder                *ladder                            // SIP messages of the call, shared by both call legs, nil if not an INVITE dialog
+	recorder              atomic.Pointer[recording.Recorder] // shared by both call legs
+	probDoneChan          chan struct{}                      // used to send kill signal to probingTicker handler
 	noAnsSTimer           *time.Timer
 	maxDurationTimer      *time.Timer // used on inbound sessions only
 	remoteUDP             *net.UDPAddr
@@ -40,26 +44,45 @@ type SipSession struct {
 	ToHeader              string
 	FromHeader            string
 	CallID                string
+	trafficRoute          string // route and peer the call is counted against in the traffic stats, used in inbound sessions only
+	trafficPeer           string
+	outUserpart           string // RURI userpart of the outbound leg, used in inbound sessions only
 	Mymode                mode.SessionMode
 	RecordRoutes          []string
+	failoverTargets       []*net.UDPAddr // remaining resolved targets of the route, used in inbound sessions only
+	routedBody            *MessageBody   // original body of the inbound INVITE, cloned for each routing attempt, used in inbound sessions only
 	Transactions          []*Transaction
+	mediaStreams          []*MediaStream // anchored m-lines, indexed by their SDP position
+	dtmfEvents            []DTMFEvent    // used in inbound sessions only
 	Relayed18xNotify      []int
 	Direction             Direction
 	state                 state.SessionState
 	SDPSessionVersion     int64
 	SDPSessionID          int64
+	quality               callQuality // RTCP reports received from the remote
 	dscmutex              sync.RWMutex
 	TransLock             sync.RWMutex
 	rmtmutex              sync.RWMutex // used to synchronize remote addresses and local connection
 	stateLock             sync.RWMutex
-	multiUseMutex         sync.Mutex // used for synchronizing no18x & noAns timers, probing & max duration, dropping session
+	mediaMutex            sync.RWMutex // used to synchronize media streams reservation and release
+	dtmfMutex             sync.Mutex
+	dtmfPayload           atomic.Uint32                 // telephone-event payload type negotiated with the remote, 0 if none
+	remoteAudio           atomic.Pointer[[]sdp.Format]  // audio codecs of the last SDP received from the remote
+	transcoder            atomic.Pointer[transcodePath] // applied to RTP received from the remote
+	sdpOfferPending       atomic.Bool                   // an SDP offer was sent to the remote and is not answered yet
+	terminationCause      atomic.Pointer[string]        // used in inbound sessions only
+	lastRTP               atomic.Int64                  // unix nano of the last RTP received from the remote
+	isHeld                atomic.Bool                   // the remote put the call on hold, read by media and API goroutines
+	answeredAt            atomic.Int64                  // unix nano of the ACK of the answered INVITE, used in inbound sessions only
+	routingData           atomic.Pointer[RoutingRecord] // set by the route lookup goroutine, read by the SIP workers, API and media goroutines
+	multiUseMutex         sync.Mutex                    // used for synchronizing no18x & noAns timers, probing & max duration, dropping session
 	RSeq                  uint32
 	FwdCSeq               uint32
 	BwdCSeq               uint32
 	IsDisposed            bool
 	dialogueChanging      bool
+	mediaReleased         bool
 	TransformEarlyToFinal bool
-	isHeld                bool
 	ReferSubscription     bool
 	IsDelayedOfferCall    bool
 	received18xSDP        bool
@@ -83,7 +106,11 @@ func NewSIPSession(sipmsg *SipMessage) *SipSession {
 }
 
 func (session *SipSession) String() string {
-	return fmt.Sprintf("Call-ID: %s, State: %s, Direction: %s, Mode: %s", session.CallID, session.state.String(), session.Direction.String(), session.Mymode)
+	summary := fmt.Sprintf("Call-ID: %s, State: %s, Direction: %s, Mode: %s", session.CallID, session.state.String(), session.Direction.String(), session.Mymode)
+	if stats, ok := session.Quality(); ok {
+		summary += ", " + stats.String()
+	}
+	return summary
 }
 
 func (session *SipSession) ExceedCondition() bool {
@@ -92,17 +119,6 @@ func (session *SipSession) ExceedCondition() bool {
 
 //============================================================
 
-func (session *SipSession) RemoteMediaUdpAddr() *net.UDPAddr {
-	return session.remoteMediaUdpAddr.Load().(*net.UDPAddr)
-}
-
-func (session *SipSession) SetRemoteMediaUdpAddr(rmt *net.UDPAddr) {
-	if rmt == nil {
-		return
-	}
-	session.remoteMediaUdpAddr.Store(rmt)
-}
-
 func (session *SipSession) SetRemoteUDPnListenser(rmt *net.UDPAddr, cn *net.UDPConn) {
 	session.rmtmutex.Lock()
 	defer session.rmtmutex.Unlock()
@@ -440,6 +456,7 @@ func (session *SipSession) Send(tx *Transaction) {
 	if len(tx.SentMessage.Bytes) == 0 {
 		tx.SentMessage.PrepareMessageBytes(session)
 	}
+	countMessage(tx.SentMessage, tx.Method, OUTBOUND)
 
 	// response
 	if tx.SentMessage.IsResponse() {
@@ -464,9 +481,11 @@ func (session *SipSession) Send(tx *Transaction) {
 }
 
 func (session *SipSession) sendmessage(msg *SipMessage, rmt *net.UDPAddr) {
+	session.logDebug(LTSIPStack, "SIP message sent", "message", msg.String(), "destination", rmt.String())
 	_, err := session.UDPListenser().WriteToUDP(msg.Bytes, rmt)
+	session.traceEgress(msg, rmt)
 	if err != nil {
-		LogError(LTSystem, "Failed to send message: "+err.Error())
+		session.logError(LTSystem, "Failed to send message", "error", err)
 	}
 }
 
@@ -477,12 +496,22 @@ func CheckPendingTransaction(ss *SipSession, tx *Transaction) {
 	case OPTIONS:
 		if ss.Mymode == mode.KeepAlive {
 			ss.SetState(state.TimedOut)
+			if ss.RemoteUserAgent != nil {
+				ss.RemoteUserAgent.SetAlive(false)
+				phone.Phones.SetResponsive(ss.RemoteUserAgent, false)
+			}
 			ss.DropMe()
 			return
 		}
 		if ss.Mymode == mode.Multimedia && ss.Direction == INBOUND && tx.Direction == OUTBOUND && tx.IsProbing { // means my in-dialogue probing OPTIONS
 			ss.ReleaseCall("Probing timed-out")
 		}
+	case REGISTER:
+		if ss.trunk != nil {
+			ss.SetState(state.TimedOut)
+			ss.DropMe()
+			ss.trunk.failed(status.RequestTimeout, "no response from registrar")
+		}
 	case INVITE:
 		if ss.IsPending() {
 			ss.SetState(state.TimedOut)
@@ -585,9 +614,9 @@ func (ss *SipSession) StartTimer(tt TimerType) {
 	}
 	var delay int
 	if tt == NoAnswer {
-		delay = ss.RoutingData.NoAnswerTimeout
+		delay = ss.RoutingData().NoAnswerTimeout
 	} else {
-		delay = ss.RoutingData.No18xTimeout
+		delay = ss.RoutingData().No18xTimeout
 	}
 	if delay <= 0 {
 		return
@@ -625,7 +654,7 @@ func (ss *SipSession) timerHandler(tt TimerType) {
 
 func (ss *SipSession) StartInDialogueProbing() {
 	if IndialogueProbingInterval <= 0 {
-		LogWarning(LTConfiguration, "Indialogue Probing duration is set to ZERO/NEGATIVE - Disabled")
+		ss.logWarning(LTConfiguration, "Indialogue Probing duration is set to ZERO/NEGATIVE - Disabled")
 		return
 	}
 	ss.multiUseMutex.Lock()
@@ -635,16 +664,16 @@ func (ss *SipSession) StartInDialogueProbing() {
 }
 
 func (ss *SipSession) StartMaxCallDuration() {
-	if ss.RoutingData == nil {
+	if ss.RoutingData() == nil {
 		if !sippTesting {
-			LogWarning(LTSystem, "Max Call duration not started - missing RoutingData")
+			ss.logWarning(LTSystem, "Max Call duration not started - missing RoutingData")
 		}
 		return
 	}
-	mxD := ss.RoutingData.MaxCallDuration
+	mxD := ss.RoutingData().MaxCallDuration
 	if mxD <= 0 {
 		if !sippTesting {
-			LogWarning(LTConfiguration, "Max Call duration is set to ZERO/NEGATIVE - Disabled")
+			ss.logWarning(LTConfiguration, "Max Call duration is set to ZERO/NEGATIVE - Disabled")
 		}
 		return
 	}
@@ -668,6 +697,15 @@ func (ss *SipSession) probingTickerHandler(doneChan chan struct{}, tkChan <-chan
 
 // ==============================================================================
 
+// RoutingData returns the routing record the call was routed with, nil until routed
+func (session *SipSession) RoutingData() *RoutingRecord {
+	return session.routingData.Load()
+}
+
+func (session *SipSession) SetRoutingData(rd *RoutingRecord) {
+	session.routingData.Store(rd)
+}
+
 func (session *SipSession) GetState() state.SessionState {
 	session.stateLock.RLock()
 	defer session.stateLock.RUnlock()
@@ -722,19 +760,39 @@ func (session *SipSession) IsLinked() bool {
 // ==============================================================================
 
 func (ss *SipSession) ReleaseCall(details string) (s1 bool, s2 bool) {
+	return ss.ReleaseCallCause(0, details)
+}
+
+// ReleaseCallCause releases both legs with a Q.850 cause (0 for a Warning with details only), reported in the CDR
+func (ss *SipSession) ReleaseCallCause(q850Cause int, details string) (s1 bool, s2 bool) {
+	ss.SetTerminationCause(q850Cause, details)
 	if ss.IsEstablished() {
 		ss.SetState(state.BeingDropped)
-		ss.SendCreatedRequestDetailed(RequestPack{Method: BYE, Max70: true, CustomHeaders: NewSHQ850OrSIP(0, details, "")}, nil, ZeroBody())
+		ss.SendCreatedRequestDetailed(RequestPack{Method: BYE, Max70: true, CustomHeaders: NewSHQ850OrSIP(q850Cause, details, "")}, nil, ZeroBody())
 		s1 = true
 	}
 	if lnkss := ss.LinkedSession; lnkss != nil && lnkss.IsEstablished() {
 		lnkss.SetState(state.BeingDropped)
-		lnkss.SendCreatedRequestDetailed(RequestPack{Method: BYE, Max70: true, CustomHeaders: NewSHQ850OrSIP(0, details, "")}, nil, ZeroBody())
+		lnkss.SendCreatedRequestDetailed(RequestPack{Method: BYE, Max70: true, CustomHeaders: NewSHQ850OrSIP(q850Cause, details, "")}, nil, ZeroBody())
 		s2 = true
 	}
 	return
 }
 
+// SetTerminationCause keeps the first call release cause, on the inbound leg.
+// Written in the CDR, so it carries no ";" e.g. `Q.850 cause=102 text="media timeout"`
+func (ss *SipSession) SetTerminationCause(q850Cause int, details string) {
+	details = strings.ReplaceAll(details, ";", ",")
+	cause := details
+	if q850Cause != 0 {
+		cause = fmt.Sprintf("Q.850 cause=%d", q850Cause)
+		if details != "" {
+			cause += fmt.Sprintf(` text="%s"`, details)
+		}
+	}
+	ss.inboundLeg().terminationCause.CompareAndSwap(nil, &cause)
+}
+
 func (ss *SipSession) ReleaseEarlyFinalCall(details string) (s1 bool, s2 bool) {
 	if ss.IsBeingEstablished() {
 		ss.SetState(state.BeingFailed)
@@ -816,12 +874,13 @@ func (session *SipSession) DropMe() {
 	session.multiUseMutex.Lock()
 	defer session.multiUseMutex.Unlock()
 	if session.IsDisposed {
-		fmt.Print("Already Disposed Session: ", session.CallID, " State: ", session.state.String())
+		args := []any{"state", session.state.String()}
 		pc, f, l, ok := runtime.Caller(1) // pc, _, _, ok := runtime.Caller(1)
 		details := runtime.FuncForPC(pc)
 		if ok && details != nil { // f, l := details.FileLine(pc)
-			fmt.Printf(" >> [func (%s) - file (%s) - line (%d)]\n", details.Name(), f, l)
+			args = append(args, "func", details.Name(), "file", f, "line", l)
 		}
+		session.logWarning(LTSIPStack, "Already disposed session", args...)
 		return
 	}
 	close(session.probDoneChan)
@@ -831,14 +890,40 @@ func (session *SipSession) DropMe() {
 	if session.probingTicker != nil {
 		session.probingTicker.Stop()
 	}
-	MediaPortPool.ReleaseSocket(session.MediaConn)
-
-	// Create CDR
-	// sesCDR := cdr.New()
-	// sesCDR.Set(cdr.CallDirection, session.Direction.String())
-	// sesCDR.Flush()
+	session.ReleaseMediaStreams()
+	session.observeQuality()
+	session.countCallEnd()
+	session.publishRelease()
+	rec := session.recorder.Load()
+
+	// Create CDR - once per call, from the inbound leg
+	if session.Direction == INBOUND && session.RoutingData() != nil {
+		sesCDR := cdr.New()
+		sesCDR.Set(cdr.CallID, session.CallID)
+		sesCDR.Set(cdr.CallDirection, session.Direction.String())
+		sesCDR.Set(cdr.CallerNumber, GetURIUsername(session.FromHeader))
+		sesCDR.Set(cdr.CalledNumber, GetURIUsername(session.ToHeader))
+		if cause := session.terminationCause.Load(); cause != nil {
+			sesCDR.Set(cdr.TerminationCause, *cause)
+		}
+		if stats, ok := session.callQuality(); ok {
+			sesCDR.Set(cdr.MOS, fmt.Sprintf("%.2f", stats.MOS))
+			sesCDR.Set(cdr.JitterMS, fmt.Sprintf("%.1f", stats.JitterMS))
+			sesCDR.Set(cdr.PacketLossPercent, fmt.Sprintf("%.2f", stats.LossPct))
+			sesCDR.Set(cdr.RoundTripMS, fmt.Sprintf("%.0f", stats.RTTMS))
+		}
+		go func() {
+			if rec != nil {
+				sesCDR.Set(cdr.CallRecordingURL, rec.Close()) // finalizing a recording may take a while
+			}
+			sesCDR.Flush()
+		}()
+	} else if rec != nil {
+		go rec.Close()
+	}
 
 	session.IsDisposed = true
+	session.retainLadder()
 	Sessions.Delete(session.CallID)
 }
 
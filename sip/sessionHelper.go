@@ -1,10 +1,11 @@
 package sip
 
 import (
+	"SRGo/events"
 	. "SRGo/global"
 	"cmp"
-	"fmt"
-	"log"
+	"slices"
+	"time"
 )
 
 func (session *SipSession) addIncomingRequest(requestMsg *SipMessage, lt *Transaction) *Transaction {
@@ -34,7 +35,7 @@ func (session *SipSession) addIncomingRequest(requestMsg *SipMessage, lt *Transa
 			return nil
 		}
 		if reInviteST.IsACKed {
-			LogWarning(LTSIPStack, fmt.Sprintf("Received duplicate ACK for %s – Call-ID [%s]", reInviteST.RequestMessage.StartLine.Method.String(), requestMsg.CallID))
+			session.logWarning(LTSIPStack, "Received duplicate ACK", "method", reInviteST.RequestMessage.StartLine.Method.String())
 			return nil
 		}
 		if reInviteST.RequireSameViaBranch() == (reInviteST.ViaBranch == requestMsg.ViaBranch) {
@@ -42,7 +43,7 @@ func (session *SipSession) addIncomingRequest(requestMsg *SipMessage, lt *Transa
 			reInviteST.StopTransTimer(true)
 			return reInviteST
 		}
-		LogError(LTSIPStack, fmt.Sprintf("Received ACK with improper Via-Branch for %s – Call-ID [%s]", reInviteST.RequestMessage.StartLine.Method.String(), requestMsg.CallID))
+		session.logError(LTSIPStack, "Received ACK with improper Via-Branch", "method", reInviteST.RequestMessage.StartLine.Method.String())
 		return nil
 	case CANCEL:
 		inviteST := session.GetReOrInviteTransaction(requestMsg.CSeqNum, false)
@@ -56,7 +57,7 @@ func (session *SipSession) addIncomingRequest(requestMsg *SipMessage, lt *Transa
 			session.AddTransaction(st)
 			return st
 		}
-		log.Printf("Received CANCEL with improper Via-Branch for INVITE – Call-ID [%s]", requestMsg.CallID)
+		session.logError(LTSIPStack, "Received CANCEL with improper Via-Branch for INVITE")
 		return nil
 	case PRACK:
 		var prackST *Transaction
@@ -65,12 +66,12 @@ func (session *SipSession) addIncomingRequest(requestMsg *SipMessage, lt *Transa
 			if prackST == nil {
 				prackST = NewSIPTransaction_RP(0, PRACKUnexpected)
 				session.AddTransaction(prackST)
-				LogError(LTSIPStack, fmt.Sprintf("Cannot find unPRACKed 1xx response for the incoming PRACK – Call-ID [%s]", requestMsg.CallID))
+				session.logError(LTSIPStack, "Cannot find unPRACKed 1xx response for the incoming PRACK")
 			}
 		} else {
 			prackST = NewSIPTransaction_RP(0, PRACKMissingBadRAck)
 			session.AddTransaction(prackST)
-			LogError(LTSIPStack, fmt.Sprintf("Cannot parse RAck header or it is missing for the incoming PRACK – Call-ID [%s]", requestMsg.CallID))
+			session.logError(LTSIPStack, "Cannot parse RAck header or it is missing for the incoming PRACK")
 		}
 		prackST.RequestMessage = requestMsg
 		prackST.CSeq = requestMsg.CSeqNum
@@ -104,6 +105,10 @@ func (session *SipSession) addIncomingResponse(responseMsg *SipMessage) *Transac
 		st.Lock.Lock()
 		rc := responseMsg.StartLine.StatusCode
 		st.StopTransTimer(false)
+		if st.Method == INVITE && st.Direction == OUTBOUND && IsProvisional18x(rc) && !slices.ContainsFunc(st.Responses, IsProvisional18x) {
+			Prometrics.PostDialDelay.Observe(time.Since(st.TransTime).Seconds())
+			session.publishEvent(events.Ringing, func(e *events.Event) { e.StatusCode = rc })
+		}
 		st.Responses = append(st.Responses, rc)
 		st.IsFinalized = cmp.Or(st.IsFinalized, rc >= 200)
 		if st.IsFinalized {
@@ -148,7 +153,7 @@ func (session *SipSession) addOutgoingRequest(rt Method, lt *Transaction) *Trans
 				lt = session.GetUnACKedINVorReINV()
 			}
 			if lt == nil {
-				LogError(LTSIPStack, fmt.Sprintf("Unable to find applicable (Re)INVITE transaction for Call-ID [%s]", session.CallID))
+				session.logError(LTSIPStack, "Unable to find applicable (Re)INVITE transaction")
 				return nil
 			}
 			lt.IsACKed = true
@@ -158,7 +163,7 @@ func (session *SipSession) addOutgoingRequest(rt Method, lt *Transaction) *Trans
 				lt = session.GetLastUnACKedINV(OUTBOUND)
 			}
 			if lt == nil {
-				LogError(LTSIPStack, fmt.Sprintf("Unable to find applicable INVITE transaction for Call-ID [%s]", session.CallID))
+				session.logError(LTSIPStack, "Unable to find applicable INVITE transaction")
 				return nil
 			}
 			st = lt.CreateCANCELST()
@@ -198,3 +203,11 @@ func (session *SipSession) addOutgoingRequest(rt Method, lt *Transaction) *Trans
 	}
 	return st
 }
+
+// inboundLeg returns the inbound session of the call, holding call level data
+func (session *SipSession) inboundLeg() *SipSession {
+	if session.Direction == OUTBOUND && session.LinkedSession != nil {
+		return session.LinkedSession
+	}
+	return session
+}
@@ -109,6 +109,7 @@ func (session *SipSession) CreateLinkedINVITE(userpart string, body *MessageBody
 	sipmsg.Headers = NewSHsPointer(true)
 	session.Mymode = mode.Multimedia
 	session.proxifyRequestHeaders(sipmsg, trans)
+	session.RoutingData().HMR.Apply(sipmsg.Headers)
 	session.processRequestHeaders(trans, sipmsg, RequestPack{Method: INVITE}, body)
 	return trans, sipmsg
 }
@@ -142,18 +143,22 @@ func (session *SipSession) proxifyRequestHeaders(sipmsg *SipMessage, trans *Tran
 
 	localsocket := GetUDPAddrFromConn(session.UDPListenser())
 	localIP := localsocket.IP
-	remoteIP := session.RemoteUDP().IP
+	remoteHost := session.RemoteUDP().IP.String()
 
 	lnkdsl := lnkdsipmsg.StartLine
 
 	sl := sipmsg.StartLine
 	sl.HostPart = session.RemoteUDP().String()
+	if session.trunk != nil {
+		sl.HostPart = session.trunk.Domain
+		remoteHost = session.trunk.Domain
+	}
 	sl.OriginalUP = lnkdsl.OriginalUP
 	sl.UserParameters = maps.Clone(lnkdsl.UserParameters)
 	sl.Password = lnkdsl.Password
 	sl.UriParameters = maps.Clone(lnkdsl.UriParameters)
 	sl.UriHeaders = lnkdsl.UriHeaders
-	sl.BuildRURI(!session.RoutingData.IsDB)
+	sl.BuildRURI(!session.RoutingData().IsDB)
 
 	var nm, nmbr string
 
@@ -171,6 +176,10 @@ func (session *SipSession) proxifyRequestHeaders(sipmsg *SipMessage, trans *Tran
 		}
 	}
 
+	if session.trunk != nil { // sent from the registered AoR
+		frmHeader = fmt.Sprintf("%s<%s>", nm, session.trunk.AoR())
+	}
+
 	session.FromTag = guid.NewTag()
 	trans.From = fmt.Sprintf("%s;tag=%s", frmHeader, session.FromTag)
 	sipHdrs.SetHeader(From, trans.From)
@@ -184,7 +193,7 @@ func (session *SipSession) proxifyRequestHeaders(sipmsg *SipMessage, trans *Tran
 	if mtch := RMatch(lnkdsipmsg.Headers.ValueHeader(To), NameAndNumber); len(mtch) > 0 {
 		nm = TrimWithSuffix(mtch[1], " ")
 		nmbr = DropVisualSeparators(mtch[2])
-		trans.To = fmt.Sprintf("%s<sip:%s@%s;user=phone>", nm, nmbr, remoteIP)
+		trans.To = fmt.Sprintf("%s<sip:%s@%s;user=phone>", nm, nmbr, remoteHost)
 	}
 	sipHdrs.SetHeader(To, trans.To)
 	session.ToHeader = trans.To
@@ -341,7 +350,7 @@ func (session *SipSession) processRequestHeaders(trans *Transaction, sipmsg *Sip
 
 	// Set msgbody
 	sipmsg.Body = msgbody
-	sipmsg.ParseNPrepareSDP(session)
+	sipmsg.ParseNPrepareSDP(session, trans)
 
 	if sl := sipmsg.StartLine; sl.Method == INVITE {
 		trans.RequestMessage = sipmsg
@@ -391,7 +400,7 @@ func (session *SipSession) processRequestHeaders(trans *Transaction, sipmsg *Sip
 
 	// PRACK specific headers
 	if sipmsg.StartLine.Method == PRACK && !session.IsPRACKSupported {
-		LogWarning(LTSIPStack, fmt.Sprintf("UAS requesting 100rel although not offered - Call ID [%s]", session.CallID))
+		session.logWarning(LTSIPStack, "UAS requesting 100rel although not offered")
 		hdrs.AddHeader(Warning, `399 SRGo "100rel was not offered, yet it was requested"`)
 	}
 
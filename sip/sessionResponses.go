@@ -17,7 +17,7 @@ func (session *SipSession) SendCreatedResponseDetailed(trans *Transaction, rspsp
 	if trans == nil {
 		trans = session.GetLastUnACKedInvSYNC(INBOUND)
 		if trans == nil {
-			LogError(LTSIPStack, fmt.Sprintf("SendCreatedResponseDetailed: No UnACKed INVITE transaction found to send response (%d) on Call-ID (%s)", rspspk.StatusCode, session.CallID))
+			session.logError(LTSIPStack, "SendCreatedResponseDetailed: No UnACKed INVITE transaction found to send response", "statusCode", rspspk.StatusCode)
 			return
 		}
 	}
@@ -25,7 +25,7 @@ func (session *SipSession) SendCreatedResponseDetailed(trans *Transaction, rspsp
 	stc := rspspk.StatusCode
 	trans.Lock.Lock()
 	if IsProvisional18x(stc) && rspspk.LinkedPRACKST == nil && (msgbody == nil || !msgbody.ContainsSDP()) {
-		if (session.RoutingData.DisallowSimilar18x && slices.Contains(trans.Responses, stc)) || (session.RoutingData.DisallowDifferent18x && slices.ContainsFunc(trans.Responses, func(x int) bool { return IsProvisional18x(x) && x != stc })) {
+		if (session.RoutingData().DisallowSimilar18x && slices.Contains(trans.Responses, stc)) || (session.RoutingData().DisallowDifferent18x && slices.ContainsFunc(trans.Responses, func(x int) bool { return IsProvisional18x(x) && x != stc })) {
 			trans.Lock.Unlock()
 			return
 		}
@@ -38,7 +38,7 @@ func (session *SipSession) SendCreatedResponseDetailed(trans *Transaction, rspsp
 	sipmsg.Headers = session.createHeadersForResponse(trans, rspspk)
 
 	sipmsg.Body = msgbody
-	sipmsg.ParseNPrepareSDP(session)
+	sipmsg.ParseNPrepareSDP(session, trans)
 
 	trans.SentMessage = sipmsg
 	session.SendSTMessage(trans)
@@ -0,0 +1,168 @@
+package sip
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	. "SRGo/global"
+	"SRGo/sip/status"
+)
+
+type (
+	// SessionDetails is the structured view of a session served by the API
+	SessionDetails struct {
+		CreatedAt     time.Time            `json:"createdAt"`
+		AnsweredAt    *time.Time           `json:"answeredAt,omitempty"`
+		Quality       *QualityStats        `json:"quality,omitempty"`
+		LinkedSession *SessionDetails      `json:"linkedSession,omitempty"`
+		CallID        string               `json:"callId"`
+		State         string               `json:"state"`
+		Direction     string               `json:"direction"`
+		Mode          string               `json:"mode"`
+		From          string               `json:"from,omitempty"`
+		To            string               `json:"to,omitempty"`
+		Route         string               `json:"route,omitempty"`
+		RemoteAddr    string               `json:"remoteAddr,omitempty"`
+		RemoteContact string               `json:"remoteContact,omitempty"`
+		Media         []MediaDetails       `json:"media,omitempty"`
+		Transactions  []TransactionDetails `json:"transactions,omitempty"`
+		Held          bool                 `json:"held"`
+	}
+
+	MediaDetails struct {
+		Kind       string `json:"kind"`
+		RemoteAddr string `json:"remoteAddr,omitempty"`
+		Index      int    `json:"index"`
+		LocalPort  int    `json:"localPort"`
+	}
+
+	TransactionDetails struct {
+		Time      time.Time `json:"time"`
+		Method    string    `json:"method"`
+		Direction string    `json:"direction"`
+		Responses []int     `json:"responses"`
+		CSeq      uint32    `json:"cseq"`
+		Finalized bool      `json:"finalized"`
+		ACKed     bool      `json:"acked"`
+	}
+
+	// SessionFilter selects the sessions listed, empty fields match all
+	SessionFilter struct {
+		CallID    string // substring
+		State     string
+		Direction string
+		Mode      string
+		Route     string
+		Number    string // substring of From or To userpart
+	}
+)
+
+// Details returns the session details, with its transactions and linked session when full
+func (session *SipSession) Details(full bool) SessionDetails {
+	d := SessionDetails{
+		CallID:    session.CallID,
+		State:     session.GetState().String(),
+		Direction: session.Direction.String(),
+		Mode:      string(session.Mymode),
+		From:      GetURIUsername(session.FromHeader),
+		To:        GetURIUsername(session.ToHeader),
+		Held:      session.isHeld.Load(),
+	}
+	if rd := session.RoutingData(); rd != nil {
+		d.Route = rd.RouteName()
+	}
+	if rmt := session.RemoteUDP(); rmt != nil {
+		d.RemoteAddr = rmt.String()
+	}
+	if session.RemoteContactUDP != nil {
+		d.RemoteContact = session.RemoteContactUDP.String()
+	}
+	if !session.HasNoTransactions() {
+		d.CreatedAt = session.GetFirstTransaction().TransTime
+	}
+	if answeredAt := session.inboundLeg().answeredAt.Load(); answeredAt > 0 {
+		t := time.Unix(0, answeredAt)
+		d.AnsweredAt = &t
+	}
+	if stats, ok := session.Quality(); ok {
+		d.Quality = &stats
+	}
+	for _, ms := range session.MediaStreams() {
+		md := MediaDetails{Index: ms.Index, Kind: cmp.Or(ms.Kind, "audio"), LocalPort: ms.Pair.Port}
+		if rmt := ms.RemoteUdpAddr(); rmt != nil {
+			md.RemoteAddr = rmt.String()
+		}
+		d.Media = append(d.Media, md)
+	}
+	if !full {
+		return d
+	}
+	session.TransLock.RLock()
+	for _, tx := range session.Transactions {
+		tx.Lock.Lock()
+		d.Transactions = append(d.Transactions, TransactionDetails{
+			Time:      tx.TransTime,
+			Method:    tx.Method.String(),
+			Direction: tx.Direction.String(),
+			CSeq:      tx.CSeq,
+			Responses: slices.Clone(tx.Responses),
+			Finalized: tx.IsFinalized,
+			ACKed:     tx.IsACKed,
+		})
+		tx.Lock.Unlock()
+	}
+	session.TransLock.RUnlock()
+	if lnkdss := session.LinkedSession; lnkdss != nil {
+		ld := lnkdss.Details(false)
+		d.LinkedSession = &ld
+	}
+	return d
+}
+
+func (f *SessionFilter) matches(d *SessionDetails) bool {
+	return (f.CallID == "" || strings.Contains(d.CallID, f.CallID)) &&
+		(f.State == "" || strings.EqualFold(d.State, f.State)) &&
+		(f.Direction == "" || strings.EqualFold(d.Direction, f.Direction)) &&
+		(f.Mode == "" || strings.EqualFold(d.Mode, f.Mode)) &&
+		(f.Route == "" || d.Route == f.Route) &&
+		(f.Number == "" || strings.Contains(d.From, f.Number) || strings.Contains(d.To, f.Number))
+}
+
+// ListSessions returns a page of the sessions matching the filter, oldest first, with the total number of matches
+func ListSessions(f SessionFilter, offset, limit int) ([]SessionDetails, int) {
+	var list []SessionDetails
+	for _, ss := range Sessions.Values() {
+		if d := ss.Details(false); f.matches(&d) {
+			list = append(list, d)
+		}
+	}
+	slices.SortFunc(list, func(a, b SessionDetails) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.CallID, b.CallID))
+	})
+	total := len(list)
+	offset = min(max(offset, 0), total)
+	return list[offset:min(offset+max(limit, 0), total)], total
+}
+
+// Terminate tears the call of the session down with a Q.850 cause: established calls are released with BYE,
+// calls being established are cancelled towards the callee and rejected towards the caller.
+// Returns false if the session is not a call in a releasable state
+func (ss *SipSession) Terminate(q850Cause int, details string) bool {
+	lnkdss := ss.LinkedSession
+	if ss.IsEstablished() || (lnkdss != nil && lnkdss.IsEstablished()) {
+		s1, s2 := ss.ReleaseCallCause(q850Cause, details)
+		return s1 || s2
+	}
+	inss := ss.inboundLeg()
+	if inss.Direction != INBOUND || !inss.IsBeingEstablished() {
+		return false
+	}
+	inss.SetTerminationCause(q850Cause, details)
+	if outss := inss.LinkedSession; outss != nil && outss.CancelMe(q850Cause, details) {
+		return true // the caller gets the 487 of the callee
+	}
+	trans := inss.GetLastUnACKedInvSYNC(INBOUND)
+	return trans != nil && inss.RejectMe(trans, status.TemporarilyUnavailable, q850Cause, details)
+}
@@ -0,0 +1,32 @@
+package sip
+
+import (
+	"cmp"
+	"strconv"
+
+	. "SRGo/global"
+)
+
+// countMessage counts a SIP message received (INBOUND) or sent (OUTBOUND)
+func countMessage(msg *SipMessage, method Method, dir Direction) {
+	if msg.IsRequest() {
+		Prometrics.SIPRequests.WithLabelValues(method.String(), dir.String()).Inc()
+		return
+	}
+	Prometrics.SIPResponses.WithLabelValues(method.String(), statusClass(msg.StartLine.StatusCode), dir.String()).Inc()
+}
+
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// routingServerRoute names all the routes of the routing server, their patterns being made per call
+const routingServerRoute = "routingserver"
+
+// RouteName is used to label the route metrics and stats, bounded to the Routing DB patterns
+func (rr *RoutingRecord) RouteName() string {
+	if rr.fromServer {
+		return routingServerRoute
+	}
+	return cmp.Or(rr.UserpartPattern, "default")
+}
@@ -0,0 +1,70 @@
+package sip_test
+
+import (
+	"SRGo/global"
+	"SRGo/prometheus"
+	"SRGo/sip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scrape returns the metrics as exposed on /metrics
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	global.Prometrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestRouteMetrics(t *testing.T) {
+	global.Prometrics = prometheus.NewMetrics("test")
+
+	call := func(rd *sip.RoutingRecord, code int) {
+		ss1 := sip.NewSS(global.INBOUND)
+		ss1.SetRoutingData(rd)
+		inv1 := ss1.AddTransactionOf(global.INVITE)
+		ss1.CountCallStart("198.51.100.1:5060")
+
+		ss2 := sip.NewSS(global.OUTBOUND)
+		inv2 := ss2.AddTransactionOf(global.INVITE)
+		ss2.ReceiveResponse(inv2, 180)
+		ss2.ReceiveResponse(inv2, 183) // not the first 18x
+		ss2.ReceiveResponse(inv2, code)
+
+		inv1.Responses = append(inv1.Responses, 180, code)
+		if code == 200 {
+			ss1.SetAnsweredAt(time.Now().Add(-time.Minute))
+		}
+		ss1.CountCallEnd()
+	}
+
+	db := &sip.RoutingRecord{UserpartPattern: "^metrics"}
+	call(db, 200)
+	call(db, 486)
+	for _, callee := range []string{"^1001$", "^1002$", "^1003$"} {
+		rd := &sip.RoutingRecord{UserpartPattern: callee}
+		rd.SetFromServer()
+		call(rd, 200)
+	}
+
+	metrics := scrape(t)
+	for _, line := range []string{
+		`test_RouteCallAttempts{route="^metrics"} 2`,
+		`test_RouteCallsAnswered{route="^metrics"} 1`,
+		`test_RouteAnswerSeizureRatio{route="^metrics"} 50`,
+		`test_RouteCallAttempts{route="routingserver"} 3`,
+		`test_RouteCallsAnswered{route="routingserver"} 3`,
+		`test_RouteAnswerSeizureRatio{route="routingserver"} 100`,
+		`test_PostDialDelaySeconds_count 5`,
+		`test_PostDialDelaySeconds_bucket{le="0.1"} 5`,
+	} {
+		require.Contains(t, metrics, line+"\n")
+	}
+	require.NotContains(t, metrics, "^1001$", "routing server patterns not used as labels")
+	require.Equal(t, 3, sip.RouteStats.Snapshot()["routingserver"].Answered)
+}
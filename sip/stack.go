@@ -1,10 +1,13 @@
 package sip
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"SRGo/events"
 	. "SRGo/global"
 	"SRGo/phone"
 	"SRGo/q850"
@@ -235,7 +238,7 @@ func processPDU(payload []byte) (*SipMessage, []byte, error) {
 		if bt == Unknown {
 			LogError(LTBadSIPMessage, "Unknown Content-Type value")
 		} else {
-			MB.PartsContents[bt] = ContentPart{Bytes: payload[_bodyStartIdx : _bodyStartIdx+cntntLength]}
+			MB.PartsContents[bt] = ContentPart{Bytes: bytes.Clone(payload[_bodyStartIdx : _bodyStartIdx+cntntLength])} // payload buffer is pooled
 		}
 		payload = payload[_bodyStartIdx+cntntLength:]
 	} else {
@@ -273,7 +276,7 @@ func processPDU(payload []byte) (*SipMessage, []byte, error) {
 			default:
 				MB.PartsContents[bt] = ContentPart{
 					Headers: partHeaders,
-					Bytes:   payload[idx+4 : idxEnd-2], // start_after \r\n\r\n (body_start) = +4 and end_before \r\n = -2 (boundary_edge)
+					Bytes:   bytes.Clone(payload[idx+4 : idxEnd-2]), // start_after \r\n\r\n (body_start) = +4 and end_before \r\n = -2 (boundary_edge)
 				}
 			}
 			payload = payload[idxEnd:]
@@ -314,6 +317,7 @@ func sessionGetter(sipmsg *SipMessage) (*SipSession, NewSessionType) {
 	switch sipmsg.GetMethod() {
 	case INVITE:
 		sipses.Mymode = mode.Multimedia
+		sipses.ladder = newLadder()
 		sipses.IsPRACKSupported = sipmsg.IsOptionSupported("100rel")
 		sipses.IsDelayedOfferCall = !sipmsg.ContainsSDP()
 		sipses.SetState(state.BeingEstablished)
@@ -357,7 +361,11 @@ func sessionGetter(sipmsg *SipMessage) (*SipSession, NewSessionType) {
 func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 	defer LogCallStack()
 
-	if ss == nil || newSesType == DuplicateMessage {
+	if ss == nil {
+		return
+	}
+	if newSesType == DuplicateMessage {
+		Prometrics.Retransmissions.WithLabelValues(INBOUND.String()).Inc()
 		return
 	}
 	ss.UpdateContactRecordRouteBody(sipmsg) // update -- split headers logic
@@ -370,13 +378,19 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 	}
 
 	if trans == nil {
-		LogWarning(LTSIPStack, fmt.Sprintf("Received message [%s] in Call-ID [%s] has been discarded due to transaction violation", sipmsg.String(), ss.CallID))
+		ss.logWarning(LTSIPStack, "Received message discarded due to transaction violation", "message", sipmsg.String())
 		if ss.HasNoTransactions() {
 			ss.DropMe()
 		}
 		return
 	}
 
+	switch newSesType {
+	case ValidRequest, Response:
+	default:
+		Prometrics.SessionRejections.WithLabelValues(newSesType.String()).Inc()
+	}
+
 	switch newSesType {
 	case Response:
 		return
@@ -438,7 +452,7 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 				if sipmsg.ContainsSDP() {
 					if sts, warn, callheld := sipmsg.ParseSDPPartAndBuildAnswer(); sts == 200 {
 						ss.SendCreatedResponse(trans, sts, sipmsg.Body)
-						ss.isHeld = callheld
+						ss.setHeld(callheld)
 					} else {
 						ss.SendCreatedResponseDetailed(trans, NewResponsePackWarning(sts, warn), ZeroBody())
 					}
@@ -467,8 +481,11 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 					ss.DropMe()
 					return
 				}
+				ss.answeredAt.Store(time.Now().UnixNano())
+				ss.publishEvent(events.Answer, nil)
 				ss.StartMaxCallDuration()
 				ss.StartInDialogueProbing()
+				ss.StartMediaTimeout()
 				if lnkdss := ss.LinkedSession; lnkdss != nil && !lnkdss.TransformEarlyToFinal { // call answered - need to propagate ACK
 					lnkdss.FinalizeState()
 					lnkdss.SendCreatedRequest(ACK, nil, sipmsg.Body)
@@ -533,7 +550,7 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 				if sipmsg.ContainsSDP() {
 					if sts, warn, callheld := sipmsg.ParseSDPPartAndBuildAnswer(); sts == 200 {
 						ss.SendCreatedResponse(trans, sts, sipmsg.Body)
-						ss.isHeld = callheld
+						ss.setHeld(callheld)
 					} else {
 						ss.SendCreatedResponseDetailed(trans, NewResponsePackWarning(sts, warn), ZeroBody())
 					}
@@ -566,6 +583,9 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 		case NOTIFY:
 			ss.SendCreatedResponse(trans, status.MethodNotAllowed, ZeroBody())
 		case INFO:
+			if ss.dtmfMethod() == DTMFINFO && ss.handleDTMFInfo(trans, sipmsg) {
+				return
+			}
 			if lnkdss := ss.LinkedSession; lnkdss != nil {
 				lnkdss.SendCreatedRequest(INFO, trans, sipmsg.Body)
 			}
@@ -575,6 +595,7 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 			if expires < 0 {
 				ss.SetState(state.Dropped)
 				ss.SendCreatedResponseDetailed(trans, NewResponsePackRFWarning(400, "", "Bad Contact header"), ZeroBody())
+				rejected(ss.RemoteUDP())
 				return
 			}
 			ss.SetState(phone.Phones.AddOrUpdate(ext, ruri, ipport, expires))
@@ -589,6 +610,10 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 		if stsCode <= 199 && trans.Method != INVITE {
 			return
 		}
+		if trans.Method == REGISTER && ss.trunk != nil { // trunk registration
+			ss.handleRegisterResponse(trans, sipmsg)
+			return
+		}
 		if lnkdss := ss.LinkedSession; lnkdss != nil {
 			switch {
 			case 180 <= stsCode && stsCode <= 189:
@@ -662,7 +687,7 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 					ss.Ack3xxTo6xx(state.Redirected)
 					lnkdss.RerouteRequest(NewResponsePackSRW(stsCode, "Call redirected but forbidden", ""))
 				default:
-					LogWarning(LTSIPStack, "Received 3xx response on non-INVITE message")
+					ss.logWarning(LTSIPStack, "Received 3xx response on non-INVITE message", "method", trans.Method.String())
 					if trans.Method == CANCEL || trans.Method == BYE {
 						ss.DropMe()
 						return
@@ -675,6 +700,9 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 				case INVITE:
 					switch ss.GetState() {
 					case state.BeingEstablished:
+						if (stsCode == status.Unauthorized || stsCode == status.ProxyAuthenticationRequired) && ss.answerChallenge(trans, sipmsg) {
+							return
+						}
 						ss.StopNoTimers()
 						ss.Ack3xxTo6xx(state.Rejected)
 						if ss.TransformEarlyToFinal {
@@ -712,6 +740,7 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 					if ss.Mymode == mode.KeepAlive {
 						ss.FinalizeState()
 						ss.RemoteUserAgent.SetAlive(true)
+						phone.Phones.SetResponsive(ss.RemoteUserAgent, true)
 						ss.DropMe()
 					}
 				case BYE:
@@ -727,6 +756,7 @@ func sipStack(sipmsg *SipMessage, ss *SipSession, newSesType NewSessionType) {
 					if ss.Mymode == mode.KeepAlive {
 						ss.FinalizeState()
 						ss.RemoteUserAgent.SetAlive(true)
+						phone.Phones.SetResponsive(ss.RemoteUserAgent, true)
 						ss.DropMe()
 					}
 				}
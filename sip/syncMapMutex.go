@@ -49,6 +49,12 @@ func (c *ConcurrentMapMutex[T]) Summaries() []string {
 	return global.Map(slices.Collect(maps.Values(c._map)), func(x T) string { return x.String() })
 }
 
+func (c *ConcurrentMapMutex[T]) Values() []T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Collect(maps.Values(c._map))
+}
+
 func (c *ConcurrentMapMutex[T]) Count() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
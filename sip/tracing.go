@@ -0,0 +1,28 @@
+package sip
+
+import (
+	"net"
+	"time"
+
+	. "SRGo/global"
+	"SRGo/hep"
+)
+
+// traceIngress exports a SIP message received, raw being its bytes as received
+func traceIngress(msg *SipMessage, raw []byte, src *net.UDPAddr, conn *net.UDPConn) {
+	if HEPTracer == nil {
+		return
+	}
+	pkt := &hep.Packet{Timestamp: time.Now(), Src: src, Dst: GetUDPAddrFromConn(conn), CorrelationID: msg.CallID, Payload: raw}
+	HEPTracer.Trace(pkt, msg.StartLine.UserPart, GetURIUsername(msg.FromHeader), GetURIUsername(msg.ToHeader))
+}
+
+// traceEgress records a SIP message sent by the session in the call ladder and exports it
+func (session *SipSession) traceEgress(msg *SipMessage, dst *net.UDPAddr) {
+	session.addLadderEntry(OUTBOUND, msg.Bytes, GetUDPAddrFromConn(session.UDPListenser()), dst)
+	if HEPTracer == nil {
+		return
+	}
+	pkt := &hep.Packet{Timestamp: time.Now(), Src: GetUDPAddrFromConn(session.UDPListenser()), Dst: dst, CorrelationID: session.CallID, Payload: msg.Bytes}
+	HEPTracer.Trace(pkt, msg.StartLine.UserPart, GetURIUsername(session.FromHeader), GetURIUsername(session.ToHeader))
+}
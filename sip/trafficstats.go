@@ -0,0 +1,163 @@
+package sip
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"SRGo/events"
+	. "SRGo/global"
+)
+
+type (
+	// TrafficStats are the call counters of a route or a peer (remote socket)
+	TrafficStats struct {
+		Failed     map[int]int `json:"failed"` // by final status code sent to the caller
+		Attempts   int         `json:"attempts"`
+		Answered   int         `json:"answered"`
+		Concurrent int         `json:"concurrent"`
+		ASR        float64     `json:"asr"`        // percentage of completed attempts answered
+		ACD        float64     `json:"acdSeconds"` // average duration of answered calls
+		completed  int
+		duration   time.Duration
+	}
+
+	TrafficCounters struct {
+		stats map[string]*TrafficStats
+		mu    sync.Mutex
+	}
+)
+
+var (
+	RouteStats = NewTrafficCounters()
+	PeerStats  = NewTrafficCounters()
+)
+
+func NewTrafficCounters() *TrafficCounters {
+	return &TrafficCounters{stats: make(map[string]*TrafficStats)}
+}
+
+// Unsafe
+func (tc *TrafficCounters) get(key string) *TrafficStats {
+	ts, ok := tc.stats[key]
+	if !ok {
+		ts = &TrafficStats{Failed: make(map[int]int)}
+		tc.stats[key] = ts
+	}
+	return ts
+}
+
+func (tc *TrafficCounters) callStarted(key string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	ts := tc.get(key)
+	ts.Attempts++
+	ts.Concurrent++
+}
+
+// callEnded counts a call ended with the final status code sent to the caller, returning the updated ASR
+func (tc *TrafficCounters) callEnded(key string, code int, duration time.Duration) float64 {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	ts := tc.get(key)
+	ts.Concurrent = max(ts.Concurrent-1, 0)
+	ts.completed++
+	if IsPositive(code) {
+		ts.Answered++
+		ts.duration += duration
+		ts.ACD = ts.duration.Seconds() / float64(ts.Answered)
+	} else {
+		ts.Failed[code]++
+	}
+	ts.ASR = float64(ts.Answered) * 100 / float64(ts.completed)
+	return ts.ASR
+}
+
+// Snapshot returns a copy of the counters by key
+func (tc *TrafficCounters) Snapshot() map[string]TrafficStats {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	snap := make(map[string]TrafficStats, len(tc.stats))
+	for key, ts := range tc.stats {
+		cp := *ts
+		cp.Failed = maps.Clone(ts.Failed)
+		snap[key] = cp
+	}
+	return snap
+}
+
+// Reset clears the counters, keeping the calls in progress
+func (tc *TrafficCounters) Reset() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for key, ts := range tc.stats {
+		if ts.Concurrent == 0 {
+			delete(tc.stats, key)
+			continue
+		}
+		*ts = TrafficStats{Failed: make(map[int]int), Concurrent: ts.Concurrent}
+	}
+}
+
+// countCallStart counts the routed call of this inbound session against its route and the peer it is sent to, if any.
+// On failover, the route is counted once while each peer tried is counted an attempt
+func (ss *SipSession) countCallStart(peer string) {
+	firstAttempt := ss.trafficRoute == ""
+	if firstAttempt {
+		ss.trafficRoute = ss.RoutingData().RouteName()
+		RouteStats.callStarted(ss.trafficRoute)
+	}
+	ss.trafficPeer = peer
+	if peer != "" {
+		PeerStats.callStarted(peer)
+	}
+	if firstAttempt {
+		ss.publishEvent(events.Invite, nil)
+	}
+}
+
+// countPeerFailed ends the attempt of the peer failed over from, with its final status code
+func (ss *SipSession) countPeerFailed(code int) {
+	if ss.trafficPeer == "" {
+		return
+	}
+	PeerStats.callEnded(ss.trafficPeer, code, 0)
+	ss.trafficPeer = ""
+}
+
+// countCallEnd is called once when the inbound session is dropped
+func (ss *SipSession) countCallEnd() {
+	if ss.trafficRoute == "" {
+		return
+	}
+	code := ss.FinalStatusCode()
+	var duration time.Duration
+	if answeredAt := ss.answeredAt.Load(); answeredAt > 0 {
+		duration = time.Since(time.Unix(0, answeredAt))
+	}
+	asr := RouteStats.callEnded(ss.trafficRoute, code, duration)
+	if ss.trafficPeer != "" {
+		PeerStats.callEnded(ss.trafficPeer, code, duration)
+	}
+	Prometrics.RouteCallAttempts.WithLabelValues(ss.trafficRoute).Inc()
+	if IsPositive(code) {
+		Prometrics.RouteCallsAnswered.WithLabelValues(ss.trafficRoute).Inc()
+	}
+	Prometrics.RouteASR.WithLabelValues(ss.trafficRoute).Set(asr)
+}
+
+// FinalStatusCode returns the final response of the dialogue creating transaction, 0 if none
+func (ss *SipSession) FinalStatusCode() int {
+	trans := ss.GetFirstTransaction()
+	if trans == nil {
+		return 0
+	}
+	trans.Lock.Lock()
+	defer trans.Lock.Unlock()
+	for _, sc := range trans.Responses {
+		if sc >= 200 {
+			return sc
+		}
+	}
+	return 0
+}
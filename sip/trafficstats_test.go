@@ -0,0 +1,101 @@
+package sip_test
+
+import (
+	"SRGo/global"
+	"SRGo/sip"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireStats compares the counters as exposed by the API
+func requireStats(t *testing.T, want, got sip.TrafficStats) {
+	t.Helper()
+	wantJSON, err := json.Marshal(want)
+	require.NoError(t, err)
+	gotJSON, err := json.Marshal(got)
+	require.NoError(t, err)
+	require.JSONEq(t, string(wantJSON), string(gotJSON))
+}
+
+func TestTrafficCounters(t *testing.T) {
+	t.Parallel()
+
+	type call struct {
+		code     int // 0 while in progress
+		duration time.Duration
+	}
+	tests := []struct {
+		name  string
+		calls []call
+		want  sip.TrafficStats
+		asr   float64
+		kept  bool // by Reset
+	}{
+		{
+			name:  "answered and failed",
+			calls: []call{{200, 30 * time.Second}, {200, 90 * time.Second}, {486, 0}, {404, 0}},
+			want:  sip.TrafficStats{Failed: map[int]int{486: 1, 404: 1}, Attempts: 4, Answered: 2, ASR: 50, ACD: 60},
+			asr:   50,
+		},
+		{
+			name:  "all failed",
+			calls: []call{{503, 0}, {503, 0}, {408, 0}},
+			want:  sip.TrafficStats{Failed: map[int]int{503: 2, 408: 1}, Attempts: 3},
+		},
+		{
+			name:  "in progress",
+			calls: []call{{200, 10 * time.Second}, {0, 0}, {0, 0}, {487, 0}},
+			want:  sip.TrafficStats{Failed: map[int]int{487: 1}, Attempts: 4, Answered: 1, Concurrent: 2, ASR: 50, ACD: 10},
+			asr:   50,
+			kept:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tc := sip.NewTrafficCounters()
+			var asr float64
+			for _, c := range tt.calls {
+				sip.CallStarted(tc, "route")
+				if c.code != 0 {
+					asr = sip.CallEnded(tc, "route", c.code, c.duration)
+				}
+			}
+			require.InDelta(t, tt.asr, asr, 0.001)
+
+			snap := tc.Snapshot()
+			requireStats(t, tt.want, snap["route"])
+			snap["route"].Failed[999] = 1 // a copy
+			require.NotContains(t, tc.Snapshot()["route"].Failed, 999)
+
+			tc.Reset()
+			snap = tc.Snapshot()
+			if !tt.kept {
+				require.Empty(t, snap)
+				return
+			}
+			requireStats(t, sip.TrafficStats{Failed: map[int]int{}, Concurrent: tt.want.Concurrent}, snap["route"])
+			sip.CallEnded(tc, "route", 200, 0)
+			require.Equal(t, tt.want.Concurrent-1, tc.Snapshot()["route"].Concurrent)
+		})
+	}
+}
+
+func TestTrafficCountersFailover(t *testing.T) {
+	t.Parallel()
+
+	ss := sip.NewSS(global.INBOUND)
+	ss.SetRoutingData(&sip.RoutingRecord{UserpartPattern: "^failover"})
+	ss.CountCallStart("192.0.2.1:5060")
+	ss.CountPeerFailed(503)
+	ss.CountPeerFailed(503) // no peer attempt in progress
+	ss.CountCallStart("192.0.2.2:5060")
+
+	requireStats(t, sip.TrafficStats{Failed: map[int]int{}, Attempts: 1, Concurrent: 1}, sip.RouteStats.Snapshot()["^failover"])
+	peers := sip.PeerStats.Snapshot()
+	requireStats(t, sip.TrafficStats{Failed: map[int]int{503: 1}, Attempts: 1}, peers["192.0.2.1:5060"])
+	requireStats(t, sip.TrafficStats{Failed: map[int]int{}, Attempts: 1, Concurrent: 1}, peers["192.0.2.2:5060"])
+}
@@ -189,12 +189,14 @@ func (transaction *Transaction) transTimerHandler(sipSes *SipSession) {
 	defer transaction.Lock.Unlock()
 
 	if transaction.ReTXCount >= ReTXCount {
+		Prometrics.TransactionTimeouts.WithLabelValues(transaction.Method.String()).Inc()
 		transaction.Timer = nil
 		CheckPendingTransaction(sipSes, transaction)
 		return
 	}
 
 	sipSes.Send(transaction)
+	Prometrics.Retransmissions.WithLabelValues(OUTBOUND.String()).Inc()
 	transaction.ReTXCount++
 	transaction.TransTimeOut *= 2 // doubling retransmission interval
 	transaction.Timer.Reset(transaction.TransTimeOut)
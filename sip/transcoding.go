@@ -0,0 +1,156 @@
+package sip
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"SRGo/codec"
+	. "SRGo/global"
+
+	"github.com/Moatassem/sdp"
+)
+
+// transcodePath converts the RTP received on a leg before it is relayed to the linked leg
+type transcodePath struct {
+	convert  codec.Transcoder
+	inClock  int
+	outClock int
+	inPT     uint8
+	outPT    uint8
+}
+
+// negotiateTranscoding makes sure each side sees a codec it supports.
+// Offers are extended with the codecs the offered ones can be transcoded to;
+// answers whose codec was not offered on this leg are rewritten to an offered one, with transcoding set on both legs
+func (ss *SipSession) negotiateTranscoding(sdpSession *sdp.Session, isOffer bool) {
+	rd := ss.RoutingData()
+	lnkdss := ss.LinkedSession
+	if rd == nil || !rd.SteerMedia || !rd.Transcoding || lnkdss == nil {
+		return
+	}
+	media := firstAudioMedia(sdpSession)
+	if media == nil {
+		return
+	}
+	formats := make([]sdp.Format, len(media.Format))
+	for i, f := range media.Format {
+		formats[i] = *f
+	}
+	lnkdss.remoteAudio.Store(&formats) // SDP was sent by the linked session remote
+
+	if isOffer {
+		addTranscodableCodecs(media)
+		return
+	}
+
+	offered := ss.remoteAudio.Load()
+	chosen := firstMediaFormat(media.Format)
+	if offered == nil || chosen == nil {
+		return
+	}
+	if findFormat(*offered, codecName(chosen)) != nil {
+		ss.transcoder.Store(nil)
+		lnkdss.transcoder.Store(nil)
+		return
+	}
+	for i := range *offered {
+		target := &(*offered)[i]
+		fwd, ok1 := codec.Lookup(codecName(chosen), codecName(target))
+		bwd, ok2 := codec.Lookup(codecName(target), codecName(chosen))
+		if !ok1 || !ok2 {
+			continue
+		}
+		inClock, outClock := codecClock(chosen), codecClock(target)
+		lnkdss.transcoder.Store(&transcodePath{convert: fwd, inPT: chosen.Payload, outPT: target.Payload, inClock: inClock, outClock: outClock})
+		ss.transcoder.Store(&transcodePath{convert: bwd, inPT: target.Payload, outPT: chosen.Payload, inClock: outClock, outClock: inClock})
+
+		// answer with the offered codec first, then the other answered ones this leg remote offered
+		first := *target
+		answer := []*sdp.Format{&first}
+		for _, f := range media.Format {
+			if f != chosen && !strings.EqualFold(codecName(f), codecName(target)) && findFormat(*offered, codecName(f)) != nil {
+				answer = append(answer, f)
+			}
+		}
+		media.Format = answer
+		ss.logInfo(LTMediaStack, "Transcoding", "offered", codecName(target), "answered", codecName(chosen))
+		return
+	}
+}
+
+// addTranscodableCodecs appends to the offer the static payload codecs the offered ones can be transcoded to
+func addTranscodableCodecs(media *sdp.Media) {
+	used := make(map[uint8]bool, len(media.Format))
+	for _, f := range media.Format {
+		used[f.Payload] = true
+	}
+	for _, f := range media.Format {
+		for _, c := range codec.TranscodableTo(codecName(f)) {
+			if c.Dynamic || used[c.Payload] || hasCodec(media.Format, c.Name) {
+				continue
+			}
+			used[c.Payload] = true
+			media.Format = append(media.Format, &sdp.Format{Payload: c.Payload, Name: c.Name, ClockRate: c.ClockRate})
+		}
+	}
+}
+
+// firstMediaFormat returns the preferred codec, skipping telephone-event and comfort noise
+func firstMediaFormat(formats []*sdp.Format) *sdp.Format {
+	for _, f := range formats {
+		name := codecName(f)
+		if !strings.EqualFold(name, telephoneEvent) && !strings.EqualFold(name, "CN") {
+			return f
+		}
+	}
+	return nil
+}
+
+func findFormat(formats []sdp.Format, name string) *sdp.Format {
+	for i := range formats {
+		if strings.EqualFold(codecName(&formats[i]), name) {
+			return &formats[i]
+		}
+	}
+	return nil
+}
+
+func hasCodec(formats []*sdp.Format, name string) bool {
+	for _, f := range formats {
+		if strings.EqualFold(codecName(f), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func codecClock(f *sdp.Format) int {
+	if f.ClockRate > 0 {
+		return f.ClockRate
+	}
+	if c, ok := codec.Get(codecName(f)); ok {
+		return c.ClockRate
+	}
+	return codec.G711ClockRate
+}
+
+// transcodeRTP returns the packet converted into out when a transcoding path applies, the packet itself otherwise
+func (ss *SipSession) transcodeRTP(pkt, out []byte) []byte {
+	tp := ss.transcoder.Load()
+	if tp == nil || len(pkt) < 12 || pkt[1]&0x7F != tp.inPT {
+		return pkt
+	}
+	hdrLen, _ := rtpHeaderLen(pkt)
+	payload, ok := rtpPayload(pkt)
+	if !ok {
+		return pkt
+	}
+	out = append(out[:0], pkt[:hdrLen]...)
+	out[0] &^= 0x20 // padding dropped
+	out[1] = pkt[1]&0x80 | tp.outPT
+	if tp.inClock != tp.outClock {
+		ts := binary.BigEndian.Uint32(pkt[4:8])
+		binary.BigEndian.PutUint32(out[4:8], uint32(uint64(ts)*uint64(tp.outClock)/uint64(tp.inClock)))
+	}
+	return tp.convert(out, payload)
+}
@@ -0,0 +1,397 @@
+package sip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "SRGo/global"
+	"SRGo/guid"
+	"SRGo/sip/mode"
+	"SRGo/sip/state"
+	"SRGo/sip/status"
+)
+
+type (
+	// Trunk is an upstream carrier SR registers to; routes referencing it with "trunk" send their calls from its AoR
+	Trunk struct {
+		Name         string `json:"name"`
+		Registrar    string `json:"registrar"`              // host[:port], resolved per RFC 3263 at each registration
+		Domain       string `json:"domain,omitempty"`       // AoR domain, registrar host if empty
+		Username     string `json:"username"`               // AoR userpart
+		AuthUsername string `json:"authUsername,omitempty"` // digest username, username if empty
+		Password     string `json:"password"`
+		Expires      int    `json:"expires,omitempty"` // requested registration interval in seconds, 3600 if not set
+
+		registrar *UdpSocket
+		conn      *net.UDPConn
+		timer     *time.Timer
+		callID    string
+		status    TrunkStatus
+		interval  int  // requested interval, raised by 423 Interval Too Brief
+		inflight  bool // a REGISTER transaction is pending
+		mu        sync.Mutex
+	}
+
+	// TrunkStatus is the registration state of a trunk as exposed by the API
+	TrunkStatus struct {
+		RegisteredAt time.Time `json:"registeredAt,omitzero"`
+		ExpiresAt    time.Time `json:"expiresAt,omitzero"`
+		NextAttempt  time.Time `json:"nextAttempt,omitzero"`
+		Name         string    `json:"name"`
+		AoR          string    `json:"aor"`
+		Registrar    string    `json:"registrar"`
+		State        string    `json:"state"` // registering, registered or failed
+		LastError    string    `json:"lastError,omitempty"`
+		StatusCode   int       `json:"statusCode,omitempty"` // of the last final response, 408 on timeout
+		Failures     int       `json:"failures"`             // consecutive failed attempts
+	}
+)
+
+const (
+	TrunkRegistering = "registering"
+	TrunkRegistered  = "registered"
+	TrunkFailed      = "failed"
+
+	trunkDefaultExpires = 3600
+	trunkMinExpires     = 60
+	trunkRefreshMargin  = 60 * time.Second
+	trunkMinBackoff     = 30 * time.Second
+	trunkMaxBackoff     = 30 * time.Minute
+)
+
+var (
+	trunks     map[string]*Trunk // set once by StartTrunks
+	trunkNames []string
+)
+
+// LoadTrunks reads the trunks JSON array from path
+func LoadTrunks(path string) ([]*Trunk, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Trunk
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(list))
+	for i, t := range list {
+		if err := t.prepare(); err != nil {
+			return nil, fmt.Errorf("trunk #%d: %w", i+1, err)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("trunk #%d: duplicate name %q", i+1, t.Name)
+		}
+		names[t.Name] = true
+	}
+	return list, nil
+}
+
+func (t *Trunk) prepare() error {
+	if t.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if t.Username == "" {
+		return fmt.Errorf("missing username")
+	}
+	skt, err := BuildUdpSocket(t.Registrar, SipPort)
+	if err != nil {
+		return fmt.Errorf("bad registrar: %w", err)
+	}
+	t.registrar = skt
+	if t.Domain == "" {
+		t.Domain, _, _ = strings.Cut(t.Registrar, ":")
+	}
+	if t.AuthUsername == "" {
+		t.AuthUsername = t.Username
+	}
+	switch {
+	case t.Expires == 0:
+		t.Expires = trunkDefaultExpires
+	case t.Expires < trunkMinExpires:
+		return fmt.Errorf("expires below %d seconds", trunkMinExpires)
+	}
+	t.interval = t.Expires
+	return nil
+}
+
+// StartTrunks registers all trunks through conn and keeps them registered
+func StartTrunks(conn *net.UDPConn, list []*Trunk) {
+	trunks = make(map[string]*Trunk, len(list))
+	for i, t := range list {
+		trunks[t.Name] = t
+		trunkNames = append(trunkNames, t.Name)
+		t.conn = conn
+		t.callID = guid.NewCallID()
+		t.status = TrunkStatus{Name: t.Name, AoR: t.AoR(), Registrar: t.Registrar, State: TrunkRegistering}
+		Prometrics.TrunkRegistered.WithLabelValues(t.Name).Set(0)
+		t.schedule(time.Duration(i) * 100 * time.Millisecond) // spread the initial REGISTERs
+	}
+	LogInfo(LTConfiguration, "Trunks registration started", "trunks", len(list))
+}
+
+// GetTrunk returns the trunk with the given name or nil
+func GetTrunk(name string) *Trunk {
+	return trunks[name]
+}
+
+// TrunksStatus returns the registration status of all trunks, in configuration order
+func TrunksStatus() []TrunkStatus {
+	lst := make([]TrunkStatus, 0, len(trunkNames))
+	for _, name := range trunkNames {
+		lst = append(lst, trunks[name].Status())
+	}
+	return lst
+}
+
+func (t *Trunk) Status() TrunkStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+func (t *Trunk) IsRegistered() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status.State == TrunkRegistered && time.Now().Before(t.status.ExpiresAt)
+}
+
+func (t *Trunk) AoR() string {
+	return fmt.Sprintf("sip:%s@%s", t.Username, t.Domain)
+}
+
+func (t *Trunk) requestedInterval() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+func (t *Trunk) schedule(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.NextAttempt = time.Now().Add(d)
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.timer = time.AfterFunc(d, t.register)
+}
+
+// Register refreshes the trunk registration now
+func (t *Trunk) Register() {
+	t.schedule(0)
+}
+
+// register sends a new REGISTER, its outcome being handled in handleRegisterResponse or on timeout
+func (t *Trunk) register() {
+	t.mu.Lock()
+	if t.inflight {
+		t.mu.Unlock()
+		return
+	}
+	t.inflight = true
+	t.status.NextAttempt = time.Time{}
+	t.mu.Unlock()
+
+	target := t.registrar.UDPAddr()
+	if target == nil {
+		t.failed(0, "registrar not resolvable")
+		return
+	}
+
+	ss := NewSS(OUTBOUND)
+	ss.SetRemoteUDP(target)
+	ss.SetUDPListenser(t.conn)
+	ss.Mymode = mode.Registration
+	ss.trunk = t
+	ss.CallID = t.callID
+	ss.FromTag = guid.NewTag()
+	ss.FwdCSeq = RandomNum(1, 500)
+	ss.SetState(state.BeingEstablished)
+	ss.AddMe()
+	ss.sendREGISTER("", "")
+}
+
+// sendREGISTER sends the trunk REGISTER with the given authorization header, if any
+func (ss *SipSession) sendREGISTER(authHeader, authValue string) {
+	t := ss.trunk
+	st := ss.addOutgoingRequest(REGISTER, nil)
+
+	sipmsg := NewRequestMessage(REGISTER, "")
+	sl := sipmsg.StartLine
+	sl.HostPart = t.Domain
+	sl.BuildRURI(false)
+	ss.RemoteURI = sl.RUri
+	ss.RemoteContactURI = sl.RUri
+
+	expires := t.requestedInterval()
+
+	hdrs := NewSHsPointer(true)
+	hdrs.AddHeader(Via, fmt.Sprintf("%s;branch=%s", GenerateViaWithoutBranch(ss.UDPListenser()), st.ViaBranch))
+	ss.FromHeader = fmt.Sprintf("<%s>;tag=%s", t.AoR(), ss.FromTag)
+	ss.ToHeader = fmt.Sprintf("<%s>", t.AoR())
+	st.From, st.To = ss.FromHeader, ss.ToHeader
+	hdrs.AddHeader(From, ss.FromHeader)
+	hdrs.AddHeader(To, ss.ToHeader)
+	hdrs.AddHeader(Call_ID, ss.CallID)
+	hdrs.AddHeader(CSeq, fmt.Sprintf("%s %s", Uint32ToStr(st.CSeq), REGISTER.String()))
+	hdrs.AddHeader(Contact, fmt.Sprintf("<%s>", t.contactURI(ss.UDPListenser())))
+	hdrs.AddHeader(Expires, Int2Str(expires))
+	hdrs.AddHeader(Max_Forwards, "70")
+	if authHeader != "" {
+		hdrs.Set(authHeader, authValue)
+	}
+	sipmsg.Headers = hdrs
+	sipmsg.MaxFwds = 70
+	sipmsg.Body = ZeroBody()
+
+	st.RequestMessage = sipmsg
+	st.SentMessage = sipmsg
+	ss.SendSTMessage(st)
+}
+
+// handleRegisterResponse processes the final responses of a trunk REGISTER, answering digest challenges once
+func (ss *SipSession) handleRegisterResponse(trans *Transaction, sipmsg *SipMessage) {
+	t := ss.trunk
+	stsCode := sipmsg.StartLine.StatusCode
+	switch {
+	case stsCode <= 199:
+		return
+	case stsCode <= 299:
+		expires := t.requestedInterval()
+		if exp, ok := bindingExpires(sipmsg, t.contactURI(ss.UDPListenser())); ok {
+			expires = exp
+		} else if hv := sipmsg.Headers.ValueHeader(Expires); hv != "" {
+			expires = Str2Int[int](hv)
+		}
+		ss.SetState(state.Registered)
+		ss.DropMe()
+		t.registered(expires)
+		return
+	case stsCode == status.Unauthorized || stsCode == status.ProxyAuthenticationRequired:
+		authHeader, authValue, err := authorizeChallenge(trans, sipmsg, t.AuthUsername, t.Password)
+		if err == nil {
+			Prometrics.TrunkRegistrations.WithLabelValues(t.Name, "challenged").Inc()
+			ss.sendREGISTER(authHeader, authValue)
+			return
+		}
+		ss.SetState(state.Rejected)
+		ss.DropMe()
+		t.failed(stsCode, err.Error())
+		return
+	case stsCode == status.IntervalTooBrief:
+		if minexp := Str2Int[int](sipmsg.Headers.ValueHeader(Min_Expires)); minexp > t.requestedInterval() {
+			t.mu.Lock()
+			t.interval = minexp
+			t.mu.Unlock()
+			ss.sendREGISTER(trans.authorization())
+			return
+		}
+	}
+	ss.SetState(state.Rejected)
+	ss.DropMe()
+	t.failed(stsCode, sipmsg.StartLine.ReasonPhrase)
+}
+
+// contactURI is the Contact URI the trunk registers
+func (t *Trunk) contactURI(conn *net.UDPConn) string {
+	return fmt.Sprintf("sip:%s@%s;transport=udp", t.Username, GetUDPAddrFromConn(conn))
+}
+
+// bindingExpires returns the expires parameter of the Contact registered, among all the bindings of the AoR listed
+// in the 2xx (RFC 3261 section 10.2.4). A single Contact is taken as the registered one, as rewritten by NAT aware registrars
+func bindingExpires(sipmsg *SipMessage, contactURI string) (int, bool) {
+	_, values := sipmsg.Headers.ValuesHeader(Contact)
+	var contacts []string
+	for _, v := range values {
+		contacts = append(contacts, splitDigestParams(v)...)
+	}
+	for _, contact := range contacts {
+		uri, params := contact, contact
+		if _, rest, ok := strings.Cut(contact, "<"); ok {
+			uri, params, _ = strings.Cut(rest, ">")
+		}
+		if len(contacts) > 1 && !strings.EqualFold(contactAddress(uri), contactAddress(contactURI)) {
+			continue
+		}
+		if mtch := RMatch(params, ExpiresParameter); len(mtch) > 0 {
+			return Str2Int[int](mtch[1]), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// contactAddress returns the user@hostport of a SIP URI, without scheme and parameters
+func contactAddress(uri string) string {
+	uri = strings.TrimSpace(uri)
+	if i := strings.Index(uri, ":"); i >= 0 && strings.HasPrefix(strings.ToLower(uri), "sip") {
+		uri = uri[i+1:]
+	}
+	addr, _, _ := strings.Cut(uri, ";")
+	return addr
+}
+
+// authorization returns the authorization header sent in the transaction request, if any
+func (trans *Transaction) authorization() (string, string) {
+	for _, h := range []HeaderEnum{Authorization, Proxy_Authorization} {
+		if v := trans.RequestMessage.Headers.ValueHeader(h); v != "" {
+			return h.String(), v
+		}
+	}
+	return "", ""
+}
+
+func (t *Trunk) registered(expires int) {
+	if expires <= 0 { // registrar removed the binding
+		t.failed(status.OK, "no binding granted")
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	t.inflight = false
+	wasRegistered := t.status.State == TrunkRegistered
+	t.status.State = TrunkRegistered
+	t.status.StatusCode = status.OK
+	t.status.LastError = ""
+	t.status.Failures = 0
+	t.status.RegisteredAt = now
+	t.status.ExpiresAt = now.Add(time.Duration(expires) * time.Second)
+	t.mu.Unlock()
+
+	Prometrics.TrunkRegistered.WithLabelValues(t.Name).Set(1)
+	Prometrics.TrunkRegistrations.WithLabelValues(t.Name, "registered").Inc()
+	if !wasRegistered {
+		LogInfo(LTLogInOut, "Trunk registered", "trunk", t.Name, "aor", t.AoR(), "expires", expires)
+	}
+	refresh := max(time.Duration(expires)*time.Second/2, time.Duration(expires)*time.Second-trunkRefreshMargin)
+	t.schedule(refresh)
+}
+
+func (t *Trunk) failed(code int, reason string) {
+	t.mu.Lock()
+	t.inflight = false
+	t.status.Failures++
+	t.status.StatusCode = code
+	t.status.LastError = reason
+	stillValid := t.status.State == TrunkRegistered && time.Now().Before(t.status.ExpiresAt)
+	if !stillValid {
+		t.status.State = TrunkFailed
+	}
+	backoff := min(trunkMinBackoff<<min(t.status.Failures-1, 10), trunkMaxBackoff)
+	if stillValid { // retry sooner while the current binding lasts
+		backoff = min(backoff, max(time.Until(t.status.ExpiresAt)/2, time.Second))
+	}
+	t.mu.Unlock()
+
+	if !stillValid {
+		Prometrics.TrunkRegistered.WithLabelValues(t.Name).Set(0)
+	}
+	Prometrics.TrunkRegistrations.WithLabelValues(t.Name, "failed").Inc()
+	LogWarning(LTLogInOut, "Trunk registration failed", "trunk", t.Name, "statusCode", code, "reason", reason, "retryIn", backoff.String())
+	t.schedule(backoff)
+}
@@ -0,0 +1,35 @@
+package sip_test
+
+import (
+	"SRGo/sip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTrunks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "trunks.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	trunks, err := sip.LoadTrunks(write(`[{"name":"carrier","registrar":"sip.carrier.test:5070","username":"4420","password":"pw"}]`))
+	require.NoError(t, err)
+	require.Len(t, trunks, 1)
+	require.Equal(t, "sip:4420@sip.carrier.test", trunks[0].AoR())
+	require.Equal(t, "4420", trunks[0].AuthUsername)
+	require.Equal(t, 3600, trunks[0].Expires)
+
+	_, err = sip.LoadTrunks(write(`[{"name":"a","registrar":"10.0.0.1","username":"1"},{"name":"a","registrar":"10.0.0.2","username":"2"}]`))
+	require.ErrorContains(t, err, "duplicate")
+	_, err = sip.LoadTrunks(write(`[{"name":"a","registrar":"10.0.0.1"}]`))
+	require.ErrorContains(t, err, "username")
+	_, err = sip.LoadTrunks(write(`[{"name":"a","registrar":"10.0.0.1","username":"1","expires":10}]`))
+	require.ErrorContains(t, err, "expires")
+}
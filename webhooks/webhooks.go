@@ -0,0 +1,210 @@
+// Package webhooks delivers events as signed JSON HTTP POSTs to the configured hooks, with retries
+package webhooks
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"SRGo/events"
+	"SRGo/global"
+)
+
+const (
+	SignatureHeader = "X-SRGo-Signature" // "sha256=" + hex HMAC-SHA256 of the body with the hook secret
+	EventHeader     = "X-SRGo-Event"
+	DeliveryHeader  = "X-SRGo-Delivery" // same value across retries of an event
+
+	queueSize = 1024 // events queued per hook before dropping
+)
+
+type (
+	// Hook is a webhook as configured in the webhooks file; empty filters match all
+	Hook struct {
+		URL          string        `json:"url"`
+		Secret       string        `json:"secret,omitempty"`
+		Events       []events.Type `json:"events,omitempty"`
+		Numbers      []string      `json:"numbers,omitempty"`
+		Routes       []string      `json:"routes,omitempty"`
+		TimeoutSec   int           `json:"timeoutSeconds,omitempty"` // per attempt, 5 by default
+		MaxRetries   int           `json:"maxRetries,omitempty"`     // after the first attempt, 3 by default, -1 for none
+		RetryDelayMS int           `json:"retryDelayMs,omitempty"`   // doubled after each retry, 1000 by default
+	}
+
+	// Dispatcher delivers the events of a bus to its hooks, each hook in order on its own goroutine
+	Dispatcher struct {
+		bus   *events.Bus
+		subs  []*events.Subscription
+		abort context.CancelFunc // aborts the deliveries in progress and the retry delays
+		wg    sync.WaitGroup
+	}
+)
+
+// LoadConfig reads the hooks from a JSON array file
+func LoadConfig(path string) ([]Hook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []Hook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		if err := hooks[i].validate(); err != nil {
+			return nil, fmt.Errorf("hook %d: %w", i, err)
+		}
+	}
+	return hooks, nil
+}
+
+func (h *Hook) validate() error {
+	if h.URL == "" {
+		return fmt.Errorf("missing url")
+	}
+	for _, t := range h.Events {
+		if !slices.Contains(events.Types, t) {
+			return fmt.Errorf("invalid event %q", t)
+		}
+	}
+	h.TimeoutSec = cmp.Or(h.TimeoutSec, 5)
+	h.MaxRetries = cmp.Or(h.MaxRetries, 3)
+	h.RetryDelayMS = cmp.Or(h.RetryDelayMS, 1000)
+	return nil
+}
+
+// Sign returns the signature header value of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start subscribes every hook to the bus and starts delivering
+func Start(bus *events.Bus, hooks []Hook) *Dispatcher {
+	ctx, abort := context.WithCancel(context.Background())
+	d := &Dispatcher{bus: bus, abort: abort}
+	for i := range hooks {
+		h := hooks[i]
+		if err := h.validate(); err != nil {
+			global.LogWarning(global.LTConfiguration, "Invalid webhook - Skipped", "url", h.URL, "error", err)
+			continue
+		}
+		sub := bus.Subscribe(events.Filter{Types: h.Events, Numbers: h.Numbers, Routes: h.Routes}, queueSize)
+		d.subs = append(d.subs, sub)
+		d.wg.Add(1)
+		go d.run(ctx, &h, sub)
+		global.LogInfo(global.LTConfiguration, "Webhook set", "url", h.URL, "events", h.Events)
+	}
+	return d
+}
+
+// Stop unsubscribes the hooks and waits for the events queued to be delivered until ctx is done, when the deliveries
+// left are aborted and ctx error returned - nil Dispatcher when webhooks are disabled
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	for _, sub := range d.subs {
+		d.bus.Unsubscribe(sub)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		d.abort()
+		return nil
+	case <-ctx.Done():
+		d.abort()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) run(ctx context.Context, h *Hook, sub *events.Subscription) {
+	defer d.wg.Done()
+	client := &http.Client{Timeout: time.Duration(h.TimeoutSec) * time.Second}
+	var seq uint64
+	dropped := 0
+	for e := range sub.C {
+		seq++
+		if ctx.Err() != nil { // aborted, the events left are not attempted
+			dropped++
+			global.Prometrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+			continue
+		}
+		body, _ := json.Marshal(e)
+		id := strconv.FormatInt(e.Time.UnixNano(), 36) + "-" + strconv.FormatUint(seq, 36)
+		if deliver(ctx, client, h, e.Type, id, body) {
+			global.Prometrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+		} else {
+			global.Prometrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+		}
+	}
+	if dropped > 0 {
+		global.LogWarning(global.LTExternalData, "Webhook events dropped at shutdown", "url", h.URL, "events", dropped)
+	}
+}
+
+// deliver posts the event, retrying on transport errors, 429 and 5xx responses until ctx is done
+func deliver(ctx context.Context, client *http.Client, h *Hook, t events.Type, id string, body []byte) bool {
+	delay := time.Duration(h.RetryDelayMS) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		retry, err := post(ctx, client, h, t, id, body)
+		if err == nil {
+			return true
+		}
+		if !retry || attempt >= h.MaxRetries || ctx.Err() != nil {
+			global.LogWarning(global.LTExternalData, "Webhook delivery failed", "url", h.URL, "event", t, "delivery", id, "attempts", attempt+1, "error", err)
+			return false
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			global.LogWarning(global.LTExternalData, "Webhook delivery aborted", "url", h.URL, "event", t, "delivery", id, "attempts", attempt+1, "error", err)
+			return false
+		}
+		delay *= 2
+	}
+}
+
+func post(ctx context.Context, client *http.Client, h *Hook, t events.Type, id string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", global.B2BUANameVersion)
+	req.Header.Set(EventHeader, string(t))
+	req.Header.Set(DeliveryHeader, id)
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
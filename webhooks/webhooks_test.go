@@ -0,0 +1,133 @@
+package webhooks_test
+
+import (
+	"SRGo/events"
+	"SRGo/global"
+	"SRGo/prometheus"
+	"SRGo/webhooks"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelivery(t *testing.T) {
+	global.Prometrics = prometheus.NewMetrics("test")
+
+	// recorded by the handlers and checked once the dispatcher is stopped, not asserted from the server goroutines
+	type delivery struct {
+		body      []byte
+		signature string
+		eventType string
+	}
+	var (
+		mu         sync.Mutex
+		attempts   int
+		rejected   int
+		deliveries []delivery
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 { // first attempt fails, then retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		deliveries = append(deliveries, delivery{body, r.Header.Get(webhooks.SignatureHeader), r.Header.Get(webhooks.EventHeader)})
+	}))
+	defer srv.Close()
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		rejected++
+		w.WriteHeader(http.StatusBadRequest) // not retried
+	}))
+	defer rejecting.Close()
+
+	bus := events.NewBus()
+	d := webhooks.Start(bus, []webhooks.Hook{
+		{URL: srv.URL, Secret: "s3cret", Events: []events.Type{events.Register, events.Unregister}, RetryDelayMS: 1},
+		{URL: rejecting.URL, Numbers: []string{"999"}},
+	})
+	bus.Publish(events.Event{Type: events.Register, Extension: "1001", Contact: "10.0.0.1:5060"})
+	bus.Publish(events.Event{Type: events.Answer, From: "1001", To: "2002"})
+	bus.Publish(events.Event{Type: events.Unregister, Extension: "1001"})
+	bus.Publish(events.Event{Type: events.Answer, From: "1001", To: "999"})
+	require.NoError(t, d.Stop(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 1, rejected)
+	require.Len(t, deliveries, 2)
+	received := make([]events.Event, len(deliveries))
+	for i, dl := range deliveries {
+		require.Equal(t, webhooks.Sign("s3cret", dl.body), dl.signature)
+		require.NoError(t, json.Unmarshal(dl.body, &received[i]))
+		require.Equal(t, string(received[i].Type), dl.eventType)
+	}
+	require.Equal(t, events.Register, received[0].Type)
+	require.Equal(t, "10.0.0.1:5060", received[0].Contact)
+	require.Equal(t, events.Unregister, received[1].Type)
+}
+
+func TestStopDeadline(t *testing.T) {
+	global.Prometrics = prometheus.NewMetrics("test")
+
+	var attempts atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	bus := events.NewBus()
+	d := webhooks.Start(bus, []webhooks.Hook{
+		{URL: failing.URL, RetryDelayMS: 60000},
+		{URL: hanging.URL, TimeoutSec: 60},
+	})
+	bus.Publish(events.Event{Type: events.Answer, From: "1001", To: "2002"})
+	bus.Publish(events.Event{Type: events.Release, From: "1001", To: "2002"}) // left queued
+	require.Eventually(t, func() bool { return attempts.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.ErrorIs(t, d.Stop(ctx), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second, "retry delay and hanging delivery aborted")
+	require.Equal(t, int32(1), attempts.Load(), "queued event not attempted once aborted")
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"url": "http://presence/hook", "secret": "x", "events": ["register", "unreachable"]}]`), 0o600))
+	hooks, err := webhooks.LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	require.Equal(t, 5, hooks[0].TimeoutSec)
+	require.Equal(t, 3, hooks[0].MaxRetries)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"url": "http://presence/hook", "events": ["ring"]}]`), 0o600))
+	_, err = webhooks.LoadConfig(path)
+	require.Error(t, err)
+}
@@ -1,45 +1,94 @@
 package webserver
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	. "SRGo/global"
 	"SRGo/phone"
+	"SRGo/q850"
 	"SRGo/sip"
 )
 
 func StartWS() {
-	r := http.NewServeMux()
-	ws := fmt.Sprintf("%s:%d", sip.ServerIPv4, HttpTcpPort)
-	srv := &http.Server{Addr: ws, Handler: r, ReadTimeout: 5 * time.Second, WriteTimeout: 10 * time.Second, IdleTimeout: 15 * time.Second}
+	ws := fmt.Sprintf("%s:%d", cmp.Or(HttpBindIP, sip.ServerIPv4.String()), HttpTcpPort)
+	auth := NewAuthenticator(APIAdminKeys, APIReadOnlyKeys)
+	srv := &http.Server{Addr: ws, Handler: auth.Wrap(Handler()), ReadTimeout: 5 * time.Second, WriteTimeout: 10 * time.Second, IdleTimeout: 15 * time.Second}
 
-	wireAPIPathHandlers(r)
+	if !auth.Enabled() {
+		LogWarning(LTSecurity, "No API keys set - API Webserver open to anyone reaching it")
+	}
+
+	scheme := "http"
+	if HttpTLSCertFile != "" {
+		scheme = "https"
+	}
 
 	WtGrp.Add(1)
 	go func() {
 		defer WtGrp.Done()
-		log.Fatal(srv.ListenAndServe())
+		var err error
+		if scheme == "https" {
+			err = srv.ListenAndServeTLS(HttpTLSCertFile, HttpTLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			LogError(LTWebserver, "API Webserver stopped", "error", err)
+			os.Exit(1)
+		}
 	}()
 
-	fmt.Print("Loading API Webserver...")
-	fmt.Println("Success: HTTP", ws)
-
-	fmt.Printf("Prometheus metrics available at http://%s/metrics\n", ws)
+	LogInfo(LTWebserver, "API Webserver started", scheme, ws)
+	LogInfo(LTWebserver, "Prometheus metrics available", "url", fmt.Sprintf("%s://%s/metrics", scheme, ws))
+	LogInfo(LTSystem, "SRGo is ready to serve!")
+}
 
-	fmt.Println("SRGo is ready to serve!")
+// Handler returns the API routes, not authenticated
+func Handler() http.Handler {
+	r := http.NewServeMux()
+	wireAPIPathHandlers(r)
+	return r
 }
 
 func wireAPIPathHandlers(r *http.ServeMux) {
 	r.HandleFunc("GET /api/v1/session", serveSession)
+	r.HandleFunc("GET /api/v1/session/{callid}", serveSessionDetails)
+	r.HandleFunc("DELETE /api/v1/session/{callid}", terminateSession)
+	r.HandleFunc("GET /api/v1/session/{callid}/trace", serveSessionTrace)
+	r.HandleFunc("POST /api/v1/session/{callid}/recording", startRecording)
+	r.HandleFunc("DELETE /api/v1/session/{callid}/recording", stopRecording)
 	r.HandleFunc("GET /api/v1/phone", servePhone)
+	r.HandleFunc("GET /api/v1/trunks", serveTrunks)
+	r.HandleFunc("POST /api/v1/trunks/{name}/register", registerTrunk)
+	r.HandleFunc("GET /api/v1/bans", serveBans)
+	r.HandleFunc("POST /api/v1/bans", addBan)
+	r.HandleFunc("DELETE /api/v1/bans/{ip}", deleteBan)
 	r.HandleFunc("GET /api/v1/stats", serveStats)
+	r.HandleFunc("GET /api/v1/stats/routes", serveTrafficStats(sip.RouteStats))
+	r.HandleFunc("DELETE /api/v1/stats/routes", resetTrafficStats(sip.RouteStats))
+	r.HandleFunc("GET /api/v1/stats/peers", serveTrafficStats(sip.PeerStats))
+	r.HandleFunc("DELETE /api/v1/stats/peers", resetTrafficStats(sip.PeerStats))
+	r.HandleFunc("GET /api/v1/events", serveEvents)
+	r.HandleFunc("GET /api/v1/log/levels", serveLogLevels)
+	r.HandleFunc("PATCH /api/v1/log/levels", setLogLevels)
 	r.HandleFunc("GET /api/v1/config", serveConfig)
 	r.HandleFunc("PATCH /api/v1/config", refreshConfig)
+	r.HandleFunc("POST /api/v1/config/routes", addRoute)
+	r.HandleFunc("PUT /api/v1/config/routes/{pattern}", updateRoute)
+	r.HandleFunc("DELETE /api/v1/config/routes/{pattern}", deleteRoute)
+	r.HandleFunc("GET /api/v1/config/lookup", lookupRoute)
 
 	r.Handle("GET /metrics", Prometrics.Handler())
 	r.HandleFunc("GET /", serveHome)
@@ -49,16 +98,133 @@ func serveHome(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write(fmt.Appendf(nil, "<h1>%s API Webserver</h1>\n", B2BUANameVersion))
 }
 
-func serveSession(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Content-Type", "application/text")
+// serveSession lists the sessions oldest first, filtered by the query parameters callid, state, direction, mode, route and number,
+// and paginated with offset and limit; the total number of matches is returned in X-Total-Count
+func serveSession(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	offset, ok1 := Str2IntDefaultMinMax(q.Get("offset"), 0, 0, math.MaxInt32)
+	limit, ok2 := Str2IntDefaultMinMax(q.Get("limit"), 100, 1, 1000)
+	if (!ok1 && q.Has("offset")) || (!ok2 && q.Has("limit")) {
+		http.Error(w, "Invalid offset or limit", http.StatusBadRequest)
+		return
+	}
+	filter := sip.SessionFilter{
+		CallID:    q.Get("callid"),
+		State:     q.Get("state"),
+		Direction: q.Get("direction"),
+		Mode:      q.Get("mode"),
+		Route:     q.Get("route"),
+		Number:    q.Get("number"),
+	}
+	list, total := sip.ListSessions(filter, offset, limit)
 
-	response, _ := json.Marshal(sip.Sessions.Summaries())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if list == nil {
+		list = []sip.SessionDetails{}
+	}
+	response, _ := json.Marshal(list)
 	_, err := w.Write(response)
 	if err != nil {
 		LogError(LTWebserver, err.Error())
 	}
 }
 
+func serveSessionDetails(w http.ResponseWriter, r *http.Request) {
+	ss, ok := sip.Sessions.Load(r.PathValue("callid"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	response, _ := json.Marshal(ss.Details(true))
+	_, err := w.Write(response)
+	if err != nil {
+		LogError(LTWebserver, err.Error())
+	}
+}
+
+// terminateSession releases or cancels the call with the Q.850 cause given in ?cause= (default 16) and optional ?reason= text
+func terminateSession(w http.ResponseWriter, r *http.Request) {
+	ss, ok := sip.Sessions.Load(r.PathValue("callid"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	cause, ok := Str2IntDefaultMinMax(q.Get("cause"), q850.NormalCallClearing, 1, 127)
+	if !ok && q.Has("cause") {
+		http.Error(w, "Invalid Q.850 cause", http.StatusBadRequest)
+		return
+	}
+	if !ss.Terminate(cause, cmp.Or(q.Get("reason"), "Released by API")) {
+		http.Error(w, "Session cannot be released in its current state", http.StatusConflict)
+		return
+	}
+	LogInfo(LTWebserver, "Session released by API", "callId", ss.CallID, "cause", cause)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveSessionTrace returns the SIP ladder of a live or recently dropped call as JSON, or as raw text with ?format=raw
+func serveSessionTrace(w http.ResponseWriter, r *http.Request) {
+	entries, ok := sip.CallLadder(r.PathValue("callid"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "raw" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		var sb strings.Builder
+		for _, e := range entries {
+			fmt.Fprintf(&sb, "%s %s %s -> %s [%s]\n%s\n", e.Time.Format(time.RFC3339Nano), e.Direction, e.Src, e.Dst, e.CallID, e.Raw)
+		}
+		_, _ = w.Write([]byte(sb.String()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response, _ := json.Marshal(entries)
+	_, err := w.Write(response)
+	if err != nil {
+		LogError(LTWebserver, err.Error())
+	}
+}
+
+func startRecording(w http.ResponseWriter, r *http.Request) {
+	ss, ok := sip.Sessions.Load(r.PathValue("callid"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err := ss.StartRecording(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func stopRecording(w http.ResponseWriter, r *http.Request) {
+	ss, ok := sip.Sessions.Load(r.PathValue("callid"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	path, err := ss.StopRecording()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	response, _ := json.Marshal(struct {
+		CallID string `json:"callId"`
+		File   string `json:"file"`
+	}{CallID: ss.CallID, File: path})
+	_, _ = w.Write(response)
+}
+
 func serveStats(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -94,6 +260,67 @@ func serveStats(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+func serveTrafficStats(tc *sip.TrafficCounters) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		response, _ := json.Marshal(tc.Snapshot())
+		_, err := w.Write(response)
+		if err != nil {
+			LogError(LTWebserver, err.Error())
+		}
+	}
+}
+
+func resetTrafficStats(tc *sip.TrafficCounters) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		tc.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func serveLogLevels(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, _ := json.Marshal(LogLevels())
+	_, err := w.Write(response)
+	if err != nil {
+		LogError(LTWebserver, err.Error())
+	}
+}
+
+// setLogLevels sets the levels of the given log titles e.g. {"All": "WARN", "SIPStack": "DEBUG"} - "All" is applied first
+func setLogLevels(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	titles := make(map[LogTitle]slog.Level, len(req))
+	for name, lvl := range req {
+		lt, ok := LogTitleFromName(name)
+		if !ok {
+			http.Error(w, "Unknown log title: "+name, http.StatusBadRequest)
+			return
+		}
+		level, ok := ParseLogLevel(lvl)
+		if !ok {
+			http.Error(w, "Invalid log level: "+lvl, http.StatusBadRequest)
+			return
+		}
+		titles[lt] = level
+	}
+	if level, ok := titles[LTAll]; ok {
+		SetLogLevel(LTAll, level)
+		delete(titles, LTAll)
+	}
+	for lt, level := range titles {
+		SetLogLevel(lt, level)
+	}
+	LogInfo(LTWebserver, "Log levels updated", "levels", req)
+	serveLogLevels(w, r)
+}
+
 func servePhone(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -106,6 +333,84 @@ func servePhone(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+func serveTrunks(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, _ := json.Marshal(sip.TrunksStatus())
+	_, err := w.Write(response)
+	if err != nil {
+		LogError(LTWebserver, err.Error())
+	}
+}
+
+// registerTrunk sends a REGISTER for the trunk right away, e.g. after a failure
+func registerTrunk(w http.ResponseWriter, r *http.Request) {
+	trunk := sip.GetTrunk(r.PathValue("name"))
+	if trunk == nil {
+		http.Error(w, "Trunk not found", http.StatusNotFound)
+		return
+	}
+	trunk.Register()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func serveBans(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, _ := json.Marshal(FloodGuard.Bans())
+	_, err := w.Write(response)
+	if err != nil {
+		LogError(LTWebserver, err.Error())
+	}
+}
+
+// addBan bans the source IP in the body for durationSec seconds, permanently if 0 or the configured duration if omitted
+func addBan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IP          string `json:"ip"`
+		Reason      string `json:"reason"`
+		DurationSec *int   `json:"durationSec"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid ban: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ip := net.ParseIP(req.IP)
+	if ip == nil {
+		http.Error(w, "Invalid IP", http.StatusBadRequest)
+		return
+	}
+	d := time.Duration(-1)
+	if req.DurationSec != nil {
+		if *req.DurationSec < 0 {
+			http.Error(w, "Invalid durationSec", http.StatusBadRequest)
+			return
+		}
+		d = time.Duration(*req.DurationSec) * time.Second
+	}
+	ban := FloodGuard.Ban(ip, req.Reason, d)
+	LogInfo(LTSecurity, "Source IP banned via API", "ip", ban.IP, "reason", ban.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	response, _ := json.Marshal(ban)
+	_, _ = w.Write(response)
+}
+
+func deleteBan(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.PathValue("ip"))
+	if ip == nil {
+		http.Error(w, "Invalid IP", http.StatusBadRequest)
+		return
+	}
+	if !FloodGuard.Unban(ip) {
+		http.Error(w, "Ban not found", http.StatusNotFound)
+		return
+	}
+	LogInfo(LTSecurity, "Source IP unbanned via API", "ip", ip.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func serveConfig(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -123,3 +428,121 @@ func refreshConfig(w http.ResponseWriter, _ *http.Request) {
 	sip.RoutingEngineDB.ReloadConfig()
 	_, _ = w.Write(fmt.Appendf(nil, "<h1>%s API Webserver - Config reloaded successfully</h1>\n", B2BUANameVersion))
 }
+
+// routingEngine returns the internal Routing Engine, failing the request when calls are routed to the AS instead
+func routingEngine(w http.ResponseWriter) (*sip.RoutingEngine, bool) {
+	if sip.RoutingEngineDB == nil {
+		http.Error(w, "Internal Routing Engine not enabled", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return sip.RoutingEngineDB, true
+}
+
+// readRoute decodes the routing record in the body and the optional ?position= (0 is checked first, -1 when omitted)
+func readRoute(w http.ResponseWriter, r *http.Request) (*sip.RoutingRecord, int, bool) {
+	position := -1
+	if q := r.URL.Query(); q.Has("position") {
+		var ok bool
+		if position, ok = Str2IntDefaultMinMax(q.Get("position"), -1, 0, math.MaxInt32); !ok {
+			http.Error(w, "Invalid position", http.StatusBadRequest)
+			return nil, 0, false
+		}
+	}
+	var rd sip.RoutingRecord
+	if err := json.NewDecoder(r.Body).Decode(&rd); err != nil {
+		http.Error(w, "Invalid routing record: "+err.Error(), http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return &rd, position, true
+}
+
+func writeRouteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sip.ErrRecordNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, sip.ErrRecordExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, sip.ErrRecordNotSaved):
+		LogError(LTConfigFiles, "Error saving Routing DB", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, "Invalid routing record: "+err.Error(), http.StatusBadRequest)
+	}
+}
+
+func addRoute(w http.ResponseWriter, r *http.Request) {
+	re, ok := routingEngine(w)
+	if !ok {
+		return
+	}
+	rd, position, ok := readRoute(w, r)
+	if !ok {
+		return
+	}
+	if err := re.Add(rd, position); err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	response, _ := json.Marshal(rd.Redacted())
+	_, _ = w.Write(response)
+}
+
+func updateRoute(w http.ResponseWriter, r *http.Request) {
+	re, ok := routingEngine(w)
+	if !ok {
+		return
+	}
+	rd, position, ok := readRoute(w, r)
+	if !ok {
+		return
+	}
+	pattern := r.PathValue("pattern")
+	rd.UserpartPattern = cmp.Or(rd.UserpartPattern, pattern)
+	if err := re.Update(pattern, rd, position); err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	response, _ := json.Marshal(rd.Redacted())
+	_, _ = w.Write(response)
+}
+
+func deleteRoute(w http.ResponseWriter, r *http.Request) {
+	re, ok := routingEngine(w)
+	if !ok {
+		return
+	}
+	if err := re.Delete(r.PathValue("pattern")); err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupRoute is a dry-run returning the routing record the ?number= userpart would be routed with and its translation
+func lookupRoute(w http.ResponseWriter, r *http.Request) {
+	re, ok := routingEngine(w)
+	if !ok {
+		return
+	}
+	number := r.URL.Query().Get("number")
+	if number == "" {
+		http.Error(w, "Missing number", http.StatusBadRequest)
+		return
+	}
+	rd, userpart := re.Get(number)
+	if rd == nil {
+		http.Error(w, "No route found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	response, _ := json.Marshal(struct {
+		Number             string             `json:"number"`
+		TranslatedUserpart string             `json:"translatedUserpart"`
+		Position           int                `json:"position"`
+		RoutingRecord      *sip.RoutingRecord `json:"routingRecord"`
+	}{Number: number, TranslatedUserpart: userpart, Position: re.Position(rd), RoutingRecord: rd.Redacted()})
+	_, _ = w.Write(response)
+}
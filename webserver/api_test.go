@@ -0,0 +1,98 @@
+package webserver_test
+
+import (
+	"SRGo/cl"
+	"SRGo/global"
+	"SRGo/prometheus"
+	"SRGo/sip"
+	"SRGo/sip/state"
+	"SRGo/webserver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func addSession(callID string, dir global.Direction, st state.SessionState, from, to string) *sip.SipSession {
+	ss := sip.NewSS(dir)
+	ss.CallID = callID
+	ss.FromHeader = "<sip:" + from + "@10.0.0.1>;tag=1"
+	ss.ToHeader = "<sip:" + to + "@10.0.0.2>"
+	ss.SetState(st)
+	ss.AddMe()
+	return ss
+}
+
+func TestSessionAPI(t *testing.T) {
+	global.Prometrics = prometheus.NewMetrics("test")
+	global.CallLimiter = cl.NewCallLimiter(-1, global.Prometrics, &sync.WaitGroup{})
+	sip.Sessions = sip.NewConcurrentMapMutex[*sip.SipSession](10)
+	addSession("call-a", global.INBOUND, state.Established, "1001", "2002")
+	addSession("call-b", global.OUTBOUND, state.Established, "1001", "3003")
+	addSession("call-c", global.INBOUND, state.BeingEstablished, "4004", "2002")
+	addSession("probe-d", global.OUTBOUND, state.BeingProbed, "ping", "ping")
+
+	handler := webserver.Handler()
+	get := func(url string) (*httptest.ResponseRecorder, []sip.SessionDetails) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var list []sip.SessionDetails
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+		}
+		return rec, list
+	}
+	callIDs := func(list []sip.SessionDetails) []string {
+		ids := make([]string, 0, len(list))
+		for _, d := range list {
+			ids = append(ids, d.CallID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		url   string
+		ids   []string
+		total string
+	}{
+		{"/api/v1/session", []string{"call-a", "call-b", "call-c", "probe-d"}, "4"},
+		{"/api/v1/session?callid=call", []string{"call-a", "call-b", "call-c"}, "3"},
+		{"/api/v1/session?direction=inbound", []string{"call-a", "call-c"}, "2"},
+		{"/api/v1/session?state=established&number=3003", []string{"call-b"}, "1"},
+		{"/api/v1/session?number=2002&offset=1&limit=1", []string{"call-c"}, "2"},
+		{"/api/v1/session?offset=10", []string{}, "4"},
+	}
+	for _, tt := range tests {
+		rec, list := get(tt.url)
+		require.Equal(t, http.StatusOK, rec.Code, tt.url)
+		require.Equal(t, tt.total, rec.Header().Get("X-Total-Count"), tt.url)
+		require.Equal(t, tt.ids, callIDs(list), tt.url)
+	}
+	rec, _ := get("/api/v1/session?limit=0")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/session/call-a", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var d sip.SessionDetails
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &d))
+	require.Equal(t, "1001", d.From)
+	require.Equal(t, "2002", d.To)
+	require.False(t, d.Held)
+
+	for _, tt := range []struct {
+		url  string
+		want int
+	}{
+		{"/api/v1/session/unknown", http.StatusNotFound},
+		{"/api/v1/session/probe-d?cause=200", http.StatusBadRequest},
+		{"/api/v1/session/probe-d", http.StatusConflict}, // not a call
+	} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tt.url, nil))
+		require.Equal(t, tt.want, rec.Code, tt.url)
+	}
+}
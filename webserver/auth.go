@@ -0,0 +1,127 @@
+package webserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	. "SRGo/global"
+)
+
+type (
+	Role int
+
+	apiKey struct {
+		hash [sha256.Size]byte
+		id   string // short fingerprint logged instead of the key
+		role Role
+	}
+
+	// Authenticator checks the API key of each request against the role required by its method:
+	// read-only keys can only GET, admin keys can call everything
+	Authenticator struct {
+		keys []apiKey
+	}
+
+	statusRecorder struct {
+		http.ResponseWriter
+		status int
+	}
+)
+
+const (
+	RoleReadOnly Role = iota
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	if r == RoleAdmin {
+		return "admin"
+	}
+	return "readonly"
+}
+
+func NewAuthenticator(adminKeys, readOnlyKeys []string) *Authenticator {
+	a := &Authenticator{}
+	for _, k := range adminKeys {
+		a.add(k, RoleAdmin)
+	}
+	for _, k := range readOnlyKeys {
+		a.add(k, RoleReadOnly)
+	}
+	return a
+}
+
+func (a *Authenticator) add(key string, role Role) {
+	hash := sha256.Sum256([]byte(key))
+	a.keys = append(a.keys, apiKey{hash: hash, id: hex.EncodeToString(hash[:4]), role: role})
+}
+
+// Enabled is false when no key is configured, then the API is open to anyone reaching it
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// lookup returns the key sent as "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func (a *Authenticator) lookup(r *http.Request) (*apiKey, bool) {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		key = strings.TrimSpace(auth[7:])
+	}
+	if key == "" {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(key))
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i].hash[:]) == 1 {
+			return &a.keys[i], true
+		}
+	}
+	return nil, false
+}
+
+func requiredRole(method string) Role {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleReadOnly
+	default:
+		return RoleAdmin
+	}
+}
+
+// Wrap authenticates and authorizes the requests to h, and writes an audit log of the mutating ones
+func (a *Authenticator) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := requiredRole(r.Method)
+		keyID := "-"
+		if a.Enabled() {
+			key, ok := a.lookup(r)
+			if !ok {
+				LogWarning(LTSecurity, "API call unauthenticated", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="SRGo"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if key.role < role {
+				LogWarning(LTSecurity, "API call forbidden", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "key", key.id, "role", key.role.String())
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			keyID = key.id
+		}
+		if role == RoleReadOnly {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		LogInfo(LTSecurity, "API call audit", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery, "remote", r.RemoteAddr, "key", keyID, "status", rec.status)
+	})
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,52 @@
+package webserver_test
+
+import (
+	"SRGo/webserver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		want   int
+	}{
+		{"no key", http.MethodGet, "", "", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "X-API-Key", "nope", http.StatusUnauthorized},
+		{"readonly get", http.MethodGet, "X-API-Key", "ro-key", http.StatusNoContent},
+		{"readonly bearer get", http.MethodGet, "Authorization", "Bearer ro-key", http.StatusNoContent},
+		{"readonly patch", http.MethodPatch, "X-API-Key", "ro-key", http.StatusForbidden},
+		{"admin patch", http.MethodPatch, "Authorization", "bearer admin-key", http.StatusNoContent},
+		{"admin delete", http.MethodDelete, "X-API-Key", "admin-key", http.StatusNoContent},
+		{"basic scheme", http.MethodGet, "Authorization", "Basic ro-key", http.StatusUnauthorized},
+	}
+
+	auth := webserver.NewAuthenticator([]string{"admin-key"}, []string{"ro-key"})
+	require.True(t, auth.Enabled())
+	srv := auth.Wrap(handler)
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/config", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		require.Equal(t, tt.want, rec.Code, tt.name)
+	}
+
+	open := webserver.NewAuthenticator(nil, nil)
+	require.False(t, open.Enabled())
+	rec := httptest.NewRecorder()
+	open.Wrap(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/v1/config", nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,80 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"SRGo/events"
+	. "SRGo/global"
+)
+
+const (
+	eventsBuffer    = 256              // events queued per client before dropping
+	eventsKeepAlive = 15 * time.Second // SSE comment sent when idle, keeping proxies from closing the stream
+)
+
+// serveEvents streams call and registration events as Server-Sent Events, filtered by the comma separated
+// query parameters type, number (From, To or extension suffix) and route
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := events.Filter{Numbers: splitQuery(q.Get("number")), Routes: splitQuery(q.Get("route"))}
+	for _, t := range splitQuery(q.Get("type")) {
+		if !slices.Contains(events.Types, events.Type(t)) {
+			http.Error(w, "Invalid event type: "+t, http.StatusBadRequest)
+			return
+		}
+		filter.Types = append(filter.Types, events.Type(t))
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil { // streamed for as long as the client stays
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := EventBus.Subscribe(filter, eventsBuffer)
+	defer EventBus.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	LogInfo(LTWebserver, "Event stream opened", "remote", r.RemoteAddr, "query", r.URL.RawQuery)
+	defer func() {
+		LogInfo(LTWebserver, "Event stream closed", "remote", r.RemoteAddr, "dropped", sub.Dropped())
+	}()
+
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-sub.C:
+			data, _ := json.Marshal(e)
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err != nil || rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+func splitQuery(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}